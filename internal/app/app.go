@@ -3,8 +3,11 @@ package app
 import (
 	"context"
 	"net/http"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/shandysiswandi/goflip/internal/pkg/pkgconfig"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkghealth"
 	"github.com/shandysiswandi/goflip/internal/pkg/pkglog"
 	"github.com/shandysiswandi/goflip/internal/pkg/pkgrouter"
 	"github.com/shandysiswandi/goflip/internal/pkg/pkgroutine"
@@ -21,12 +24,15 @@ type App struct {
 	// libraries
 	uuid      pkguid.StringID
 	goroutine *pkgroutine.Manager
+	metrics   *prometheus.Registry
+	health    *pkghealth.Registry
 
 	// resources
 
 	// server
 	router     *pkgrouter.Router
 	httpServer *http.Server
+	drainDelay time.Duration
 
 	//
 	closerFn map[string]func(context.Context) error
@@ -42,6 +48,7 @@ func New() *App {
 	}
 
 	app.initConfig()
+	app.initTracing()
 	app.initLibraries()
 	app.initHTTPServer()
 	app.initModules()
@@ -7,10 +7,15 @@ import (
 	"os"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/cors"
 	"github.com/shandysiswandi/goflip/internal/pkg/pkgconfig"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkghealth"
 	"github.com/shandysiswandi/goflip/internal/pkg/pkgrouter"
 	"github.com/shandysiswandi/goflip/internal/pkg/pkgroutine"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgtrace"
 	"github.com/shandysiswandi/goflip/internal/pkg/pkguid"
 )
 
@@ -32,13 +37,59 @@ func (a *App) initConfig() {
 	a.config = cfg
 }
 
+func (a *App) initTracing() {
+	shutdown, err := pkgtrace.Init(a.ctx, pkgtrace.Config{
+		Exporter:    a.config.GetString("telemetry.tracing.exporter"),
+		Endpoint:    a.config.GetString("telemetry.tracing.endpoint"),
+		ServiceName: a.config.GetString("telemetry.tracing.service_name"),
+		SampleRatio: a.config.GetFloat("telemetry.tracing.sample_ratio"),
+	})
+	if err != nil {
+		slog.Error("failed to init tracing", "error", err)
+		os.Exit(1)
+	}
+
+	if a.closerFn == nil {
+		a.closerFn = map[string]func(context.Context) error{}
+	}
+	a.closerFn["Tracing"] = shutdown
+}
+
 func (a *App) initLibraries() {
 	a.goroutine = pkgroutine.NewManager(100)
 	a.uuid = pkguid.NewUUID()
+
+	a.metrics = prometheus.NewRegistry()
+	a.metrics.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if err := a.goroutine.RegisterMetrics(a.metrics); err != nil {
+		slog.Error("failed to register goroutine metrics", "error", err)
+		os.Exit(1)
+	}
+
+	// Goroutine saturation is normal under load and is exposed as the
+	// routine_* metrics rather than failing readiness.
+	a.health = pkghealth.NewRegistry(pkghealth.DefaultTimeout)
 }
 
 func (a *App) initHTTPServer() {
 	a.router = pkgrouter.NewRouter(a.uuid)
+	a.router.Use(pkgrouter.MiddlewareMetrics(a.metrics))
+	a.router.Handle(http.MethodGet, "/metrics", promhttp.HandlerFor(a.metrics, promhttp.HandlerOpts{}), pkgrouter.SkipBodyLogging)
+	a.router.Handle(http.MethodGet, "/livez", a.health.LivenessHandler())
+	a.router.Handle(http.MethodGet, "/readyz", a.health.ReadinessHandler())
+	a.router.Handle(http.MethodGet, "/health", a.health.ReadinessHandler())
+
+	if raw := a.config.GetString("server.drain_delay"); raw != "" {
+		delay, err := time.ParseDuration(raw)
+		if err != nil {
+			slog.Error("failed to parse server.drain_delay", "error", err)
+			os.Exit(1)
+		}
+		a.drainDelay = delay
+	}
 
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins: []string{"*"},
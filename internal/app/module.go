@@ -16,6 +16,8 @@ func (a *App) initModules() {
 			Goroutine: a.goroutine,
 			Context:   a.ctx,
 			ID:        a.uuid,
+			Metrics:   a.metrics,
+			Health:    a.health,
 		})
 		if err != nil {
 			slog.Error("failed to init module flip", "error", err)
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 func (a *App) Start() <-chan struct{} {
@@ -28,10 +29,6 @@ func (a *App) Start() <-chan struct{} {
 
 		<-sigint
 
-		if a.cancel != nil {
-			a.cancel()
-		}
-
 		terminateChan <- struct{}{}
 		close(terminateChan)
 
@@ -41,7 +38,18 @@ func (a *App) Start() <-chan struct{} {
 	return terminateChan
 }
 
+// Stop fails readiness first and waits server.drain_delay, so load balancers
+// stop sending traffic while the server still serves it, then shuts down.
 func (a *App) Stop(ctx context.Context) {
+	a.health.Drain()
+	if a.drainDelay > 0 {
+		slog.InfoContext(ctx, "draining traffic before shutdown", "delay", a.drainDelay)
+		select {
+		case <-time.After(a.drainDelay):
+		case <-ctx.Done():
+		}
+	}
+
 	if a.cancel != nil {
 		a.cancel()
 	}
@@ -57,11 +65,18 @@ func (a *App) Stop(ctx context.Context) {
 	slog.InfoContext(ctx, "all goroutines have finished successfully")
 
 	for name, closer := range a.closerFn {
-		if name == "HTTP Server" {
+		if name == "HTTP Server" || name == "Tracing" {
 			continue
 		}
 		if err := closer(ctx); err != nil {
 			slog.ErrorContext(ctx, "failed to close resources", "name", name, "error", err)
 		}
 	}
+
+	// Tracing is flushed last so the spans of the shutdown itself are kept.
+	if closer, ok := a.closerFn["Tracing"]; ok {
+		if err := closer(ctx); err != nil {
+			slog.ErrorContext(ctx, "failed to close resources", "name", "Tracing", "error", err)
+		}
+	}
 }
@@ -0,0 +1,6 @@
+package entity
+
+import "github.com/shandysiswandi/goflip/internal/pkg/pkgdecimal"
+
+// Balances holds the net amount of SUCCESS transactions per currency code.
+type Balances map[string]pkgdecimal.Decimal
@@ -22,4 +22,10 @@ const (
 	UploadStatusProcessing UploadStatus = "PROCESSING"
 	UploadStatusDone       UploadStatus = "DONE"
 	UploadStatusFailed     UploadStatus = "FAILED"
+	UploadStatusCanceled   UploadStatus = "CANCELED"
 )
+
+// IsFinal reports whether an upload in this status will not change anymore.
+func (s UploadStatus) IsFinal() bool {
+	return s == UploadStatusDone || s == UploadStatusFailed || s == UploadStatusCanceled
+}
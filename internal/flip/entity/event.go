@@ -4,4 +4,39 @@ type FailedTxEvent struct {
 	EventID  string
 	UploadID string
 	Tx       Transaction
+
+	// CorrelationID and TraceParent come from the upload request, so the
+	// handler's logs and calls can be tied back to it.
+	CorrelationID string
+	TraceParent   string
+}
+
+// PendingTxEvent is published for every PENDING transaction of an upload.
+type PendingTxEvent struct {
+	EventID  string
+	UploadID string
+	Tx       Transaction
+}
+
+// UploadStartedEvent is published when an upload starts processing.
+type UploadStartedEvent struct {
+	EventID string
+	Meta    UploadMeta
+}
+
+// DeadLetter is a failed-transaction event the consumer gave up on after
+// Attempts tries. Err is the last handler error.
+type DeadLetter struct {
+	Event    FailedTxEvent
+	Attempts int
+	Err      string
+	FailedAt int64
+}
+
+// UploadCompletedEvent is published, and sent to webhook endpoints, once an
+// upload reaches a final status.
+type UploadCompletedEvent struct {
+	EventID  string
+	Meta     UploadMeta
+	Balances Balances
 }
@@ -0,0 +1,12 @@
+package entity
+
+// ParseError describes a single statement line that could not be parsed.
+type ParseError struct {
+	// File names the archive entry the line came from when an upload is
+	// merged from several files.
+	File   string
+	Line   int64
+	Field  string
+	Reason string
+	Raw    string
+}
@@ -1,10 +1,13 @@
 package entity
 
+import "github.com/shandysiswandi/goflip/internal/pkg/pkgdecimal"
+
 type Transaction struct {
 	Timestamp    int64
 	Counterparty string
 	Type         TxType
-	Amount       int64
+	Amount       pkgdecimal.Decimal
+	Currency     string
 	Status       TxStatus
 	Description  string
 }
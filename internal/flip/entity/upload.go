@@ -4,9 +4,31 @@ type UploadMeta struct {
 	ID        string
 	Status    UploadStatus
 	Err       string
+	CreatedAt int64
 	StartedAt int64
 	EndedAt   int64
 
+	// Profile is the parsing profile the file was read with.
+	Profile string
+
+	// FileName is the name of the uploaded file or archive entry, if known.
+	FileName string
+
+	// CallbackURL receives a webhook when the upload finishes, in addition to
+	// the globally configured endpoints.
+	CallbackURL string
+
+	// IdempotencyKey is the client key the upload was created with, if any.
+	IdempotencyKey string
+
+	// ContentHash is the hex SHA-256 of the uploaded bytes when content
+	// deduplication is enabled.
+	ContentHash string
+
+	// DuplicateOf is the earlier upload with the same profile and content.
+	// Failed transactions of a duplicate are not published again.
+	DuplicateOf string
+
 	// Stats help observability without storing everything
 	TotalLines int64
 	ParsedOK   int64
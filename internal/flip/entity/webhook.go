@@ -0,0 +1,13 @@
+package entity
+
+// WebhookDelivery records one attempt to deliver an event to a webhook
+// endpoint.
+type WebhookDelivery struct {
+	EventID    string
+	URL        string
+	Attempt    int
+	StatusCode int
+	Err        string
+	Delivered  bool
+	At         int64
+}
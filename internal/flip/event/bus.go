@@ -3,17 +3,87 @@ package event
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgtrace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var ErrBusClosed = errors.New("event bus is closed")
+const tracerName = "github.com/shandysiswandi/goflip/internal/flip/event"
 
+var (
+	ErrBusClosed = errors.New("event bus is closed")
+
+	// ErrBufferFull is returned by Publish when a subscriber group with
+	// BackpressureError has no room left.
+	ErrBufferFull = errors.New("event subscriber buffer is full")
+)
+
+// Topic names a stream of events of type T. Every Topic with the same name
+// must use the same T.
+type Topic[T any] struct {
+	name string
+}
+
+func NewTopic[T any](name string) Topic[T] {
+	return Topic[T]{name: name}
+}
+
+func (t Topic[T]) Name() string {
+	return t.name
+}
+
+// The topics the flip module publishes on.
+//
+//nolint:gochecknoglobals // typed topic names shared by publishers and subscribers
+var (
+	TopicTxFailed        = NewTopic[entity.FailedTxEvent]("tx.failed")
+	TopicTxPending       = NewTopic[entity.PendingTxEvent]("tx.pending")
+	TopicUploadStarted   = NewTopic[entity.UploadStartedEvent]("upload.started")
+	TopicUploadCompleted = NewTopic[entity.UploadCompletedEvent]("upload.completed")
+)
+
+// Backpressure decides what Publish does when a subscriber group's buffer is
+// full.
+type Backpressure string
+
+const (
+	// BackpressureBlock waits for room, or for the publish context to end.
+	BackpressureBlock Backpressure = "block"
+	// BackpressureDropOldest discards the oldest buffered event.
+	BackpressureDropOldest Backpressure = "drop_oldest"
+	// BackpressureError fails the publish with ErrBufferFull.
+	BackpressureError Backpressure = "error"
+)
+
+type SubscribeOptions struct {
+	// Buffer defaults to the buffer given to NewBus.
+	Buffer int
+
+	// Backpressure defaults to BackpressureBlock.
+	Backpressure Backpressure
+}
+
+// Bus fans events out by topic. Every subscriber group of a topic gets its
+// own copy of each event in its own buffer, while the subscribers within a
+// group compete for them. Events published to a topic without groups are
+// dropped.
 type Bus struct {
 	mu     sync.RWMutex
 	closed bool
-	ch     chan entity.FailedTxEvent
+	buffer int
+	topics map[string]map[string]groupQueue // topic -> group -> *queue[T]
+}
+
+// groupQueue is the *queue[T] of a subscriber group without its event type.
+type groupQueue interface {
+	close()
+	stats() (depth, capacity int, dropped uint64)
 }
 
 func NewBus(buffer int) *Bus {
@@ -22,39 +92,235 @@ func NewBus(buffer int) *Bus {
 	}
 
 	return &Bus{
-		ch: make(chan entity.FailedTxEvent, buffer),
+		buffer: buffer,
+		topics: make(map[string]map[string]groupQueue),
+	}
+}
+
+// Subscription receives the events of one subscriber group.
+type Subscription[T any] struct {
+	bus   *Bus
+	topic string
+	group string
+	queue *queue[T]
+}
+
+// Subscribe joins group on topic, creating it with opts if it does not exist
+// yet; later subscribers share the existing group and its options. On a
+// closed bus the returned subscription is already closed.
+func Subscribe[T any](b *Bus, topic Topic[T], group string, opts SubscribeOptions) *Subscription[T] {
+	if opts.Buffer < 1 {
+		opts.Buffer = b.buffer
+	}
+	if opts.Backpressure == "" {
+		opts.Backpressure = BackpressureBlock
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &Subscription[T]{bus: b, topic: topic.name, group: group}
+	if b.closed {
+		sub.queue = newQueue[T](opts)
+		sub.queue.close()
+		return sub
+	}
+
+	groups := b.topics[topic.name]
+	if groups == nil {
+		groups = make(map[string]groupQueue)
+		b.topics[topic.name] = groups
+	}
+
+	if existing, ok := groups[group]; ok {
+		q, ok := existing.(*queue[T])
+		if !ok {
+			panic(fmt.Sprintf("event: topic %q subscribed with different event types", topic.name))
+		}
+		sub.queue = q
+		return sub
+	}
+
+	sub.queue = newQueue[T](opts)
+	groups[group] = sub.queue
+	return sub
+}
+
+// Events is closed when the group is closed or the bus is closed.
+func (s *Subscription[T]) Events() <-chan T {
+	return s.queue.ch
+}
+
+// Len is the number of events buffered for the group.
+func (s *Subscription[T]) Len() int {
+	return len(s.queue.ch)
+}
+
+// Dropped counts the events BackpressureDropOldest discarded for the group.
+func (s *Subscription[T]) Dropped() uint64 {
+	return s.queue.dropped.Load()
+}
+
+// Close removes the group from the bus, which ends it for all its
+// subscribers.
+func (s *Subscription[T]) Close() {
+	s.bus.mu.Lock()
+	if groups := s.bus.topics[s.topic]; groups != nil && groups[s.group] == s.queue {
+		delete(groups, s.group)
 	}
+	s.bus.mu.Unlock()
+
+	s.queue.close()
 }
 
-func (b *Bus) Publish(ctx context.Context, event entity.FailedTxEvent) error {
+// deliver hands event to this group only, e.g. to redeliver it from the
+// outbox without duplicating it for the other groups.
+func (s *Subscription[T]) deliver(ctx context.Context, event T) error {
+	return s.queue.send(ctx, event)
+}
+
+// Publish hands event to every subscriber group of topic. Errors of
+// individual groups are joined; the other groups still get the event.
+func Publish[T any](ctx context.Context, b *Bus, topic Topic[T], event T) (err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "publish "+topic.name,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("messaging.destination.name", topic.name)),
+	)
+	defer func() { pkgtrace.End(span, err) }()
+
 	b.mu.RLock()
 	if b.closed {
 		b.mu.RUnlock()
 		return ErrBusClosed
 	}
+	queues := make([]*queue[T], 0, len(b.topics[topic.name]))
+	for _, existing := range b.topics[topic.name] {
+		if q, ok := existing.(*queue[T]); ok {
+			queues = append(queues, q)
+		}
+	}
+	b.mu.RUnlock()
+	span.SetAttributes(attribute.Int("messaging.groups", len(queues)))
 
-	select {
-	case b.ch <- event:
-		b.mu.RUnlock()
-		return nil
-	case <-ctx.Done():
-		b.mu.RUnlock()
-		return ctx.Err()
+	var errs []error
+	for _, q := range queues {
+		if err := q.send(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	return errors.Join(errs...)
 }
 
-func (b *Bus) Subscribe() <-chan entity.FailedTxEvent {
-	return b.ch
+// Check is a health check that fails with ErrBusClosed once the bus is
+// closed.
+func (b *Bus) Check(context.Context) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return ErrBusClosed
+	}
+	return nil
 }
 
+// Close closes every subscriber group. Publishing afterwards returns
+// ErrBusClosed.
 func (b *Bus) Close() {
 	b.mu.Lock()
-	defer b.mu.Unlock()
-
 	if b.closed {
+		b.mu.Unlock()
 		return
 	}
-
 	b.closed = true
-	close(b.ch)
+	var queues []groupQueue
+	for _, groups := range b.topics {
+		for _, q := range groups {
+			queues = append(queues, q)
+		}
+	}
+	b.topics = make(map[string]map[string]groupQueue)
+	b.mu.Unlock()
+
+	for _, q := range queues {
+		q.close()
+	}
+}
+
+type queue[T any] struct {
+	policy Backpressure
+	ch     chan T
+	done   chan struct{} // closed first, to release blocked senders
+
+	mu      sync.RWMutex // held for reading while sending, so ch is never closed under a send
+	closed  bool
+	once    sync.Once
+	dropMu  sync.Mutex
+	dropped atomic.Uint64
+}
+
+func newQueue[T any](opts SubscribeOptions) *queue[T] {
+	return &queue[T]{
+		policy: opts.Backpressure,
+		ch:     make(chan T, opts.Buffer),
+		done:   make(chan struct{}),
+	}
+}
+
+func (q *queue[T]) send(ctx context.Context, event T) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrBusClosed
+	}
+
+	switch q.policy {
+	case BackpressureError:
+		select {
+		case q.ch <- event:
+			return nil
+		default:
+			return ErrBufferFull
+		}
+	case BackpressureDropOldest:
+		q.dropMu.Lock()
+		defer q.dropMu.Unlock()
+		for {
+			select {
+			case q.ch <- event:
+				return nil
+			default:
+			}
+			select {
+			case <-q.ch:
+				q.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case q.ch <- event:
+			return nil
+		case <-q.done:
+			return ErrBusClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (q *queue[T]) stats() (int, int, uint64) {
+	return len(q.ch), cap(q.ch), q.dropped.Load()
+}
+
+func (q *queue[T]) close() {
+	q.once.Do(func() {
+		close(q.done)
+
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		q.closed = true
+		close(q.ch)
+	})
 }
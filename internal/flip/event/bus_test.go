@@ -0,0 +1,157 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+)
+
+func TestBusFansOutToGroups(t *testing.T) {
+	bus := NewBus(10)
+	audit := Subscribe(bus, TopicTxFailed, "audit", SubscribeOptions{})
+	recon1 := Subscribe(bus, TopicTxFailed, "reconciliation", SubscribeOptions{})
+	recon2 := Subscribe(bus, TopicTxFailed, "reconciliation", SubscribeOptions{})
+	completed := Subscribe(bus, TopicUploadCompleted, "audit", SubscribeOptions{})
+
+	for _, id := range []string{"evt-1", "evt-2"} {
+		if err := Publish(context.Background(), bus, TopicTxFailed, entity.FailedTxEvent{EventID: id}); err != nil {
+			t.Fatalf("publish %s: %v", id, err)
+		}
+	}
+
+	if audit.Len() != 2 {
+		t.Fatalf("expected every group to get every event, got %d", audit.Len())
+	}
+	if recon1.Events() != recon2.Events() || recon1.Len() != 2 {
+		t.Fatalf("expected subscribers of a group to share one buffer of 2, got %d", recon1.Len())
+	}
+	if completed.Len() != 0 {
+		t.Fatalf("expected other topics to get nothing, got %d", completed.Len())
+	}
+
+	recon1.Close()
+	if err := Publish(context.Background(), bus, TopicTxFailed, entity.FailedTxEvent{EventID: "evt-3"}); err != nil {
+		t.Fatalf("publish after leaving: %v", err)
+	}
+	if audit.Len() != 3 {
+		t.Fatalf("expected the remaining group to keep receiving, got %d", audit.Len())
+	}
+
+	var got []string
+	for event := range recon2.Events() {
+		got = append(got, event.EventID)
+	}
+	if len(got) != 2 || got[0] != "evt-1" || got[1] != "evt-2" {
+		t.Fatalf("expected the closed group to drain in order, got %v", got)
+	}
+}
+
+func TestBusBackpressure(t *testing.T) {
+	ctx := context.Background()
+	bus := NewBus(10)
+	dropping := Subscribe(bus, TopicTxPending, "dropping", SubscribeOptions{Buffer: 2, Backpressure: BackpressureDropOldest})
+	failing := Subscribe(bus, TopicTxPending, "failing", SubscribeOptions{Buffer: 2, Backpressure: BackpressureError})
+
+	var errs int
+	for _, id := range []string{"evt-1", "evt-2", "evt-3"} {
+		if err := Publish(ctx, bus, TopicTxPending, entity.PendingTxEvent{EventID: id}); err != nil {
+			if !errors.Is(err, ErrBufferFull) {
+				t.Fatalf("expected ErrBufferFull, got %v", err)
+			}
+			errs++
+		}
+	}
+
+	if errs != 1 || failing.Len() != 2 {
+		t.Fatalf("expected the third publish to fail for the error group, got %d errors and %d buffered", errs, failing.Len())
+	}
+	if dropping.Dropped() != 1 {
+		t.Fatalf("expected one dropped event, got %d", dropping.Dropped())
+	}
+	if first := <-dropping.Events(); first.EventID != "evt-2" {
+		t.Fatalf("expected the oldest event to be dropped, got %s first", first.EventID)
+	}
+	if first := <-failing.Events(); first.EventID != "evt-1" {
+		t.Fatalf("expected the error group to keep the oldest events, got %s first", first.EventID)
+	}
+}
+
+func TestBusBlockingPublish(t *testing.T) {
+	bus := NewBus(1)
+	Subscribe(bus, TopicUploadStarted, "slow", SubscribeOptions{})
+	if err := bus.Check(context.Background()); err != nil {
+		t.Fatalf("expected an open bus to be healthy, got %v", err)
+	}
+
+	if err := Publish(context.Background(), bus, TopicUploadStarted, entity.UploadStartedEvent{EventID: "evt-1"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := Publish(ctx, bus, TopicUploadStarted, entity.UploadStartedEvent{EventID: "evt-2"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a full group to block until the deadline, got %v", err)
+	}
+
+	published := make(chan error, 1)
+	go func() {
+		published <- Publish(context.Background(), bus, TopicUploadStarted, entity.UploadStartedEvent{EventID: "evt-3"})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	bus.Close()
+
+	select {
+	case err := <-published:
+		if !errors.Is(err, ErrBusClosed) {
+			t.Fatalf("expected close to release the blocked publish, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("close did not release the blocked publish")
+	}
+
+	if err := Publish(context.Background(), bus, TopicUploadStarted, entity.UploadStartedEvent{}); !errors.Is(err, ErrBusClosed) {
+		t.Fatalf("expected ErrBusClosed after close, got %v", err)
+	}
+	if err := bus.Check(context.Background()); !errors.Is(err, ErrBusClosed) {
+		t.Fatalf("expected a closed bus to fail its check, got %v", err)
+	}
+	if _, ok := <-Subscribe(bus, TopicUploadStarted, "late", SubscribeOptions{}).Events(); ok {
+		t.Fatal("expected a subscription on a closed bus to be closed")
+	}
+}
+
+func TestBusMetrics(t *testing.T) {
+	bus := NewBus(4)
+	reg := prometheus.NewRegistry()
+	if err := bus.RegisterMetrics(reg); err != nil {
+		t.Fatalf("register metrics: %v", err)
+	}
+	Subscribe(bus, TopicTxPending, "audit", SubscribeOptions{Buffer: 1, Backpressure: BackpressureDropOldest})
+
+	for _, id := range []string{"evt-1", "evt-2", "evt-3"} {
+		if err := Publish(context.Background(), bus, TopicTxPending, entity.PendingTxEvent{EventID: id}); err != nil {
+			t.Fatalf("publish %s: %v", id, err)
+		}
+	}
+
+	expected := `
+# HELP flip_bus_dropped_total Events a drop_oldest subscriber group discarded.
+# TYPE flip_bus_dropped_total counter
+flip_bus_dropped_total{group="audit",topic="tx.pending"} 2
+# HELP flip_bus_queue_capacity Buffer size of a subscriber group.
+# TYPE flip_bus_queue_capacity gauge
+flip_bus_queue_capacity{group="audit",topic="tx.pending"} 1
+# HELP flip_bus_queue_depth Events buffered for a subscriber group.
+# TYPE flip_bus_queue_depth gauge
+flip_bus_queue_depth{group="audit",topic="tx.pending"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
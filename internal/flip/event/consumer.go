@@ -8,64 +8,134 @@ import (
 	"time"
 
 	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkglog"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgtrace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// ErrConsumerStopped is returned by ReconciliationConsumer.Check once the
+// consumer is stopped.
+var ErrConsumerStopped = errors.New("reconciliation consumer is stopped")
+
 type Handler interface {
 	Handle(ctx context.Context, event entity.FailedTxEvent) error
 }
 
 type ConsumerConfig struct {
-	Workers     int
-	MaxRetries  int
-	BaseBackoff time.Duration
+	Workers int
+	Retry   RetryPolicy
+
+	// Dedup skips events that were already handled. Defaults to a
+	// MemoryDeduper.
+	Dedup Deduper
+
+	// Group is the subscriber group on TopicTxFailed. Defaults to
+	// "reconciliation".
+	Group        string
+	Subscription SubscribeOptions
+
+	// PartitionBy turns the workers into lanes that keep the events of one
+	// key in order.
+	PartitionBy PartitionKey
+
+	// Metrics is optional.
+	Metrics *Metrics
+
+	// Clock stamps dead letters. Defaults to time.Now.
+	Clock func() time.Time
 }
 
 type ReconciliationConsumer struct {
-	bus         *Bus
+	sub         *Subscription[entity.FailedTxEvent]
 	handler     Handler
+	outbox      Outbox
 	workers     int
-	maxRetries  int
-	baseBackoff time.Duration
-	seen        sync.Map
+	partitionBy PartitionKey
+	retry       RetryPolicy
+	dedup       Deduper
+	metrics     *Metrics
+	now         func() time.Time
+	active      sync.Map // IDs of events being handled
 	wg          sync.WaitGroup
+
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func NewReconciliationConsumer(bus *Bus, handler Handler, cfg ConsumerConfig) *ReconciliationConsumer {
+// NewReconciliationConsumer subscribes to TopicTxFailed on bus right away, so
+// events published before Start are kept. With an outbox, handled
+// events are acknowledged, events that exhaust their retries become dead
+// letters, and pending events are delivered again on Start. A nil outbox logs
+// and drops events that keep failing. cfg.Retry decides which errors are
+// retried and how long to wait in between.
+func NewReconciliationConsumer(bus *Bus, handler Handler, outbox Outbox, cfg ConsumerConfig) *ReconciliationConsumer {
 	workers := cfg.Workers
 	if workers < 1 {
 		workers = 4
 	}
 
-	maxRetries := cfg.MaxRetries
-	if maxRetries < 0 {
-		maxRetries = 0
+	dedup := cfg.Dedup
+	if dedup == nil {
+		dedup = NewMemoryDeduper(0, 0)
+	}
+
+	now := cfg.Clock
+	if now == nil {
+		now = time.Now
 	}
 
-	baseBackoff := cfg.BaseBackoff
-	if baseBackoff <= 0 {
-		baseBackoff = 100 * time.Millisecond
+	group := cfg.Group
+	if group == "" {
+		group = "reconciliation"
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	return &ReconciliationConsumer{
-		bus:         bus,
+		sub:         Subscribe(bus, TopicTxFailed, group, cfg.Subscription),
 		handler:     handler,
+		outbox:      outbox,
 		workers:     workers,
-		maxRetries:  maxRetries,
-		baseBackoff: baseBackoff,
+		partitionBy: cfg.PartitionBy,
+		retry:       cfg.Retry.withDefaults(),
+		dedup:       dedup,
+		metrics:     cfg.Metrics,
+		now:         now,
+		ctx:         ctx,
+		cancel:      cancel,
 	}
 }
 
 func (c *ReconciliationConsumer) Start() {
-	for i := 0; i < c.workers; i++ {
+	if c.partitionBy != PartitionNone {
+		lanes := make([]chan entity.FailedTxEvent, c.workers)
+		for i := range lanes {
+			lanes[i] = make(chan entity.FailedTxEvent, laneBuffer)
+			c.wg.Add(1)
+			go c.runLane(lanes[i])
+		}
+		c.wg.Add(1)
+		go c.dispatch(lanes)
+	} else {
+		for i := 0; i < c.workers; i++ {
+			c.wg.Add(1)
+			go c.worker()
+		}
+	}
+
+	if c.outbox != nil {
 		c.wg.Add(1)
-		go c.worker()
+		go c.redeliver()
 	}
 }
 
+// Stop leaves the subscriber group and waits for the events already buffered
+// to be handled.
 func (c *ReconciliationConsumer) Stop(ctx context.Context) error {
-	if c.bus != nil {
-		c.bus.Close()
-	}
+	c.cancel()
+	c.sub.Close()
 
 	done := make(chan struct{})
 	go func() {
@@ -81,53 +151,186 @@ func (c *ReconciliationConsumer) Stop(ctx context.Context) error {
 	}
 }
 
+// Check is a health check that fails once the consumer is stopped.
+func (c *ReconciliationConsumer) Check(context.Context) error {
+	if c.ctx.Err() != nil {
+		return ErrConsumerStopped
+	}
+	return nil
+}
+
+// redeliver hands this consumer the events a previous process left in the
+// outbox. Other groups on the topic saw them when they were published.
+func (c *ReconciliationConsumer) redeliver() {
+	defer c.wg.Done()
+
+	events, err := c.outbox.PendingOutbox(c.ctx)
+	if err != nil {
+		slog.Error("failed to read event outbox", "error", err)
+		return
+	}
+	if len(events) > 0 {
+		slog.Info("redelivering pending failed transaction events", "count", len(events))
+	}
+
+	for _, event := range events {
+		if err := c.sub.deliver(c.ctx, event); err != nil {
+			slog.Warn("stopped redelivering pending events", "event_id", event.EventID, "error", err)
+			return
+		}
+	}
+}
+
 func (c *ReconciliationConsumer) worker() {
 	defer c.wg.Done()
 
-	for event := range c.bus.Subscribe() {
+	for event := range c.sub.Events() {
 		c.processEvent(event)
 	}
 }
 
+// eventContext carries the correlation ID and trace of the upload that
+// published event, so the handler's logs, spans and calls are tied to it.
+func eventContext(ctx context.Context, event entity.FailedTxEvent) context.Context {
+	if event.CorrelationID != "" {
+		ctx = pkglog.SetCorrelationID(ctx, event.CorrelationID)
+	}
+	if event.TraceParent != "" {
+		ctx = pkglog.SetTraceParent(ctx, event.TraceParent)
+		ctx = pkgtrace.Extract(ctx, event.TraceParent)
+	}
+	return ctx
+}
+
+// processEvent traces every event in a consumer span, with a child span per
+// handler attempt, and records the outcome: handled, duplicate,
+// dead_letter or shutdown.
 func (c *ReconciliationConsumer) processEvent(event entity.FailedTxEvent) {
 	if c.handler == nil {
 		return
 	}
 
+	ctx, span := otel.Tracer(tracerName).Start(eventContext(context.Background(), event), "process "+TopicTxFailed.Name(),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.destination.name", TopicTxFailed.Name()),
+			attribute.String("event.id", event.EventID),
+			attribute.String("upload.id", event.UploadID),
+		),
+	)
+	defer span.End()
+
 	if event.EventID != "" {
-		if _, loaded := c.seen.LoadOrStore(event.EventID, struct{}{}); loaded {
-			slog.Info("skip duplicate failed transaction event", "event_id", event.EventID, "upload_id", event.UploadID)
+		if _, loaded := c.active.LoadOrStore(event.EventID, struct{}{}); loaded {
+			slog.InfoContext(ctx, "skip duplicate failed transaction event", "event_id", event.EventID, "upload_id", event.UploadID)
+			c.finish(span, outcomeDuplicate)
+			return
+		}
+		defer c.active.Delete(event.EventID)
+
+		seen, err := c.dedup.Seen(ctx, event.EventID)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to check handled events", "event_id", event.EventID, "upload_id", event.UploadID, "error", err)
+		}
+		if seen {
+			slog.InfoContext(ctx, "skip duplicate failed transaction event", "event_id", event.EventID, "upload_id", event.UploadID)
+			c.finish(span, outcomeDuplicate)
+			c.ack(ctx, event)
 			return
 		}
 	}
 
-	backoff := c.baseBackoff
-	for attempt := 0; attempt <= c.maxRetries; attempt++ {
-		err := c.handler.Handle(context.Background(), event)
+	start := time.Now()
+	var delay time.Duration
+	for attempt := 1; ; attempt++ {
+		span.SetAttributes(attribute.Int("retry.attempts", attempt))
+
+		attemptCtx, attemptSpan := otel.Tracer(tracerName).Start(ctx, "reconcile", trace.WithAttributes(attribute.Int("retry.attempt", attempt)))
+		err := c.handler.Handle(attemptCtx, event)
+		pkgtrace.End(attemptSpan, err)
 		if err == nil {
+			c.finish(span, outcomeHandled)
+			c.markHandled(ctx, event)
+			c.ack(ctx, event)
 			return
 		}
 
-		if attempt == c.maxRetries {
-			slog.Error("failed to reconcile transaction after retries", "event_id", event.EventID, "upload_id", event.UploadID, "error", err)
+		retry := c.retry.retryable(err) && attempt <= c.retry.MaxRetries
+		if retry {
+			delay = c.retry.backoff(attempt, delay, err)
+			if c.retry.MaxElapsed > 0 && time.Since(start)+delay > c.retry.MaxElapsed {
+				retry = false
+			}
+		}
+
+		if !retry {
+			slog.ErrorContext(ctx, "failed to reconcile transaction", "event_id", event.EventID, "upload_id", event.UploadID, "attempts", attempt, "error", err)
+			c.finish(span, outcomeDeadLetter)
+			span.SetStatus(codes.Error, err.Error())
+			c.deadLetter(ctx, entity.DeadLetter{Event: event, Attempts: attempt, Err: err.Error(), FailedAt: c.now().Unix()})
 			return
 		}
 
-		if !sleepBackoff(backoff) {
+		if !c.sleep(delay) {
+			// The event stays in the outbox and is delivered again on the
+			// next start.
+			slog.WarnContext(ctx, "stopped retrying on shutdown", "event_id", event.EventID, "upload_id", event.UploadID, "attempts", attempt)
+			c.finish(span, outcomeShutdown)
 			return
 		}
-		backoff *= 2
+		c.metrics.retry()
 	}
 }
 
-func sleepBackoff(d time.Duration) bool {
-	if d <= 0 {
-		return false
+// finish records how processing an event ended.
+func (c *ReconciliationConsumer) finish(span trace.Span, outcome string) {
+	span.SetAttributes(attribute.String("event.outcome", outcome))
+	c.metrics.event(outcome)
+}
+
+// markHandled records a success before the outbox is acknowledged, so an
+// event redelivered after a crash in between is recognized.
+func (c *ReconciliationConsumer) markHandled(ctx context.Context, event entity.FailedTxEvent) {
+	if event.EventID == "" {
+		return
 	}
-	timer := time.NewTimer(d)
+
+	if err := c.dedup.MarkHandled(ctx, event.EventID); err != nil {
+		slog.WarnContext(ctx, "failed to mark failed transaction event handled", "event_id", event.EventID, "upload_id", event.UploadID, "error", err)
+	}
+}
+
+func (c *ReconciliationConsumer) ack(ctx context.Context, event entity.FailedTxEvent) {
+	if c.outbox == nil {
+		return
+	}
+
+	if err := c.outbox.AckOutbox(ctx, event.EventID); err != nil {
+		slog.WarnContext(ctx, "failed to acknowledge failed transaction event", "event_id", event.EventID, "upload_id", event.UploadID, "error", err)
+	}
+}
+
+func (c *ReconciliationConsumer) deadLetter(ctx context.Context, letter entity.DeadLetter) {
+	if c.outbox == nil {
+		return
+	}
+
+	if err := c.outbox.SaveDeadLetter(ctx, letter); err != nil {
+		slog.ErrorContext(ctx, "failed to save dead letter", "event_id", letter.Event.EventID, "upload_id", letter.Event.UploadID, "error", err)
+	}
+}
+
+// sleep waits for delay and reports false if the consumer is stopped first.
+func (c *ReconciliationConsumer) sleep(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
 	defer timer.Stop()
-	<-timer.C
-	return true
+
+	select {
+	case <-timer.C:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
 }
 
 type NoopReconciler struct{}
@@ -137,6 +340,6 @@ func (NoopReconciler) Handle(ctx context.Context, event entity.FailedTxEvent) er
 		return errors.New("missing event id")
 	}
 
-	slog.Info("reconciled failed transaction", "event_id", event.EventID, "upload_id", event.UploadID)
+	slog.InfoContext(ctx, "reconciled failed transaction", "event_id", event.EventID, "upload_id", event.UploadID)
 	return nil
 }
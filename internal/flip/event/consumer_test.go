@@ -3,11 +3,23 @@ package event
 import (
 	"context"
 	"errors"
+	"reflect"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/flip/store"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgerror"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkglog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type handlerFunc func(ctx context.Context, event entity.FailedTxEvent) error
@@ -34,18 +46,17 @@ func TestReconciliationConsumerRetriesAndIdempotent(t *testing.T) {
 		return nil
 	})
 
-	consumer := NewReconciliationConsumer(bus, handler, ConsumerConfig{
-		Workers:     1,
-		MaxRetries:  2,
-		BaseBackoff: time.Millisecond,
+	consumer := NewReconciliationConsumer(bus, handler, nil, ConsumerConfig{
+		Workers: 1,
+		Retry:   RetryPolicy{MaxRetries: 2, BaseBackoff: time.Millisecond},
 	})
 	consumer.Start()
 
 	event := entity.FailedTxEvent{EventID: "evt-1", UploadID: "upload-1"}
-	if err := bus.Publish(context.Background(), event); err != nil {
+	if err := Publish(context.Background(), bus, TopicTxFailed, event); err != nil {
 		t.Fatalf("publish event: %v", err)
 	}
-	if err := bus.Publish(context.Background(), event); err != nil {
+	if err := Publish(context.Background(), bus, TopicTxFailed, event); err != nil {
 		t.Fatalf("publish duplicate: %v", err)
 	}
 
@@ -55,11 +66,612 @@ func TestReconciliationConsumerRetriesAndIdempotent(t *testing.T) {
 		t.Fatal("timeout waiting for handler")
 	}
 
+	if err := consumer.Check(context.Background()); err != nil {
+		t.Fatalf("expected a running consumer to be healthy, got %v", err)
+	}
 	if err := consumer.Stop(context.Background()); err != nil {
 		t.Fatalf("stop consumer: %v", err)
 	}
+	if err := consumer.Check(context.Background()); !errors.Is(err, ErrConsumerStopped) {
+		t.Fatalf("expected a stopped consumer to fail its check, got %v", err)
+	}
 
 	if attempts != 3 {
 		t.Fatalf("expected 3 attempts, got %d", attempts)
 	}
 }
+
+func TestReconciliationConsumerDeadLettersAndReplays(t *testing.T) {
+	outbox := store.NewInMemoryStore()
+	bus := NewBus(10)
+	publisher := NewPublisher(outbox, bus)
+
+	var healthy atomic.Bool
+	handled := make(chan string, 10)
+	handler := handlerFunc(func(ctx context.Context, event entity.FailedTxEvent) error {
+		if event.EventID == "evt-bad" && !healthy.Load() {
+			return errors.New("reconciliation service unavailable")
+		}
+		handled <- event.EventID
+		return nil
+	})
+
+	consumer := NewReconciliationConsumer(bus, handler, outbox, ConsumerConfig{
+		Workers: 1,
+		Retry:   RetryPolicy{MaxRetries: 1, BaseBackoff: time.Millisecond},
+	})
+	consumer.Start()
+
+	for _, id := range []string{"evt-bad", "evt-ok"} {
+		if err := publisher.PublishFailedTx(context.Background(), entity.FailedTxEvent{EventID: id, UploadID: "upload-1"}); err != nil {
+			t.Fatalf("publish %s: %v", id, err)
+		}
+	}
+
+	select {
+	case id := <-handled:
+		if id != "evt-ok" {
+			t.Fatalf("unexpected handled event %s", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for handler")
+	}
+	if err := consumer.Stop(context.Background()); err != nil {
+		t.Fatalf("stop consumer: %v", err)
+	}
+
+	pending, _ := outbox.PendingOutbox(context.Background())
+	if len(pending) != 0 {
+		t.Fatalf("expected an empty outbox, got %+v", pending)
+	}
+	letters, total, err := consumer.DeadLetters(context.Background(), 1, 10)
+	if err != nil || total != 1 || letters[0].Event.EventID != "evt-bad" || letters[0].Attempts != 2 || letters[0].Err != "reconciliation service unavailable" {
+		t.Fatalf("unexpected dead letters: %+v (total %d), %v", letters, total, err)
+	}
+
+	letter, replayed, err := consumer.ReplayDeadLetter(context.Background(), "evt-bad")
+	if err != nil || replayed || letter.Attempts != 3 {
+		t.Fatalf("expected a failed replay to count the attempt, got %+v, %v, %v", letter, replayed, err)
+	}
+
+	healthy.Store(true)
+	if _, replayed, err := consumer.ReplayDeadLetter(context.Background(), "evt-bad"); err != nil || !replayed {
+		t.Fatalf("expected the replay to succeed, got %v, %v", replayed, err)
+	}
+	if _, _, err := consumer.ReplayDeadLetter(context.Background(), "evt-bad"); !errors.Is(err, pkgerror.ErrNotFound) {
+		t.Fatalf("expected a replayed dead letter to be removed, got %v", err)
+	}
+}
+
+func TestReconciliationConsumerReplaysDeadLetterOnce(t *testing.T) {
+	ctx := context.Background()
+	outbox := store.NewInMemoryStore()
+	for _, id := range []string{"evt-1", "evt-2", "evt-3"} {
+		letter := entity.DeadLetter{Event: entity.FailedTxEvent{EventID: id, UploadID: "upload-1"}, Attempts: 1}
+		if err := outbox.SaveDeadLetter(ctx, letter); err != nil {
+			t.Fatalf("save dead letter %s: %v", id, err)
+		}
+	}
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	var calls atomic.Int32
+	handler := handlerFunc(func(ctx context.Context, event entity.FailedTxEvent) error {
+		calls.Add(1)
+		switch event.EventID {
+		case "evt-1":
+			close(entered)
+			<-release
+			return nil
+		case "evt-3":
+			return errors.New("still down")
+		}
+		return nil
+	})
+
+	dedup := NewMemoryDeduper(0, 0)
+	if err := dedup.MarkHandled(ctx, "evt-2"); err != nil {
+		t.Fatalf("mark handled: %v", err)
+	}
+	consumer := NewReconciliationConsumer(NewBus(10), handler, outbox, ConsumerConfig{
+		Workers: 1,
+		Dedup:   dedup,
+		Clock:   func() time.Time { return time.Unix(42, 0) },
+	})
+
+	done := make(chan bool, 1)
+	go func() {
+		_, replayed, err := consumer.ReplayDeadLetter(ctx, "evt-1")
+		if err != nil {
+			t.Errorf("first replay: %v", err)
+		}
+		done <- replayed
+	}()
+	<-entered
+
+	// While the first replay is handling it, the event waits in the outbox
+	// and a second replay finds nothing to claim.
+	if pending, _ := outbox.PendingOutbox(ctx); len(pending) != 1 || pending[0].EventID != "evt-1" {
+		t.Fatalf("expected the event in the outbox while it is replayed, got %+v", pending)
+	}
+	if _, _, err := consumer.ReplayDeadLetter(ctx, "evt-1"); !errors.Is(err, pkgerror.ErrNotFound) {
+		t.Fatalf("expected a concurrent replay to find nothing, got %v", err)
+	}
+	close(release)
+	if replayed := <-done; !replayed {
+		t.Fatal("expected the first replay to succeed")
+	}
+	if pending, _ := outbox.PendingOutbox(ctx); len(pending) != 0 {
+		t.Fatalf("expected the replayed event to be acknowledged, got %+v", pending)
+	}
+
+	if _, replayed, err := consumer.ReplayDeadLetter(ctx, "evt-2"); err != nil || !replayed {
+		t.Fatalf("expected a handled event to be dropped, got %v, %v", replayed, err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("handler called %d times, want 1", got)
+	}
+
+	letter, replayed, err := consumer.ReplayDeadLetter(ctx, "evt-3")
+	if err != nil || replayed || letter.Attempts != 2 || letter.FailedAt != 42 {
+		t.Fatalf("expected the failed replay to be stamped by the clock, got %+v, %v, %v", letter, replayed, err)
+	}
+	letters, total, err := consumer.DeadLetters(ctx, 1, 10)
+	if err != nil || total != 1 || letters[0].Event.EventID != "evt-3" {
+		t.Fatalf("expected only the failed dead letter to remain, got %+v (total %d), %v", letters, total, err)
+	}
+	if pending, _ := outbox.PendingOutbox(ctx); len(pending) != 0 {
+		t.Fatalf("expected the failed event back among the dead letters only, got %+v", pending)
+	}
+}
+
+func TestReconciliationConsumerRedeliversPendingOnStart(t *testing.T) {
+	outbox := store.NewInMemoryStore()
+	left := entity.FailedTxEvent{EventID: "evt-1", UploadID: "upload-1"}
+	if err := outbox.AppendOutbox(context.Background(), left); err != nil {
+		t.Fatalf("append outbox: %v", err)
+	}
+
+	handled := make(chan string, 1)
+	handler := handlerFunc(func(ctx context.Context, event entity.FailedTxEvent) error {
+		handled <- event.EventID
+		return nil
+	})
+
+	consumer := NewReconciliationConsumer(NewBus(10), handler, outbox, ConsumerConfig{Workers: 1})
+	consumer.Start()
+
+	select {
+	case id := <-handled:
+		if id != left.EventID {
+			t.Fatalf("unexpected handled event %s", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pending event was not redelivered")
+	}
+	if err := consumer.Stop(context.Background()); err != nil {
+		t.Fatalf("stop consumer: %v", err)
+	}
+
+	if pending, _ := outbox.PendingOutbox(context.Background()); len(pending) != 0 {
+		t.Fatalf("expected the redelivered event to be acknowledged, got %+v", pending)
+	}
+}
+
+func TestReconciliationConsumerPermanentAndRetryAfter(t *testing.T) {
+	outbox := store.NewInMemoryStore()
+	bus := NewBus(10)
+
+	var attempts sync.Map
+	handled := make(chan string, 10)
+	handler := handlerFunc(func(ctx context.Context, event entity.FailedTxEvent) error {
+		n, _ := attempts.LoadOrStore(event.EventID, new(atomic.Int32))
+		count := n.(*atomic.Int32).Add(1)
+		switch {
+		case event.EventID == "evt-rejected":
+			handled <- event.EventID
+			return Permanent(errors.New("rejected"))
+		case count == 1:
+			return RetryAfter(errors.New("busy"), time.Millisecond)
+		}
+		handled <- event.EventID
+		return nil
+	})
+
+	// The base backoff is far beyond the test timeout, so the second event is
+	// only handled in time if the Retry-After hint replaces it.
+	consumer := NewReconciliationConsumer(bus, handler, outbox, ConsumerConfig{
+		Workers: 2,
+		Retry:   RetryPolicy{MaxRetries: 3, BaseBackoff: time.Hour},
+	})
+	consumer.Start()
+
+	publisher := NewPublisher(outbox, bus)
+	for _, id := range []string{"evt-rejected", "evt-busy"} {
+		if err := publisher.PublishFailedTx(context.Background(), entity.FailedTxEvent{EventID: id, UploadID: "upload-1"}); err != nil {
+			t.Fatalf("publish %s: %v", id, err)
+		}
+	}
+
+	// The rejected event is not marked handled, so a redelivery from the
+	// outbox may reach the handler again; wait for the busy one.
+	for id := ""; id != "evt-busy"; {
+		select {
+		case id = <-handled:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for handler")
+		}
+	}
+	if err := consumer.Stop(context.Background()); err != nil {
+		t.Fatalf("stop consumer: %v", err)
+	}
+
+	letters, total, err := consumer.DeadLetters(context.Background(), 1, 10)
+	if err != nil || total != 1 || letters[0].Event.EventID != "evt-rejected" || letters[0].Attempts != 1 {
+		t.Fatalf("expected the rejected event to be dead-lettered after one attempt, got %+v (total %d), %v", letters, total, err)
+	}
+	if pending, _ := outbox.PendingOutbox(context.Background()); len(pending) != 0 {
+		t.Fatalf("expected an empty outbox, got %+v", pending)
+	}
+}
+
+func TestReconciliationConsumerStopCutsBackoffShort(t *testing.T) {
+	outbox := store.NewInMemoryStore()
+	bus := NewBus(10)
+
+	attempted := make(chan struct{}, 1)
+	handler := handlerFunc(func(ctx context.Context, event entity.FailedTxEvent) error {
+		attempted <- struct{}{}
+		return errors.New("reconciliation service unavailable")
+	})
+
+	consumer := NewReconciliationConsumer(bus, handler, outbox, ConsumerConfig{
+		Workers: 1,
+		Retry:   RetryPolicy{MaxRetries: 3, BaseBackoff: time.Hour, MaxBackoff: time.Hour},
+	})
+	consumer.Start()
+
+	if err := NewPublisher(outbox, bus).PublishFailedTx(context.Background(), entity.FailedTxEvent{EventID: "evt-1", UploadID: "upload-1"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	select {
+	case <-attempted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for handler")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := consumer.Stop(ctx); err != nil {
+		t.Fatalf("expected stop to interrupt the backoff, got %v", err)
+	}
+
+	if pending, _ := outbox.PendingOutbox(context.Background()); len(pending) != 1 {
+		t.Fatalf("expected the interrupted event to stay pending, got %+v", pending)
+	}
+	if _, total, _ := consumer.DeadLetters(context.Background(), 1, 10); total != 0 {
+		t.Fatalf("expected no dead letters, got %d", total)
+	}
+}
+
+func TestReconciliationConsumerGivesUpAfterMaxElapsed(t *testing.T) {
+	outbox := store.NewInMemoryStore()
+	bus := NewBus(10)
+
+	var attempts atomic.Int32
+	handler := handlerFunc(func(ctx context.Context, event entity.FailedTxEvent) error {
+		attempts.Add(1)
+		return errors.New("reconciliation service unavailable")
+	})
+
+	consumer := NewReconciliationConsumer(bus, handler, outbox, ConsumerConfig{
+		Workers: 1,
+		Retry:   RetryPolicy{MaxRetries: 100, BaseBackoff: 20 * time.Millisecond, MaxBackoff: 20 * time.Millisecond, MaxElapsed: 50 * time.Millisecond},
+	})
+	consumer.Start()
+
+	if err := NewPublisher(outbox, bus).PublishFailedTx(context.Background(), entity.FailedTxEvent{EventID: "evt-1", UploadID: "upload-1"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, total, _ := consumer.DeadLetters(context.Background(), 1, 10); total == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for dead letter")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := consumer.Stop(context.Background()); err != nil {
+		t.Fatalf("stop consumer: %v", err)
+	}
+
+	if n := attempts.Load(); n < 2 || n > 4 {
+		t.Fatalf("expected a few attempts within max elapsed, got %d", n)
+	}
+}
+
+func TestReconciliationConsumerOnlyDedupsSuccesses(t *testing.T) {
+	bus := NewBus(10)
+
+	var healthy atomic.Bool
+	var attempts atomic.Int32
+	results := make(chan error, 10)
+	handler := handlerFunc(func(ctx context.Context, event entity.FailedTxEvent) error {
+		attempts.Add(1)
+		var err error
+		if !healthy.Load() {
+			err = errors.New("reconciliation service unavailable")
+		}
+		results <- err
+		return err
+	})
+
+	consumer := NewReconciliationConsumer(bus, handler, nil, ConsumerConfig{Workers: 1})
+	consumer.Start()
+
+	event := entity.FailedTxEvent{EventID: "evt-1", UploadID: "upload-1"}
+	next := func() error {
+		t.Helper()
+		select {
+		case err := <-results:
+			return err
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for handler")
+			return nil
+		}
+	}
+
+	if err := Publish(context.Background(), bus, TopicTxFailed, event); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if err := next(); err == nil {
+		t.Fatal("expected the first delivery to fail")
+	}
+
+	healthy.Store(true)
+	for range 2 {
+		if err := Publish(context.Background(), bus, TopicTxFailed, event); err != nil {
+			t.Fatalf("publish again: %v", err)
+		}
+	}
+	if err := next(); err != nil {
+		t.Fatalf("expected the failed event to be handled again, got %v", err)
+	}
+
+	if err := consumer.Stop(context.Background()); err != nil {
+		t.Fatalf("stop consumer: %v", err)
+	}
+	if n := attempts.Load(); n != 2 {
+		t.Fatalf("expected the handled event to be skipped afterwards, got %d attempts", n)
+	}
+}
+
+func TestReconciliationConsumerPartitionedKeepsKeyOrder(t *testing.T) {
+	bus := NewBus(10)
+
+	// Pick two counterparties that hash to different lanes.
+	keyA, keyB := "ALICE", ""
+	for _, candidate := range []string{"BOB", "CAROL", "DAVE", "ERIN", "FRANK"} {
+		if lane(candidate, 2) != lane(keyA, 2) {
+			keyB = candidate
+			break
+		}
+	}
+	if keyB == "" {
+		t.Fatal("no counterparty on another lane")
+	}
+
+	var mu sync.Mutex
+	var order []string
+	var failedOnce atomic.Bool
+	done := make(chan struct{})
+	handler := handlerFunc(func(ctx context.Context, event entity.FailedTxEvent) error {
+		if event.EventID == "a-1" && !failedOnce.Swap(true) {
+			return RetryAfter(errors.New("busy"), 50*time.Millisecond)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, event.EventID)
+		if len(order) == 4 {
+			close(done)
+		}
+		return nil
+	})
+
+	consumer := NewReconciliationConsumer(bus, handler, nil, ConsumerConfig{
+		Workers:     2,
+		Retry:       RetryPolicy{MaxRetries: 1},
+		PartitionBy: PartitionByCounterparty,
+	})
+	consumer.Start()
+
+	events := []entity.FailedTxEvent{
+		{EventID: "a-1", UploadID: "upload-1", Tx: entity.Transaction{Counterparty: keyA}},
+		{EventID: "a-2", UploadID: "upload-2", Tx: entity.Transaction{Counterparty: keyA}},
+		{EventID: "b-1", UploadID: "upload-1", Tx: entity.Transaction{Counterparty: keyB}},
+		{EventID: "a-3", UploadID: "upload-1", Tx: entity.Transaction{Counterparty: keyA}},
+	}
+	for _, event := range events {
+		if err := Publish(context.Background(), bus, TopicTxFailed, event); err != nil {
+			t.Fatalf("publish %s: %v", event.EventID, err)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for handler")
+	}
+	if err := consumer.Stop(context.Background()); err != nil {
+		t.Fatalf("stop consumer: %v", err)
+	}
+
+	// b-1 is not held up by the retry of a-1, while a-2 and a-3 wait for it.
+	if want := []string{"b-1", "a-1", "a-2", "a-3"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("expected %v, got %v", want, order)
+	}
+}
+
+func TestReconciliationConsumerHandlerContextCarriesEventIDs(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	bus := NewBus(10)
+	got := make(chan context.Context, 1)
+	handler := handlerFunc(func(ctx context.Context, event entity.FailedTxEvent) error {
+		got <- ctx
+		return nil
+	})
+
+	consumer := NewReconciliationConsumer(bus, handler, nil, ConsumerConfig{Workers: 1})
+	consumer.Start()
+
+	event := entity.FailedTxEvent{EventID: "evt-1", UploadID: "upload-1", CorrelationID: "cid-upload", TraceParent: tp}
+	if err := Publish(context.Background(), bus, TopicTxFailed, event); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	select {
+	case ctx := <-got:
+		if cid, _ := pkglog.LookupCorrelationID(ctx); cid != "cid-upload" || pkglog.GetTraceParent(ctx) != tp {
+			t.Fatalf("expected the handler context to carry the event ids, got %q and %q", cid, pkglog.GetTraceParent(ctx))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for handler")
+	}
+	if err := consumer.Stop(context.Background()); err != nil {
+		t.Fatalf("stop consumer: %v", err)
+	}
+}
+
+func TestReconciliationConsumerTracesAttempts(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	bus := NewBus(10)
+	handled := make(chan struct{})
+	var calls atomic.Int32
+	handler := handlerFunc(func(ctx context.Context, event entity.FailedTxEvent) error {
+		if calls.Add(1) == 1 {
+			return RetryAfter(errors.New("busy"), time.Millisecond)
+		}
+		close(handled)
+		return nil
+	})
+
+	consumer := NewReconciliationConsumer(bus, handler, nil, ConsumerConfig{Workers: 1, Retry: RetryPolicy{MaxRetries: 1}})
+	consumer.Start()
+
+	event := entity.FailedTxEvent{EventID: "evt-1", UploadID: "upload-1", TraceParent: tp}
+	if err := Publish(context.Background(), bus, TopicTxFailed, event); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	select {
+	case <-handled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for handler")
+	}
+	if err := consumer.Stop(context.Background()); err != nil {
+		t.Fatalf("stop consumer: %v", err)
+	}
+
+	var process tracetest.SpanStub
+	var attempts []tracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		switch span.Name {
+		case "process tx.failed":
+			process = span
+		case "reconcile":
+			attempts = append(attempts, span)
+		}
+	}
+
+	if process.SpanKind != trace.SpanKindConsumer || process.Parent.SpanID().String() != "00f067aa0ba902b7" ||
+		process.SpanContext.TraceID().String() != pkglog.TraceID(tp) {
+		t.Fatalf("expected a consumer span continuing the event traceparent, got %+v", process)
+	}
+	attrs := attribute.NewSet(process.Attributes...)
+	if v, _ := attrs.Value("event.outcome"); v.AsString() != "handled" {
+		t.Fatalf("expected outcome handled, got %q", v.AsString())
+	}
+	if v, _ := attrs.Value("retry.attempts"); v.AsInt64() != 2 {
+		t.Fatalf("expected 2 attempts, got %d", v.AsInt64())
+	}
+
+	if len(attempts) != 2 {
+		t.Fatalf("expected a span per attempt, got %d", len(attempts))
+	}
+	for i, span := range attempts {
+		if span.Parent.SpanID() != process.SpanContext.SpanID() {
+			t.Fatalf("expected attempt %d under the consumer span", i+1)
+		}
+		spanAttrs := attribute.NewSet(span.Attributes...)
+		if v, _ := spanAttrs.Value("retry.attempt"); v.AsInt64() != int64(i+1) {
+			t.Fatalf("expected retry.attempt %d, got %d", i+1, v.AsInt64())
+		}
+	}
+	if attempts[0].Status.Code != codes.Error || attempts[1].Status.Code == codes.Error {
+		t.Fatalf("expected only the first attempt to fail, got %v and %v", attempts[0].Status.Code, attempts[1].Status.Code)
+	}
+}
+
+func TestReconciliationConsumerMetrics(t *testing.T) {
+	bus := NewBus(10)
+	metrics := NewMetrics(nil)
+
+	var calls sync.Map
+	done := make(chan string, 2)
+	handler := handlerFunc(func(ctx context.Context, event entity.FailedTxEvent) error {
+		n, _ := calls.LoadOrStore(event.EventID, new(atomic.Int32))
+		count := n.(*atomic.Int32).Add(1)
+		switch {
+		case event.EventID == "evt-dead":
+			done <- event.EventID
+			return Permanent(errors.New("rejected"))
+		case count == 1:
+			return RetryAfter(errors.New("busy"), time.Millisecond)
+		}
+		done <- event.EventID
+		return nil
+	})
+
+	consumer := NewReconciliationConsumer(bus, handler, nil, ConsumerConfig{
+		Workers: 2,
+		Retry:   RetryPolicy{MaxRetries: 3},
+		Metrics: metrics,
+	})
+	consumer.Start()
+
+	for _, id := range []string{"evt-dead", "evt-ok"} {
+		if err := Publish(context.Background(), bus, TopicTxFailed, entity.FailedTxEvent{EventID: id}); err != nil {
+			t.Fatalf("publish %s: %v", id, err)
+		}
+	}
+	for range 2 {
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for handler")
+		}
+	}
+	if err := consumer.Stop(context.Background()); err != nil {
+		t.Fatalf("stop consumer: %v", err)
+	}
+
+	if got := testutil.ToFloat64(metrics.events.WithLabelValues(outcomeHandled)); got != 1 {
+		t.Fatalf("expected 1 handled event, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.deadLetters); got != 1 {
+		t.Fatalf("expected 1 dead letter, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.retries); got != 1 {
+		t.Fatalf("expected 1 retry, got %v", got)
+	}
+}
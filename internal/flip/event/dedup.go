@@ -0,0 +1,132 @@
+package event
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Deduper remembers the events a consumer handled, so a redelivered event is
+// not reconciled twice. Only successes are marked: an event that failed,
+// including one that became a dead letter, can be delivered again.
+type Deduper interface {
+	Seen(ctx context.Context, eventID string) (bool, error)
+	MarkHandled(ctx context.Context, eventID string) error
+}
+
+const (
+	defaultDedupSize = 100_000
+	defaultDedupTTL  = 24 * time.Hour
+)
+
+// MemoryDeduper keeps up to size event IDs for ttl each, evicting the least
+// recently used ID when full.
+type MemoryDeduper struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	order *list.List // front is the most recently used
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+type dedupItem struct {
+	eventID   string
+	expiresAt time.Time
+}
+
+// NewMemoryDeduper defaults to 100,000 IDs kept for 24h.
+func NewMemoryDeduper(size int, ttl time.Duration) *MemoryDeduper {
+	if size < 1 {
+		size = defaultDedupSize
+	}
+	if ttl <= 0 {
+		ttl = defaultDedupTTL
+	}
+
+	return &MemoryDeduper{
+		size:  size,
+		ttl:   ttl,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+		now:   time.Now,
+	}
+}
+
+func (d *MemoryDeduper) Seen(ctx context.Context, eventID string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	elem, ok := d.items[eventID]
+	if !ok {
+		return false, nil
+	}
+
+	if !d.now().Before(itemOf(elem).expiresAt) {
+		d.order.Remove(elem)
+		delete(d.items, eventID)
+		return false, nil
+	}
+
+	d.order.MoveToFront(elem)
+	return true, nil
+}
+
+func (d *MemoryDeduper) MarkHandled(ctx context.Context, eventID string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	expiresAt := d.now().Add(d.ttl)
+	if elem, ok := d.items[eventID]; ok {
+		itemOf(elem).expiresAt = expiresAt
+		d.order.MoveToFront(elem)
+		return nil
+	}
+
+	d.items[eventID] = d.order.PushFront(&dedupItem{eventID: eventID, expiresAt: expiresAt})
+	for d.order.Len() > d.size {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.items, itemOf(oldest).eventID)
+	}
+	return nil
+}
+
+// itemOf returns the item of an element of MemoryDeduper.order, which only
+// holds *dedupItem.
+func itemOf(elem *list.Element) *dedupItem {
+	item, _ := elem.Value.(*dedupItem)
+	return item
+}
+
+// HandledStore persists handled event IDs, e.g. the file store, so
+// duplicates are recognized after a restart.
+type HandledStore interface {
+	MarkHandled(ctx context.Context, eventID string, expiresAt int64) error
+	IsHandled(ctx context.Context, eventID string, now int64) (bool, error)
+}
+
+// StoreDeduper keeps handled event IDs in a HandledStore for ttl.
+type StoreDeduper struct {
+	store HandledStore
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+// NewStoreDeduper defaults ttl to 24h.
+func NewStoreDeduper(store HandledStore, ttl time.Duration) *StoreDeduper {
+	if ttl <= 0 {
+		ttl = defaultDedupTTL
+	}
+
+	return &StoreDeduper{store: store, ttl: ttl, now: time.Now}
+}
+
+func (d *StoreDeduper) Seen(ctx context.Context, eventID string) (bool, error) {
+	return d.store.IsHandled(ctx, eventID, d.now().Unix())
+}
+
+func (d *StoreDeduper) MarkHandled(ctx context.Context, eventID string) error {
+	return d.store.MarkHandled(ctx, eventID, d.now().Add(d.ttl).Unix())
+}
@@ -0,0 +1,77 @@
+package event
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shandysiswandi/goflip/internal/flip/store"
+)
+
+func TestMemoryDeduperEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	d := NewMemoryDeduper(2, time.Hour)
+
+	for _, id := range []string{"evt-1", "evt-2"} {
+		if err := d.MarkHandled(ctx, id); err != nil {
+			t.Fatalf("mark %s: %v", id, err)
+		}
+	}
+	// Using evt-1 makes evt-2 the oldest.
+	if seen, _ := d.Seen(ctx, "evt-1"); !seen {
+		t.Fatal("expected evt-1 to be seen")
+	}
+	if err := d.MarkHandled(ctx, "evt-3"); err != nil {
+		t.Fatalf("mark evt-3: %v", err)
+	}
+
+	for id, want := range map[string]bool{"evt-1": true, "evt-2": false, "evt-3": true} {
+		if seen, _ := d.Seen(ctx, id); seen != want {
+			t.Fatalf("Seen(%s) = %v, want %v", id, seen, want)
+		}
+	}
+}
+
+func TestMemoryDeduperExpires(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+	d := NewMemoryDeduper(10, time.Minute)
+	d.now = func() time.Time { return now }
+
+	if err := d.MarkHandled(ctx, "evt-1"); err != nil {
+		t.Fatalf("mark: %v", err)
+	}
+	if seen, _ := d.Seen(ctx, "evt-1"); !seen {
+		t.Fatal("expected evt-1 to be seen within the ttl")
+	}
+
+	now = now.Add(time.Minute)
+	if seen, _ := d.Seen(ctx, "evt-1"); seen {
+		t.Fatal("expected evt-1 to expire after the ttl")
+	}
+	if len(d.items) != 0 || d.order.Len() != 0 {
+		t.Fatalf("expected the expired id to be dropped, got %d items", len(d.items))
+	}
+}
+
+func TestStoreDeduperUsesStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	d := NewStoreDeduper(store.NewInMemoryStore(), time.Minute)
+	d.now = func() time.Time { return now }
+
+	if seen, err := d.Seen(ctx, "evt-1"); err != nil || seen {
+		t.Fatalf("expected an unknown event, got %v, %v", seen, err)
+	}
+	if err := d.MarkHandled(ctx, "evt-1"); err != nil {
+		t.Fatalf("mark: %v", err)
+	}
+	if seen, err := d.Seen(ctx, "evt-1"); err != nil || !seen {
+		t.Fatalf("expected a handled event, got %v, %v", seen, err)
+	}
+
+	now = now.Add(time.Minute)
+	if seen, _ := d.Seen(ctx, "evt-1"); seen {
+		t.Fatal("expected the handled event to expire")
+	}
+}
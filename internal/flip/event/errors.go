@@ -0,0 +1,57 @@
+package event
+
+import (
+	"errors"
+	"time"
+)
+
+// permanentError marks a handler error that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err so the consumer dead-letters the event right away
+// instead of retrying it.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err, or an error it wraps, was marked with
+// Permanent.
+func IsPermanent(err error) bool {
+	var perr *permanentError
+	return errors.As(err, &perr)
+}
+
+// retryAfterError carries the delay a handler asks for before the next try.
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryAfterError) Error() string { return e.err.Error() }
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// RetryAfter asks the consumer to wait delay before retrying, instead of its
+// own backoff. It is the handler side of an HTTP Retry-After header.
+func RetryAfter(err error, delay time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryAfterError{err: err, delay: delay}
+}
+
+// retryAfterHint returns the delay requested with RetryAfter, if any.
+func retryAfterHint(err error) (time.Duration, bool) {
+	var rerr *retryAfterError
+	if !errors.As(err, &rerr) || rerr.delay <= 0 {
+		return 0, false
+	}
+	return rerr.delay, true
+}
@@ -0,0 +1,98 @@
+package event
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Outcomes of an event handled by ReconciliationConsumer, as recorded on its
+// span and in Metrics.
+const (
+	outcomeHandled    = "handled"
+	outcomeDuplicate  = "duplicate"
+	outcomeDeadLetter = "dead_letter"
+	outcomeShutdown   = "shutdown"
+)
+
+// Metrics counts what the reconciliation consumer does. A nil *Metrics
+// records nothing.
+type Metrics struct {
+	events      *prometheus.CounterVec
+	retries     prometheus.Counter
+	deadLetters prometheus.Counter
+}
+
+// NewMetrics registers the consumer metrics on reg, unless reg is nil.
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flip_reconciler_events_total",
+			Help: "Failed-transaction events processed by the reconciliation consumer, by outcome.",
+		}, []string{"outcome"}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "flip_reconciler_retries_total",
+			Help: "Handler attempts retried after a failure.",
+		}),
+		deadLetters: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "flip_reconciler_dead_letters_total",
+			Help: "Events that became dead letters.",
+		}),
+	}
+	if reg != nil {
+		reg.MustRegister(m.events, m.retries, m.deadLetters)
+	}
+	return m
+}
+
+func (m *Metrics) event(outcome string) {
+	if m == nil {
+		return
+	}
+	m.events.WithLabelValues(outcome).Inc()
+	if outcome == outcomeDeadLetter {
+		m.deadLetters.Inc()
+	}
+}
+
+func (m *Metrics) retry() {
+	if m != nil {
+		m.retries.Inc()
+	}
+}
+
+// RegisterMetrics exposes the depth, capacity and drops of every subscriber
+// group on reg.
+func (b *Bus) RegisterMetrics(reg prometheus.Registerer) error {
+	return reg.Register(busCollector{bus: b})
+}
+
+//nolint:gochecknoglobals // metric descriptors of busCollector
+var (
+	busDepthDesc = prometheus.NewDesc("flip_bus_queue_depth",
+		"Events buffered for a subscriber group.", []string{"topic", "group"}, nil)
+	busCapacityDesc = prometheus.NewDesc("flip_bus_queue_capacity",
+		"Buffer size of a subscriber group.", []string{"topic", "group"}, nil)
+	busDroppedDesc = prometheus.NewDesc("flip_bus_dropped_total",
+		"Events a drop_oldest subscriber group discarded.", []string{"topic", "group"}, nil)
+)
+
+type busCollector struct {
+	bus *Bus
+}
+
+func (c busCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- busDepthDesc
+	ch <- busCapacityDesc
+	ch <- busDroppedDesc
+}
+
+func (c busCollector) Collect(ch chan<- prometheus.Metric) {
+	c.bus.mu.RLock()
+	defer c.bus.mu.RUnlock()
+
+	for topic, groups := range c.bus.topics {
+		for group, q := range groups {
+			depth, capacity, dropped := q.stats()
+			ch <- prometheus.MustNewConstMetric(busDepthDesc, prometheus.GaugeValue, float64(depth), topic, group)
+			ch <- prometheus.MustNewConstMetric(busCapacityDesc, prometheus.GaugeValue, float64(capacity), topic, group)
+			ch <- prometheus.MustNewConstMetric(busDroppedDesc, prometheus.CounterValue, float64(dropped), topic, group)
+		}
+	}
+}
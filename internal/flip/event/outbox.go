@@ -0,0 +1,125 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+)
+
+// Outbox persists failed-transaction events from publishing until they are
+// handled, and keeps the ones the consumer gave up on as dead letters.
+type Outbox interface {
+	AppendOutbox(ctx context.Context, event entity.FailedTxEvent) error
+	AckOutbox(ctx context.Context, eventID string) error
+	PendingOutbox(ctx context.Context) ([]entity.FailedTxEvent, error)
+	SaveDeadLetter(ctx context.Context, letter entity.DeadLetter) error
+	ListDeadLetters(ctx context.Context, page, pageSize int) ([]entity.DeadLetter, int, error)
+	GetDeadLetter(ctx context.Context, eventID string) (entity.DeadLetter, error)
+	DeleteDeadLetter(ctx context.Context, eventID string) error
+}
+
+// Publisher publishes the lifecycle events of uploads on a Bus. Failed
+// transactions are written to the outbox first, so events still buffered
+// when the process stops are delivered again by the next
+// ReconciliationConsumer.Start.
+type Publisher struct {
+	outbox Outbox
+	bus    *Bus
+}
+
+// NewPublisher publishes failed transactions straight to bus when outbox is
+// nil.
+func NewPublisher(outbox Outbox, bus *Bus) *Publisher {
+	return &Publisher{outbox: outbox, bus: bus}
+}
+
+// PublishFailedTx returns bus errors too, but once the event is persisted it
+// is not lost: a full or closed bus leaves it in the outbox for the next
+// start.
+func (p *Publisher) PublishFailedTx(ctx context.Context, event entity.FailedTxEvent) error {
+	if p.outbox != nil {
+		if err := p.outbox.AppendOutbox(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	return Publish(ctx, p.bus, TopicTxFailed, event)
+}
+
+func (p *Publisher) PublishPendingTx(ctx context.Context, event entity.PendingTxEvent) error {
+	return Publish(ctx, p.bus, TopicTxPending, event)
+}
+
+func (p *Publisher) PublishUploadStarted(ctx context.Context, event entity.UploadStartedEvent) error {
+	return Publish(ctx, p.bus, TopicUploadStarted, event)
+}
+
+func (p *Publisher) PublishUploadCompleted(ctx context.Context, event entity.UploadCompletedEvent) error {
+	return Publish(ctx, p.bus, TopicUploadCompleted, event)
+}
+
+// ErrNoOutbox is returned by dead letter operations of a consumer without an
+// outbox.
+var ErrNoOutbox = errors.New("event outbox is not configured")
+
+func (c *ReconciliationConsumer) DeadLetters(ctx context.Context, page, pageSize int) ([]entity.DeadLetter, int, error) {
+	if c.outbox == nil {
+		return nil, 0, ErrNoOutbox
+	}
+
+	return c.outbox.ListDeadLetters(ctx, page, pageSize)
+}
+
+// ReplayDeadLetter hands a dead letter to the handler once. The dead letter is
+// claimed by removing it before the handler runs, so of concurrent replays of
+// one event only one handles it and the others get the not-found error of the
+// outbox. While it is handled the event waits in the outbox again, so a crash
+// delivers it on the next start. An event already handled is dropped without
+// calling the handler. On success replayed is true. Otherwise the dead letter
+// is saved again with the attempt counted and the new error, and returned.
+// err is only set when the dead letter cannot be read or updated.
+func (c *ReconciliationConsumer) ReplayDeadLetter(ctx context.Context, eventID string) (letter entity.DeadLetter, replayed bool, err error) {
+	if c.outbox == nil {
+		return entity.DeadLetter{}, false, ErrNoOutbox
+	}
+
+	letter, err = c.outbox.GetDeadLetter(ctx, eventID)
+	if err != nil {
+		return entity.DeadLetter{}, false, err
+	}
+
+	if c.handler == nil {
+		return letter, false, errors.New("no reconciliation handler")
+	}
+
+	if err := c.outbox.DeleteDeadLetter(ctx, eventID); err != nil {
+		return entity.DeadLetter{}, false, err
+	}
+
+	seen, err := c.dedup.Seen(ctx, eventID)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to check handled events", "event_id", eventID, "upload_id", letter.Event.UploadID, "error", err)
+	}
+	if seen {
+		slog.InfoContext(ctx, "dropped dead letter of a handled event", "event_id", eventID, "upload_id", letter.Event.UploadID)
+		return letter, true, nil
+	}
+
+	if err := c.outbox.AppendOutbox(ctx, letter.Event); err != nil {
+		return letter, false, errors.Join(err, c.outbox.SaveDeadLetter(ctx, letter))
+	}
+
+	if handleErr := c.handler.Handle(ctx, letter.Event); handleErr != nil {
+		letter.Attempts++
+		letter.Err = handleErr.Error()
+		letter.FailedAt = c.now().Unix()
+		return letter, false, c.outbox.SaveDeadLetter(ctx, letter)
+	}
+
+	slog.InfoContext(ctx, "replayed dead letter", "event_id", eventID, "upload_id", letter.Event.UploadID)
+	c.markHandled(ctx, letter.Event)
+	c.ack(ctx, letter.Event)
+	return letter, true, nil
+}
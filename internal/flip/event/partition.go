@@ -0,0 +1,67 @@
+package event
+
+import (
+	"hash/fnv"
+
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+)
+
+// PartitionKey selects the field that keeps failed-transaction events in
+// order. Events with the same key are handled one after another, retries
+// included, by the same worker lane; lanes run in parallel.
+type PartitionKey string
+
+const (
+	// PartitionNone lets all workers compete for events, in no order.
+	PartitionNone PartitionKey = ""
+	// PartitionByUpload orders the events of each upload.
+	PartitionByUpload PartitionKey = "upload_id"
+	// PartitionByCounterparty orders the events of each counterparty
+	// across uploads.
+	PartitionByCounterparty PartitionKey = "counterparty"
+)
+
+// laneBuffer is how many events wait for a busy lane before the dispatcher
+// stops reading from the bus.
+const laneBuffer = 64
+
+func (k PartitionKey) of(event entity.FailedTxEvent) string {
+	switch k {
+	case PartitionByCounterparty:
+		return event.Tx.Counterparty
+	case PartitionByUpload:
+		return event.UploadID
+	case PartitionNone:
+	}
+	return ""
+}
+
+// lane returns the index of the lane for key among n lanes.
+func lane(key string, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n)) //nolint:gosec // n is a small positive worker count
+}
+
+// dispatch routes events from the subscription to their lanes and closes
+// the lanes once the subscription ends.
+func (c *ReconciliationConsumer) dispatch(lanes []chan entity.FailedTxEvent) {
+	defer c.wg.Done()
+	defer func() {
+		for _, ch := range lanes {
+			close(ch)
+		}
+	}()
+
+	for event := range c.sub.Events() {
+		lanes[lane(c.partitionBy.of(event), len(lanes))] <- event
+	}
+}
+
+func (c *ReconciliationConsumer) runLane(events <-chan entity.FailedTxEvent) {
+	defer c.wg.Done()
+
+	for event := range events {
+		c.processEvent(event)
+	}
+}
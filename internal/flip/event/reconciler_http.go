@@ -0,0 +1,168 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkglog"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgtrace"
+)
+
+// HeaderIdempotencyKey carries the event ID, so the reconciliation service can
+// ignore a redelivered event.
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+type HTTPReconcilerConfig struct {
+	// URL receives a POST per failed transaction.
+	URL string
+
+	// Token is sent as a bearer token when set.
+	Token string
+
+	// Timeout bounds a single request. Defaults to 10s.
+	Timeout time.Duration
+}
+
+// HTTPReconciler is a Handler that posts every event to a reconciliation
+// service, forwarding the correlation ID and traceparent of the context. 2xx
+// responses succeed. Other 4xx responses are permanent, while network errors,
+// 408, 429 and 5xx are retried, after the Retry-After delay if the service
+// sends one.
+type HTTPReconciler struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewHTTPReconciler uses a client with cfg.Timeout that does not follow
+// redirects when client is nil.
+func NewHTTPReconciler(cfg HTTPReconcilerConfig, client *http.Client) (*HTTPReconciler, error) {
+	if !strings.HasPrefix(cfg.URL, "http://") && !strings.HasPrefix(cfg.URL, "https://") {
+		return nil, fmt.Errorf("reconciler url must be an absolute http or https URL, got %q", cfg.URL)
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	if client == nil {
+		client = &http.Client{
+			Timeout: cfg.Timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+
+	return &HTTPReconciler{url: cfg.URL, token: cfg.Token, client: client}, nil
+}
+
+func (r *HTTPReconciler) Handle(ctx context.Context, event entity.FailedTxEvent) error {
+	if event.EventID == "" {
+		return Permanent(errors.New("missing event id"))
+	}
+
+	body, err := json.Marshal(newReconcilePayload(event))
+	if err != nil {
+		return Permanent(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "goflip-reconciler")
+	req.Header.Set(HeaderIdempotencyKey, event.EventID)
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	if cid, ok := pkglog.LookupCorrelationID(ctx); ok {
+		req.Header.Set(pkglog.HeaderCorrelationID, cid)
+	}
+	if tp := pkgtrace.TraceParent(ctx); tp != "" {
+		req.Header.Set(pkglog.HeaderTraceParent, tp)
+	}
+
+	//nolint:gosec // the URL comes from operator configuration
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	status := resp.StatusCode
+	switch {
+	case status >= 200 && status <= 299:
+		return nil
+	case status == http.StatusRequestTimeout, status == http.StatusTooManyRequests, status >= http.StatusInternalServerError:
+		err := fmt.Errorf("reconciliation service returned %d", status)
+		if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return RetryAfter(err, delay)
+		}
+		return err
+	default:
+		return Permanent(fmt.Errorf("reconciliation service rejected the event with %d", status))
+	}
+}
+
+// parseRetryAfter reads delay-seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, seconds > 0
+	}
+
+	at, err := http.ParseTime(value)
+	if err != nil || !at.After(now) {
+		return 0, false
+	}
+	return at.Sub(now), true
+}
+
+type reconcilePayload struct {
+	EventID     string               `json:"event_id"`
+	UploadID    string               `json:"upload_id"`
+	Transaction reconcileTransaction `json:"transaction"`
+}
+
+type reconcileTransaction struct {
+	Timestamp    int64           `json:"timestamp"`
+	Counterparty string          `json:"counterparty"`
+	Type         entity.TxType   `json:"type"`
+	Amount       string          `json:"amount"`
+	Currency     string          `json:"currency"`
+	Status       entity.TxStatus `json:"status"`
+	Description  string          `json:"description"`
+}
+
+func newReconcilePayload(event entity.FailedTxEvent) reconcilePayload {
+	tx := event.Tx
+	return reconcilePayload{
+		EventID:  event.EventID,
+		UploadID: event.UploadID,
+		Transaction: reconcileTransaction{
+			Timestamp:    tx.Timestamp,
+			Counterparty: tx.Counterparty,
+			Type:         tx.Type,
+			Amount:       tx.Amount.String(),
+			Currency:     tx.Currency,
+			Status:       tx.Status,
+			Description:  tx.Description,
+		},
+	}
+}
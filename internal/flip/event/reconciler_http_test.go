@@ -0,0 +1,118 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgdecimal"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkglog"
+)
+
+func TestHTTPReconcilerClassifiesResponses(t *testing.T) {
+	var status int
+	var retryAfter string
+	var got reconcilePayload
+	var gotHeader http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	rec, err := NewHTTPReconciler(HTTPReconcilerConfig{URL: srv.URL, Token: "secret"}, nil)
+	if err != nil {
+		t.Fatalf("new reconciler: %v", err)
+	}
+
+	event := entity.FailedTxEvent{
+		EventID:  "evt-1",
+		UploadID: "upload-1",
+		Tx: entity.Transaction{
+			Timestamp:    1674507883,
+			Counterparty: "JOHN DOE",
+			Type:         entity.TxTypeDebit,
+			Amount:       pkgdecimal.MustParse("250000.50"),
+			Currency:     "IDR",
+			Status:       entity.TxStatusFailed,
+			Description:  "restaurant",
+		},
+	}
+
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := pkglog.SetTraceParent(pkglog.SetCorrelationID(context.Background(), "cid-1"), tp)
+
+	status = http.StatusAccepted
+	if err := rec.Handle(ctx, event); err != nil {
+		t.Fatalf("expected 202 to succeed, got %v", err)
+	}
+	if got.EventID != "evt-1" || got.UploadID != "upload-1" || got.Transaction.Amount != "250000.5" || got.Transaction.Counterparty != "JOHN DOE" {
+		t.Fatalf("unexpected payload %+v", got)
+	}
+	if gotHeader.Get(HeaderIdempotencyKey) != "evt-1" || gotHeader.Get("Authorization") != "Bearer secret" ||
+		gotHeader.Get("X-Correlation-ID") != "cid-1" || gotHeader.Get("traceparent") != tp {
+		t.Fatalf("unexpected headers %v", gotHeader)
+	}
+
+	status = http.StatusUnprocessableEntity
+	if err := rec.Handle(context.Background(), event); err == nil || !IsPermanent(err) {
+		t.Fatalf("expected 422 to be permanent, got %v", err)
+	}
+
+	status, retryAfter = http.StatusTooManyRequests, "7"
+	err = rec.Handle(context.Background(), event)
+	if delay, ok := retryAfterHint(err); err == nil || IsPermanent(err) || !ok || delay != 7*time.Second {
+		t.Fatalf("expected 429 to be retried after 7s, got %v", err)
+	}
+
+	status, retryAfter = http.StatusServiceUnavailable, ""
+	err = rec.Handle(context.Background(), event)
+	if _, ok := retryAfterHint(err); err == nil || IsPermanent(err) || ok {
+		t.Fatalf("expected 503 to be retried with the default backoff, got %v", err)
+	}
+}
+
+func TestHTTPReconcilerTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	rec, err := NewHTTPReconciler(HTTPReconcilerConfig{URL: srv.URL, Timeout: 20 * time.Millisecond}, nil)
+	if err != nil {
+		t.Fatalf("new reconciler: %v", err)
+	}
+
+	err = rec.Handle(context.Background(), entity.FailedTxEvent{EventID: "evt-1"})
+	if err == nil || IsPermanent(err) {
+		t.Fatalf("expected a retryable timeout, got %v", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if d, ok := parseRetryAfter("120", now); !ok || d != 2*time.Minute {
+		t.Fatalf("expected 2m, got %v %v", d, ok)
+	}
+	if d, ok := parseRetryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now); !ok || d != 30*time.Second {
+		t.Fatalf("expected 30s, got %v %v", d, ok)
+	}
+	for _, value := range []string{"", "0", "-1", "soon", now.Add(-time.Minute).Format(http.TimeFormat)} {
+		if d, ok := parseRetryAfter(value, now); ok {
+			t.Fatalf("expected no delay for %q, got %v", value, d)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package event
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Jitter selects how RetryPolicy randomizes its backoff.
+type Jitter string
+
+const (
+	// JitterNone doubles the delay on every retry.
+	JitterNone Jitter = "none"
+	// JitterFull waits a random delay between zero and the doubled delay.
+	JitterFull Jitter = "full"
+	// JitterDecorrelated waits a random delay between BaseBackoff and three
+	// times the previous delay.
+	JitterDecorrelated Jitter = "decorrelated"
+)
+
+// RetryPolicy decides whether a failed event is tried again, and after how
+// long.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+
+	// BaseBackoff is the first delay. Defaults to 100ms.
+	BaseBackoff time.Duration
+
+	// MaxBackoff caps every delay, including RetryAfter hints. Defaults to
+	// a minute.
+	MaxBackoff time.Duration
+
+	// MaxElapsed gives up once the next retry would start this long after
+	// the first attempt. Zero means no limit.
+	MaxElapsed time.Duration
+
+	// Jitter defaults to JitterNone.
+	Jitter Jitter
+
+	// Retryable classifies errors beyond Permanent, e.g. to give up on
+	// validation errors of a handler. Nil retries every other error.
+	Retryable func(err error) bool
+
+	// random returns a value in [0, n); tests replace it.
+	random func(n int64) int64
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxRetries < 0 {
+		p.MaxRetries = 0
+	}
+	if p.BaseBackoff <= 0 {
+		p.BaseBackoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = time.Minute
+	}
+	p.MaxBackoff = max(p.MaxBackoff, p.BaseBackoff)
+	if p.MaxElapsed < 0 {
+		p.MaxElapsed = 0
+	}
+	if p.Jitter == "" {
+		p.Jitter = JitterNone
+	}
+	if p.random == nil {
+		//nolint:gosec // backoff jitter does not need a cryptographic source
+		p.random = rand.Int64N
+	}
+	return p
+}
+
+// retryable reports whether err is worth another attempt.
+func (p RetryPolicy) retryable(err error) bool {
+	if IsPermanent(err) {
+		return false
+	}
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+// backoff returns the delay before retry number attempt (starting at 1),
+// given the previous delay. A RetryAfter hint on err replaces it.
+func (p RetryPolicy) backoff(attempt int, prev time.Duration, err error) time.Duration {
+	if hint, ok := retryAfterHint(err); ok {
+		return min(hint, p.MaxBackoff)
+	}
+
+	exp := p.BaseBackoff
+	for i := 1; i < attempt && exp < p.MaxBackoff; i++ {
+		exp *= 2
+	}
+	exp = min(exp, p.MaxBackoff)
+
+	switch p.Jitter {
+	case JitterFull:
+		return p.between(0, exp)
+	case JitterDecorrelated:
+		upper := max(prev*3, p.BaseBackoff)
+		return min(p.between(p.BaseBackoff, upper), p.MaxBackoff)
+	default:
+		return exp
+	}
+}
+
+// between returns a random duration in [lo, hi].
+func (p RetryPolicy) between(lo, hi time.Duration) time.Duration {
+	if hi <= lo {
+		return lo
+	}
+	return lo + time.Duration(p.random(int64(hi-lo)+1))
+}
@@ -0,0 +1,88 @@
+package event
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	// upper returns the top of the range, so jittered delays are predictable.
+	upper := func(n int64) int64 { return n - 1 }
+
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		want   []time.Duration
+	}{
+		{
+			name:   "none doubles up to the cap",
+			policy: RetryPolicy{BaseBackoff: time.Second, MaxBackoff: 5 * time.Second},
+			want:   []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second},
+		},
+		{
+			name:   "full stays within the doubled delay",
+			policy: RetryPolicy{BaseBackoff: time.Second, MaxBackoff: 5 * time.Second, Jitter: JitterFull, random: upper},
+			want:   []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second},
+		},
+		{
+			name:   "decorrelated grows from the previous delay",
+			policy: RetryPolicy{BaseBackoff: time.Second, MaxBackoff: 20 * time.Second, Jitter: JitterDecorrelated, random: upper},
+			want:   []time.Duration{time.Second, 3 * time.Second, 9 * time.Second, 20 * time.Second, 20 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := tt.policy.withDefaults()
+			var delay time.Duration
+			for i, want := range tt.want {
+				delay = policy.backoff(i+1, delay, errors.New("temporary"))
+				if delay != want {
+					t.Fatalf("retry %d: expected %v, got %v", i+1, want, delay)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryPolicyJitterStaysInRange(t *testing.T) {
+	policy := RetryPolicy{BaseBackoff: 10 * time.Millisecond, MaxBackoff: time.Second, Jitter: JitterDecorrelated}.withDefaults()
+
+	var delay time.Duration
+	for attempt := 1; attempt <= 100; attempt++ {
+		next := policy.backoff(attempt, delay, errors.New("temporary"))
+		if next < policy.BaseBackoff || next > policy.MaxBackoff || next > max(3*delay, policy.BaseBackoff) {
+			t.Fatalf("retry %d after %v: %v is out of range", attempt, delay, next)
+		}
+		delay = next
+	}
+
+	policy.Jitter = JitterFull
+	for attempt := 1; attempt <= 100; attempt++ {
+		if next := policy.backoff(attempt, 0, errors.New("temporary")); next < 0 || next > policy.MaxBackoff {
+			t.Fatalf("retry %d: %v is out of range", attempt, next)
+		}
+	}
+}
+
+func TestRetryPolicyClassifiesErrors(t *testing.T) {
+	errInvalid := errors.New("invalid account")
+	policy := RetryPolicy{
+		MaxBackoff: time.Second,
+		Retryable:  func(err error) bool { return !errors.Is(err, errInvalid) },
+	}.withDefaults()
+
+	if !policy.retryable(errors.New("timeout")) {
+		t.Fatal("expected a plain error to be retried")
+	}
+	if policy.retryable(Permanent(errors.New("rejected"))) {
+		t.Fatal("expected a permanent error not to be retried")
+	}
+	if policy.retryable(errInvalid) {
+		t.Fatal("expected the classifier to stop retries")
+	}
+	if d := policy.backoff(1, 0, RetryAfter(errors.New("busy"), time.Hour)); d != time.Second {
+		t.Fatalf("expected the hint to be capped at max backoff, got %v", d)
+	}
+}
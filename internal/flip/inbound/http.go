@@ -9,16 +9,64 @@ import (
 )
 
 type uc interface {
-	Upload(ctx context.Context, r io.Reader) (usecase.UploadResult, error)
+	Upload(ctx context.Context, r io.Reader, opts usecase.UploadOptions) (usecase.UploadResult, error)
+	UploadParts(ctx context.Context, parts []usecase.UploadPart, opts usecase.UploadOptions) (usecase.UploadResult, error)
+	Statement(ctx context.Context, uploadID string) (usecase.StatementResult, error)
+	Statements(ctx context.Context, filter usecase.UploadFilter, page, pageSize int) (usecase.StatementsResult, error)
 	Balance(ctx context.Context, uploadID string) (usecase.BalanceResult, error)
 	Issues(ctx context.Context, uploadID string, filter usecase.IssueFilter, page, pageSize int) (usecase.IssuesResult, error)
+	Transactions(ctx context.Context, uploadID string, filter usecase.IssueFilter, page, pageSize int) (usecase.TransactionsResult, error)
+	ParseErrors(ctx context.Context, uploadID string, page, pageSize int) (usecase.ParseErrorsResult, error)
+	Delete(ctx context.Context, uploadID string) error
+	Cancel(ctx context.Context, uploadID string) (usecase.StatementResult, error)
+	SubscribeProgress(ctx context.Context, uploadID string) (*usecase.ProgressStream, error)
+	WebhookDeliveries(ctx context.Context, uploadID string, page, pageSize int) (usecase.WebhookDeliveriesResult, error)
+	DeadLetters(ctx context.Context, page, pageSize int) (usecase.DeadLettersResult, error)
+	ReplayDeadLetter(ctx context.Context, eventID string) (usecase.ReplayResult, error)
+	ReplayDeadLetters(ctx context.Context, eventIDs []string) (usecase.ReplayResult, error)
 }
 
-func RegisterHTTPEndpoint(r *pkgrouter.Router, uc uc) {
-	end := &HTTPEndpoint{uc: uc}
+// Default limits of Config.
+const (
+	DefaultMaxArchiveSize      int64 = 1 << 30
+	DefaultMaxDecompressedSize int64 = 1 << 30
+)
+
+type Config struct {
+	// MaxArchiveSize caps how much of a zip upload is spooled to disk.
+	// Defaults to DefaultMaxArchiveSize.
+	MaxArchiveSize int64
+
+	// MaxDecompressedSize fails an upload once a gzip or zstd body, or a zip
+	// entry, decompresses to more bytes. Defaults to
+	// DefaultMaxDecompressedSize.
+	MaxDecompressedSize int64
+}
 
-	r.POST("/statements", end.Statements)
+func RegisterHTTPEndpoint(r *pkgrouter.Router, uc uc, cfg Config) {
+	if cfg.MaxArchiveSize <= 0 {
+		cfg.MaxArchiveSize = DefaultMaxArchiveSize
+	}
+	if cfg.MaxDecompressedSize <= 0 {
+		cfg.MaxDecompressedSize = DefaultMaxDecompressedSize
+	}
+
+	end := &HTTPEndpoint{uc: uc, cfg: cfg}
+
+	r.POST("/statements", end.Statements, pkgrouter.SkipBodyLogging)
+	r.GET("/statements", end.ListStatements) // ?status=&created_from=&created_to=
+	r.GET("/statements/:upload_id", end.GetStatement)
+	r.DELETE("/statements/:upload_id", end.DeleteStatement)
+	r.POST("/statements/:upload_id/cancel", end.CancelStatement)
+	r.GET("/statements/:upload_id/errors", end.StatementErrors)
+	r.GET("/statements/:upload_id/events", end.StatementEvents, pkgrouter.SkipBodyLogging)
+	r.GET("/statements/:upload_id/webhooks", end.StatementWebhooks)
 
 	r.GET("/balance", end.Balance)                       // ?upload_id=
+	r.GET("/transactions", end.Transactions)             // ?upload_id=
 	r.GET("/transactions/issues", end.TransactionIssues) // ?upload_id=
+
+	r.GET("/admin/dead-letters", end.DeadLetters)
+	r.POST("/admin/dead-letters/replay", end.ReplayDeadLetters) // ?event_ids=
+	r.POST("/admin/dead-letters/replay/:event_id", end.ReplayDeadLetter)
 }
@@ -0,0 +1,92 @@
+package inbound
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgerror"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgrouter"
+)
+
+func (h *HTTPEndpoint) DeadLetters(ctx context.Context, r *http.Request) (any, error) {
+	query := r.URL.Query()
+	page, pageSize, err := parsePagination(query.Get("page"), query.Get("page_size"))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := h.uc.DeadLetters(ctx, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]DeadLetter, 0, len(result.DeadLetters))
+	for _, letter := range result.DeadLetters {
+		letters = append(letters, toDeadLetter(letter))
+	}
+
+	return DeadLettersResponse{
+		DeadLetters: letters,
+		page:        result.Page,
+		pageSize:    result.PageSize,
+		total:       result.Total,
+	}, nil
+}
+
+func (h *HTTPEndpoint) ReplayDeadLetter(ctx context.Context, r *http.Request) (any, error) {
+	eventID := strings.TrimSpace(pkgrouter.GetParam(ctx, "event_id"))
+	if eventID == "" {
+		return nil, pkgerror.NewInvalidInput(errors.New("event_id is required"))
+	}
+
+	result, err := h.uc.ReplayDeadLetter(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toReplayResponse(result.Replayed, result.Failed, result.NotFound), nil
+}
+
+// ReplayDeadLetters replays the dead letters listed in ?event_ids=, or all of
+// them.
+func (h *HTTPEndpoint) ReplayDeadLetters(ctx context.Context, r *http.Request) (any, error) {
+	var eventIDs []string
+	for _, id := range strings.Split(r.URL.Query().Get("event_ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			eventIDs = append(eventIDs, id)
+		}
+	}
+
+	result, err := h.uc.ReplayDeadLetters(ctx, eventIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return toReplayResponse(result.Replayed, result.Failed, result.NotFound), nil
+}
+
+func toDeadLetter(letter entity.DeadLetter) DeadLetter {
+	return DeadLetter{
+		EventID:     letter.Event.EventID,
+		UploadID:    letter.Event.UploadID,
+		Transaction: toHTTPTransaction(letter.Event.Tx),
+		Attempts:    letter.Attempts,
+		Error:       letter.Err,
+		FailedAt:    letter.FailedAt,
+	}
+}
+
+func toReplayResponse(replayed []string, failed []entity.DeadLetter, notFound []string) ReplayResponse {
+	resp := ReplayResponse{
+		Replayed: append([]string{}, replayed...),
+		Failed:   make([]DeadLetter, 0, len(failed)),
+		NotFound: notFound,
+	}
+	for _, letter := range failed {
+		resp.Failed = append(resp.Failed, toDeadLetter(letter))
+	}
+	return resp
+}
@@ -0,0 +1,89 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/flip/event"
+	"github.com/shandysiswandi/goflip/internal/flip/store"
+	"github.com/shandysiswandi/goflip/internal/flip/usecase"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgrouter"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkguid"
+)
+
+type failingHandler struct {
+	fail bool
+}
+
+func (h *failingHandler) Handle(ctx context.Context, e entity.FailedTxEvent) error {
+	if h.fail {
+		return errors.New("reconciliation service unavailable")
+	}
+	return nil
+}
+
+func TestDeadLetterEndpoints(t *testing.T) {
+	storage := store.NewInMemoryStore()
+	for i, id := range []string{"evt-1", "evt-2"} {
+		letter := entity.DeadLetter{Event: entity.FailedTxEvent{EventID: id, UploadID: "upload-1"}, Attempts: 3, Err: "boom", FailedAt: int64(i)}
+		if err := storage.SaveDeadLetter(context.Background(), letter); err != nil {
+			t.Fatalf("save dead letter: %v", err)
+		}
+	}
+
+	handler := &failingHandler{fail: true}
+	consumer := event.NewReconciliationConsumer(event.NewBus(1), handler, storage, event.ConsumerConfig{})
+	uc := usecase.New(usecase.Dependency{Store: storage, DeadLetters: consumer, ID: pkguid.NewUUID()})
+	router := pkgrouter.NewRouter(pkguid.NewUUID())
+	RegisterHTTPEndpoint(router, uc, Config{})
+
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/admin/dead-letters?page=1&page_size=10")
+	var list envelope[DeadLettersResponse]
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if rec.Code != http.StatusOK || len(list.Data.DeadLetters) != 2 || list.Data.DeadLetters[0].EventID != "evt-1" {
+		t.Fatalf("unexpected list: %d %+v", rec.Code, list.Data)
+	}
+
+	rec = do(http.MethodPost, "/admin/dead-letters/replay/evt-1")
+	var replay envelope[ReplayResponse]
+	if err := json.NewDecoder(rec.Body).Decode(&replay); err != nil {
+		t.Fatalf("decode replay: %v", err)
+	}
+	if rec.Code != http.StatusOK || len(replay.Data.Failed) != 1 || replay.Data.Failed[0].Attempts != 4 {
+		t.Fatalf("expected a failed replay, got %d %+v", rec.Code, replay.Data)
+	}
+
+	handler.fail = false
+	rec = do(http.MethodPost, "/admin/dead-letters/replay")
+	replay = envelope[ReplayResponse]{}
+	if err := json.NewDecoder(rec.Body).Decode(&replay); err != nil {
+		t.Fatalf("decode bulk replay: %v", err)
+	}
+	if rec.Code != http.StatusOK || len(replay.Data.Replayed) != 2 || len(replay.Data.Failed) != 0 {
+		t.Fatalf("expected both dead letters replayed, got %d %+v", rec.Code, replay.Data)
+	}
+
+	if rec := do(http.MethodPost, "/admin/dead-letters/replay/evt-1"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a replayed dead letter, got %d", rec.Code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := consumer.Stop(ctx); err != nil {
+		t.Fatalf("stop consumer: %v", err)
+	}
+}
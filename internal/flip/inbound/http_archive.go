@@ -0,0 +1,270 @@
+package inbound
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgerror"
+)
+
+// errTooLarge fails an upload whose archive or decompressed file exceeds the
+// configured limit.
+var errTooLarge = errors.New("upload is too large")
+
+type encoding int
+
+const (
+	encodingPlain encoding = iota
+	encodingGzip
+	encodingZstd
+	encodingZip
+)
+
+//nolint:gochecknoglobals // magic bytes of the supported formats
+var (
+	magicGzip = []byte{0x1f, 0x8b}
+	magicZstd = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicZip  = []byte("PK\x03\x04")
+)
+
+// uploadSource is the raw upload as received, before decoding.
+type uploadSource struct {
+	body            io.Reader
+	fileName        string
+	contentType     string
+	contentEncoding string
+}
+
+// uploadFile is one CSV to parse. Open is called at most once, in order.
+type uploadFile struct {
+	name string
+	open func() (io.ReadCloser, error)
+}
+
+// decodeError marks failures caused by a corrupt or unsupported payload.
+type decodeError struct {
+	err error
+}
+
+func (e *decodeError) Error() string {
+	return "decode upload: " + e.err.Error()
+}
+
+func (e *decodeError) Unwrap() error {
+	return e.err
+}
+
+// decodingReader tags read errors of a decompressor as decodeError.
+type decodingReader struct {
+	r     io.Reader
+	close func() error
+}
+
+func (d *decodingReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = &decodeError{err: err}
+	}
+	return n, err
+}
+
+func (d *decodingReader) Close() error {
+	if d.close == nil {
+		return nil
+	}
+	return d.close()
+}
+
+// limitedReader fails with errTooLarge once more than max bytes were read,
+// instead of silently truncating like io.LimitReader.
+type limitedReader struct {
+	r         io.Reader
+	max       int64
+	remaining int64
+}
+
+func newLimitedReader(r io.Reader, maxSize int64) *limitedReader {
+	return &limitedReader{r: r, max: maxSize, remaining: maxSize}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	// Reading one byte past the limit tells an exact fit from an overflow.
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return 0, fmt.Errorf("%w: decompressed file exceeds %d bytes", errTooLarge, l.max)
+	}
+	return n, err
+}
+
+// openUpload detects the encoding of src by Content-Encoding, Content-Type,
+// file name and finally magic bytes, and returns the CSV files it holds. Every
+// decompressed file fails once it exceeds cfg.MaxDecompressedSize. The
+// returned cleanup must be called once the files have been consumed.
+func openUpload(src uploadSource, cfg Config) ([]uploadFile, bool, func(), error) {
+	br := bufio.NewReader(src.body)
+
+	enc, err := detectEncoding(src, br)
+	if err != nil {
+		return nil, false, func() {}, err
+	}
+
+	name := src.fileName
+	switch enc {
+	case encodingGzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, false, func() {}, pkgerror.NewInvalidInput(&decodeError{err: err})
+		}
+		file := uploadFile{name: trimExt(name, ".gz", ".gzip"), open: func() (io.ReadCloser, error) {
+			return &decodingReader{r: newLimitedReader(zr, cfg.MaxDecompressedSize), close: zr.Close}, nil
+		}}
+		return []uploadFile{file}, false, func() {}, nil
+	case encodingZstd:
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, false, func() {}, pkgerror.NewInvalidInput(&decodeError{err: err})
+		}
+		file := uploadFile{name: trimExt(name, ".zst", ".zstd"), open: func() (io.ReadCloser, error) {
+			return &decodingReader{r: newLimitedReader(zr, cfg.MaxDecompressedSize)}, nil
+		}}
+		return []uploadFile{file}, false, zr.Close, nil
+	case encodingZip:
+		files, cleanup, err := openZip(br, cfg)
+		return files, true, cleanup, err
+	default:
+		file := uploadFile{name: name, open: func() (io.ReadCloser, error) {
+			return io.NopCloser(br), nil
+		}}
+		return []uploadFile{file}, false, func() {}, nil
+	}
+}
+
+func detectEncoding(src uploadSource, br *bufio.Reader) (encoding, error) {
+	switch strings.ToLower(strings.TrimSpace(src.contentEncoding)) {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		return encodingGzip, nil
+	case "zstd":
+		return encodingZstd, nil
+	default:
+		return encodingPlain, pkgerror.NewInvalidInput(fmt.Errorf("unsupported content encoding %q", src.contentEncoding))
+	}
+
+	switch strings.ToLower(src.contentType) {
+	case "application/gzip", "application/x-gzip":
+		return encodingGzip, nil
+	case "application/zstd":
+		return encodingZstd, nil
+	case "application/zip", "application/x-zip-compressed":
+		return encodingZip, nil
+	}
+
+	switch strings.ToLower(path.Ext(src.fileName)) {
+	case ".gz", ".gzip":
+		return encodingGzip, nil
+	case ".zst", ".zstd":
+		return encodingZstd, nil
+	case ".zip":
+		return encodingZip, nil
+	}
+
+	head, err := br.Peek(len(magicZstd))
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return encodingPlain, pkgerror.NewServer(err)
+	}
+
+	switch {
+	case bytes.HasPrefix(head, magicGzip):
+		return encodingGzip, nil
+	case bytes.HasPrefix(head, magicZstd):
+		return encodingZstd, nil
+	case bytes.HasPrefix(head, magicZip):
+		return encodingZip, nil
+	default:
+		return encodingPlain, nil
+	}
+}
+
+// openZip spools the archive to a temporary file, up to cfg.MaxArchiveSize,
+// and lists its CSV entries in archive order. Zip needs random access to its
+// central directory, so unlike gzip and zstd it cannot be decoded while
+// streaming. Directories, hidden files and macOS resource forks are skipped.
+func openZip(src io.Reader, cfg Config) ([]uploadFile, func(), error) {
+	tmp, err := os.CreateTemp("", "goflip-upload-*.zip")
+	if err != nil {
+		return nil, func() {}, pkgerror.NewServer(err)
+	}
+	cleanup := func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}
+
+	size, err := io.Copy(tmp, io.LimitReader(src, cfg.MaxArchiveSize+1))
+	if err != nil {
+		cleanup()
+		return nil, func() {}, pkgerror.NewServer(err)
+	}
+	if size > cfg.MaxArchiveSize {
+		cleanup()
+		return nil, func() {}, pkgerror.NewInvalidInput(fmt.Errorf("%w: archive exceeds %d bytes", errTooLarge, cfg.MaxArchiveSize))
+	}
+
+	archive, err := zip.NewReader(tmp, size)
+	if err != nil {
+		cleanup()
+		return nil, func() {}, pkgerror.NewInvalidInput(&decodeError{err: err})
+	}
+
+	var files []uploadFile
+	for _, entry := range archive.File {
+		if !isCSVEntry(entry) {
+			continue
+		}
+		files = append(files, uploadFile{name: entry.Name, open: func() (io.ReadCloser, error) {
+			rc, err := entry.Open()
+			if err != nil {
+				return nil, &decodeError{err: err}
+			}
+			return &decodingReader{r: newLimitedReader(rc, cfg.MaxDecompressedSize), close: rc.Close}, nil
+		}})
+	}
+
+	if len(files) == 0 {
+		cleanup()
+		return nil, func() {}, pkgerror.NewInvalidInput(errors.New("archive has no csv files"))
+	}
+
+	return files, cleanup, nil
+}
+
+func isCSVEntry(entry *zip.File) bool {
+	if entry.FileInfo().IsDir() || strings.HasPrefix(entry.Name, "__MACOSX/") {
+		return false
+	}
+
+	base := path.Base(entry.Name)
+	return !strings.HasPrefix(base, ".") && strings.EqualFold(path.Ext(base), ".csv")
+}
+
+func trimExt(name string, exts ...string) string {
+	for _, ext := range exts {
+		if len(name) > len(ext) && strings.EqualFold(name[len(name)-len(ext):], ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
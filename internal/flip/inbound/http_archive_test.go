@@ -0,0 +1,330 @@
+package inbound
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/flip/store"
+	"github.com/shandysiswandi/goflip/internal/flip/usecase"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgrouter"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgroutine"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkguid"
+)
+
+const archiveCSV = "1674507883, JOHN DOE, CREDIT, 100, SUCCESS, salary\n" +
+	"1674507884, JOHN DOE, DEBIT, 50, SUCCESS, grocery\n"
+
+func newArchiveRouter(t *testing.T) (http.Handler, *pkgroutine.Manager) {
+	t.Helper()
+
+	return newArchiveRouterWithConfig(t, Config{})
+}
+
+func newArchiveRouterWithConfig(t *testing.T, cfg Config) (http.Handler, *pkgroutine.Manager) {
+	t.Helper()
+
+	runner := pkgroutine.NewManager(10)
+	uc := usecase.New(usecase.Dependency{
+		Store:   store.NewInMemoryStore(),
+		Runner:  runner,
+		ID:      pkguid.NewUUID(),
+		RootCtx: context.Background(),
+		Profiles: []usecase.ParseProfile{{
+			Name:       "header",
+			Columns:    usecase.DefaultParseProfile().Columns,
+			SkipHeader: true,
+		}},
+	})
+
+	router := pkgrouter.NewRouter(pkguid.NewUUID())
+	RegisterHTTPEndpoint(router, uc, cfg)
+
+	return router, runner
+}
+
+func postUpload(t *testing.T, router http.Handler, target string, body []byte, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func waitStatement(t *testing.T, router http.Handler, uploadID string) StatementResponse {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		statement := getStatement(t, router, uploadID)
+		if statement.Status.IsFinal() || time.Now().After(deadline) {
+			return statement
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func decodeUploadID(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("unexpected upload status: %d %s", rec.Code, rec.Body.String())
+	}
+
+	var env envelope[UploadResponse]
+	if err := json.NewDecoder(rec.Body).Decode(&env); err != nil {
+		t.Fatalf("decode upload response: %v", err)
+	}
+	return env.Data.UploadID
+}
+
+func gzipBytes(t *testing.T, data string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatalf("gzip write: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func zipBytes(t *testing.T, files map[string]string, order []string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range order {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zip create: %v", err)
+		}
+		if _, err := w.Write([]byte(files[name])); err != nil {
+			t.Fatalf("zip write: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestUploadGzipByContentEncoding(t *testing.T) {
+	router, runner := newArchiveRouter(t)
+
+	rec := postUpload(t, router, "/statements", gzipBytes(t, archiveCSV), http.Header{
+		"Content-Type":     {"text/csv"},
+		"Content-Encoding": {"gzip"},
+	})
+	uploadID := decodeUploadID(t, rec)
+
+	statement := waitStatement(t, router, uploadID)
+	if statement.Status != entity.UploadStatusDone || statement.ParsedOK != 2 {
+		t.Fatalf("unexpected statement: %+v", statement)
+	}
+	if err := runner.Wait(); err != nil {
+		t.Fatalf("runner wait: %v", err)
+	}
+}
+
+func TestUploadZstdByMagicBytes(t *testing.T) {
+	router, runner := newArchiveRouter(t)
+
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("zstd writer: %v", err)
+	}
+	payload := zw.EncodeAll([]byte(archiveCSV), nil)
+	_ = zw.Close()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "statement.bin")
+	if err != nil {
+		t.Fatalf("create form file: %v", err)
+	}
+	if _, err := part.Write(payload); err != nil {
+		t.Fatalf("write payload: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close writer: %v", err)
+	}
+
+	rec := postUpload(t, router, "/statements", body.Bytes(), http.Header{"Content-Type": {writer.FormDataContentType()}})
+	uploadID := decodeUploadID(t, rec)
+
+	statement := waitStatement(t, router, uploadID)
+	if statement.Status != entity.UploadStatusDone || statement.ParsedOK != 2 {
+		t.Fatalf("unexpected statement: %+v", statement)
+	}
+	if err := runner.Wait(); err != nil {
+		t.Fatalf("runner wait: %v", err)
+	}
+}
+
+func TestUploadZipCreatesOneUploadPerCSV(t *testing.T) {
+	router, runner := newArchiveRouter(t)
+
+	archive := zipBytes(t, map[string]string{
+		"jan.csv":          archiveCSV,
+		"notes.txt":        "not a statement",
+		"__MACOSX/feb.csv": "junk",
+		"feb.csv":          "1674507885, JOHN DOE, CREDIT, 7, SUCCESS, refund\n",
+	}, []string{"jan.csv", "notes.txt", "__MACOSX/feb.csv", "feb.csv"})
+
+	rec := postUpload(t, router, "/statements", archive, http.Header{"Content-Type": {"application/octet-stream"}})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("unexpected upload status: %d %s", rec.Code, rec.Body.String())
+	}
+
+	var env envelope[UploadsResponse]
+	if err := json.NewDecoder(rec.Body).Decode(&env); err != nil {
+		t.Fatalf("decode uploads response: %v", err)
+	}
+	if len(env.Data.Uploads) != 2 || env.Data.Uploads[0].FileName != "jan.csv" || env.Data.Uploads[1].FileName != "feb.csv" {
+		t.Fatalf("unexpected uploads: %+v", env.Data.Uploads)
+	}
+
+	feb := waitStatement(t, router, env.Data.Uploads[1].UploadID)
+	if feb.Status != entity.UploadStatusDone || feb.ParsedOK != 1 || feb.FileName != "feb.csv" {
+		t.Fatalf("unexpected feb statement: %+v", feb)
+	}
+	if err := runner.Wait(); err != nil {
+		t.Fatalf("runner wait: %v", err)
+	}
+}
+
+func TestUploadZipMergeSkipsRepeatedHeaders(t *testing.T) {
+	router, runner := newArchiveRouter(t)
+
+	header := "timestamp,counterparty,type,amount,status,description\n"
+	archive := zipBytes(t, map[string]string{
+		"a.csv": header + archiveCSV,
+		"b.csv": header + "1674507885, JOHN DOE, CREDIT, 7, SUCCESS, refund\nbad,row\n",
+	}, []string{"a.csv", "b.csv"})
+
+	rec := postUpload(t, router, "/statements?merge=true&profile=header", archive, http.Header{"Content-Type": {"application/zip"}})
+	uploadID := decodeUploadID(t, rec)
+
+	statement := waitStatement(t, router, uploadID)
+	if statement.Status != entity.UploadStatusDone || statement.ParsedOK != 3 || statement.ParseErr != 1 {
+		t.Fatalf("unexpected statement: %+v", statement)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/statements/"+uploadID+"/errors", nil)
+	errRec := httptest.NewRecorder()
+	router.ServeHTTP(errRec, req)
+	var errs envelope[ParseErrorsResponse]
+	if err := json.NewDecoder(errRec.Body).Decode(&errs); err != nil {
+		t.Fatalf("decode errors: %v", err)
+	}
+	if len(errs.Data.Errors) != 1 || errs.Data.Errors[0].File != "b.csv" || errs.Data.Errors[0].Line != 3 {
+		t.Fatalf("unexpected parse errors: %+v", errs.Data.Errors)
+	}
+
+	balance := getBalance(t, router, uploadID)
+	if len(balance.Balances) != 1 || balance.Balances[0].Amount != "57" {
+		t.Fatalf("unexpected balances: %+v", balance.Balances)
+	}
+	if err := runner.Wait(); err != nil {
+		t.Fatalf("runner wait: %v", err)
+	}
+}
+
+func TestUploadZipEnforcesSizeLimits(t *testing.T) {
+	router, runner := newArchiveRouterWithConfig(t, Config{MaxArchiveSize: 4 << 10, MaxDecompressedSize: 256})
+
+	archive := zipBytes(t, map[string]string{
+		"small.csv": archiveCSV,
+		"bomb.csv":  strings.Repeat(archiveCSV, 10),
+	}, []string{"small.csv", "bomb.csv"})
+	rec := postUpload(t, router, "/statements?merge=true", archive, http.Header{"Content-Type": {"application/zip"}})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for an oversized entry, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/statements?page=1&page_size=10", nil)
+	listRec := httptest.NewRecorder()
+	router.ServeHTTP(listRec, req)
+	var list envelope[StatementsResponse]
+	if err := json.NewDecoder(listRec.Body).Decode(&list); err != nil {
+		t.Fatalf("decode statements: %v", err)
+	}
+	if len(list.Data.Statements) != 1 {
+		t.Fatalf("expected the merged upload to be listed, got %+v", list.Data.Statements)
+	}
+	statement := waitStatement(t, router, list.Data.Statements[0].UploadID)
+	if statement.Status != entity.UploadStatusFailed || !strings.Contains(statement.Error, "exceeds 256 bytes") {
+		t.Fatalf("expected the upload to fail on the oversized entry, got %+v", statement)
+	}
+
+	// Padding pushes the archive past the spool limit however well it compresses.
+	big := append(zipBytes(t, map[string]string{"big.csv": archiveCSV}, []string{"big.csv"}), make([]byte, 4<<10)...)
+	rec = postUpload(t, router, "/statements", big, http.Header{"Content-Type": {"application/zip"}})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for an oversized archive, got %d %s", rec.Code, rec.Body.String())
+	}
+	if err := runner.Wait(); !errors.Is(err, errTooLarge) {
+		t.Fatalf("expected the failed upload in runner wait, got %v", err)
+	}
+}
+
+func TestUploadRejectsCorruptGzip(t *testing.T) {
+	router, runner := newArchiveRouter(t)
+
+	rec := postUpload(t, router, "/statements", []byte("not gzip at all"), http.Header{"Content-Encoding": {"gzip"}})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for corrupt gzip, got %d", rec.Code)
+	}
+
+	rec = postUpload(t, router, "/statements", []byte("x"), http.Header{"Content-Encoding": {"br"}})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for unsupported encoding, got %d", rec.Code)
+	}
+	if err := runner.Wait(); err != nil {
+		t.Fatalf("runner wait: %v", err)
+	}
+}
+
+func TestUploadReturnsWhenParsingStopsEarly(t *testing.T) {
+	router, runner := newArchiveRouter(t)
+
+	body := "1674507883, JOHN DOE, CREDIT, 1\"00, SUCCESS, salary\n" + strings.Repeat(archiveCSV, 4096)
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- postUpload(t, router, "/statements", []byte(body), http.Header{"Content-Type": {"text/csv"}})
+	}()
+
+	select {
+	case rec := <-done:
+		statement := waitStatement(t, router, decodeUploadID(t, rec))
+		if statement.Status != entity.UploadStatusFailed {
+			t.Fatalf("expected failed upload, got %+v", statement)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("upload handler blocked after parsing stopped")
+	}
+	if err := runner.Wait(); err != nil {
+		t.Logf("runner wait: %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package inbound
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+)
+
+func TestCancelStatement(t *testing.T) {
+	router, runner := newArchiveRouter(t)
+
+	uploadID := decodeUploadID(t, postUpload(t, router, "/statements", []byte(archiveCSV), http.Header{"Content-Type": {"text/csv"}}))
+	if statement := waitStatement(t, router, uploadID); statement.Status != entity.UploadStatusDone {
+		t.Fatalf("unexpected statement: %+v", statement)
+	}
+	if err := runner.Wait(); err != nil {
+		t.Fatalf("runner wait: %v", err)
+	}
+
+	tests := []struct {
+		uploadID string
+		want     int
+	}{
+		{uploadID: uploadID, want: http.StatusConflict},
+		{uploadID: "missing", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/statements/"+tt.uploadID+"/cancel", nil))
+		if rec.Code != tt.want {
+			t.Fatalf("cancel %s: expected %d, got %d %s", tt.uploadID, tt.want, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -3,43 +3,317 @@ package inbound
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"maps"
 	"mime"
 	"net/http"
+	"path"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/shandysiswandi/goflip/internal/flip/entity"
 	"github.com/shandysiswandi/goflip/internal/flip/usecase"
 	"github.com/shandysiswandi/goflip/internal/pkg/pkgerror"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgrouter"
 )
 
+// headerIdempotencyKey lets a client retry an upload without starting a
+// second one.
+const headerIdempotencyKey = "Idempotency-Key"
+
+const maxIdempotencyKeyLen = 255
+
 type HTTPEndpoint struct {
-	uc uc
+	uc  uc
+	cfg Config
 }
 
 func (h *HTTPEndpoint) Statements(ctx context.Context, r *http.Request) (any, error) {
-	reader, cleanup, err := extractCSVReader(r)
+	query := r.URL.Query()
+	merge, err := parseBoolParam(query.Get("merge"), "merge")
+	if err != nil {
+		return nil, err
+	}
+
+	idemKey := strings.TrimSpace(r.Header.Get(headerIdempotencyKey))
+	if len(idemKey) > maxIdempotencyKeyLen {
+		return nil, pkgerror.NewInvalidInput(fmt.Errorf("%s must be at most %d bytes", headerIdempotencyKey, maxIdempotencyKeyLen))
+	}
+
+	src, cleanup, err := extractUpload(r)
 	if err != nil {
 		return nil, err
 	}
 	defer cleanup()
 
-	pr, pw := io.Pipe()
-	result, err := h.uc.Upload(ctx, pr)
+	files, archive, closeFiles, err := openUpload(src, h.cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFiles()
+
+	opts := usecase.UploadOptions{
+		Profile:        strings.TrimSpace(query.Get("profile")),
+		FileName:       src.fileName,
+		CallbackURL:    strings.TrimSpace(query.Get("callback_url")),
+		IdempotencyKey: idemKey,
+	}
+
+	if archive && !merge {
+		return h.uploadEach(ctx, files, opts)
+	}
+
+	return h.uploadMerged(ctx, files, archive, opts)
+}
+
+// uploadMerged streams every file into a single upload.
+func (h *HTTPEndpoint) uploadMerged(ctx context.Context, files []uploadFile, named bool, opts usecase.UploadOptions) (any, error) {
+	parts := make([]usecase.UploadPart, 0, len(files))
+	readers := make([]*io.PipeReader, 0, len(files))
+	writers := make([]*io.PipeWriter, 0, len(files))
+	for _, file := range files {
+		pr, pw := io.Pipe()
+		part := usecase.UploadPart{Reader: pr}
+		if named {
+			part.Name = file.name
+		}
+		parts = append(parts, part)
+		readers = append(readers, pr)
+		writers = append(writers, pw)
+	}
+
+	result, err := h.uc.UploadParts(ctx, parts, opts)
 	if err != nil {
-		_ = pr.Close()
-		_ = pw.Close()
+		for i := range readers {
+			_ = readers[i].Close()
+			_ = writers[i].Close()
+		}
 		return nil, err
 	}
 
-	if err := streamToPipe(reader, pw); err != nil {
-		return nil, pkgerror.NewServer(err)
+	if result.Replayed {
+		for _, pw := range writers {
+			_ = pw.Close()
+		}
+		return UploadResponse{UploadID: result.UploadID, Replayed: true}, nil
+	}
+
+	for i, file := range files {
+		if err := streamFile(file, writers[i]); err != nil {
+			for _, pw := range writers[i+1:] {
+				_ = pw.CloseWithError(err)
+			}
+			return nil, err
+		}
 	}
 
 	return UploadResponse{UploadID: result.UploadID}, nil
 }
 
+// uploadEach starts one upload per archive entry. An idempotency key is
+// scoped to each entry by its name, so a retried archive replays entry by
+// entry.
+func (h *HTTPEndpoint) uploadEach(ctx context.Context, files []uploadFile, opts usecase.UploadOptions) (any, error) {
+	key := opts.IdempotencyKey
+	uploads := make([]UploadResponse, 0, len(files))
+	for _, file := range files {
+		opts.FileName = file.name
+		if key != "" {
+			opts.IdempotencyKey = key + ":" + file.name
+		}
+
+		pr, pw := io.Pipe()
+		result, err := h.uc.Upload(ctx, pr, opts)
+		if err != nil {
+			_ = pr.Close()
+			_ = pw.Close()
+			return nil, err
+		}
+
+		if result.Replayed {
+			_ = pw.Close()
+		} else if err := streamFile(file, pw); err != nil {
+			return nil, err
+		}
+
+		uploads = append(uploads, UploadResponse{UploadID: result.UploadID, FileName: file.name, Replayed: result.Replayed})
+	}
+
+	return UploadsResponse{Uploads: uploads}, nil
+}
+
+// streamFile copies a decoded file into its upload pipe. A closed pipe means
+// processing already stopped, and the upload status carries the reason.
+func streamFile(file uploadFile, pw *io.PipeWriter) error {
+	rc, err := file.open()
+	if err != nil {
+		_ = pw.CloseWithError(err)
+		return pkgerror.NewInvalidInput(err)
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+
+	err = streamToPipe(rc, pw)
+	if err == nil || errors.Is(err, io.ErrClosedPipe) {
+		return nil
+	}
+
+	var derr *decodeError
+	if errors.As(err, &derr) {
+		return pkgerror.NewInvalidInput(err)
+	}
+	return pkgerror.NewServer(err)
+}
+
+func (h *HTTPEndpoint) GetStatement(ctx context.Context, r *http.Request) (any, error) {
+	uploadID := strings.TrimSpace(pkgrouter.GetParam(ctx, "upload_id"))
+	if uploadID == "" {
+		return nil, pkgerror.NewInvalidInput(errors.New("upload_id is required"))
+	}
+
+	result, err := h.uc.Statement(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toStatementResponse(result), nil
+}
+
+func (h *HTTPEndpoint) ListStatements(ctx context.Context, r *http.Request) (any, error) {
+	query := r.URL.Query()
+
+	page, pageSize, err := parsePagination(query.Get("page"), query.Get("page_size"))
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := parseUploadFilter(query.Get("status"), query.Get("created_from"), query.Get("created_to"))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := h.uc.Statements(ctx, filter, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := make([]StatementResponse, 0, len(result.Uploads))
+	for _, upload := range result.Uploads {
+		statements = append(statements, toStatementResponse(upload))
+	}
+
+	return StatementsResponse{
+		Statements: statements,
+		page:       result.Page,
+		pageSize:   result.PageSize,
+		total:      result.Total,
+	}, nil
+}
+
+func (h *HTTPEndpoint) StatementErrors(ctx context.Context, r *http.Request) (any, error) {
+	uploadID := strings.TrimSpace(pkgrouter.GetParam(ctx, "upload_id"))
+	if uploadID == "" {
+		return nil, pkgerror.NewInvalidInput(errors.New("upload_id is required"))
+	}
+
+	query := r.URL.Query()
+	page, pageSize, err := parsePagination(query.Get("page"), query.Get("page_size"))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := h.uc.ParseErrors(ctx, uploadID, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make([]ParseError, 0, len(result.Errors))
+	for _, perr := range result.Errors {
+		errs = append(errs, toParseError(perr))
+	}
+
+	return ParseErrorsResponse{
+		UploadID: result.UploadID,
+		Status:   result.Status,
+		ParseErr: result.ParseErr,
+		Errors:   errs,
+		page:     result.Page,
+		pageSize: result.PageSize,
+		total:    result.Total,
+	}, nil
+}
+
+func (h *HTTPEndpoint) StatementWebhooks(ctx context.Context, r *http.Request) (any, error) {
+	uploadID := strings.TrimSpace(pkgrouter.GetParam(ctx, "upload_id"))
+	if uploadID == "" {
+		return nil, pkgerror.NewInvalidInput(errors.New("upload_id is required"))
+	}
+
+	query := r.URL.Query()
+	page, pageSize, err := parsePagination(query.Get("page"), query.Get("page_size"))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := h.uc.WebhookDeliveries(ctx, uploadID, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]WebhookDelivery, 0, len(result.Deliveries))
+	for _, delivery := range result.Deliveries {
+		deliveries = append(deliveries, WebhookDelivery{
+			EventID:    delivery.EventID,
+			URL:        delivery.URL,
+			Attempt:    delivery.Attempt,
+			StatusCode: delivery.StatusCode,
+			Error:      delivery.Err,
+			Delivered:  delivery.Delivered,
+			At:         delivery.At,
+		})
+	}
+
+	return WebhookDeliveriesResponse{
+		UploadID:   result.UploadID,
+		Status:     result.Status,
+		Deliveries: deliveries,
+		page:       result.Page,
+		pageSize:   result.PageSize,
+		total:      result.Total,
+	}, nil
+}
+
+func (h *HTTPEndpoint) CancelStatement(ctx context.Context, r *http.Request) (any, error) {
+	uploadID := strings.TrimSpace(pkgrouter.GetParam(ctx, "upload_id"))
+	if uploadID == "" {
+		return nil, pkgerror.NewInvalidInput(errors.New("upload_id is required"))
+	}
+
+	result, err := h.uc.Cancel(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toStatementResponse(result), nil
+}
+
+func (h *HTTPEndpoint) DeleteStatement(ctx context.Context, r *http.Request) (any, error) {
+	uploadID := strings.TrimSpace(pkgrouter.GetParam(ctx, "upload_id"))
+	if uploadID == "" {
+		return nil, pkgerror.NewInvalidInput(errors.New("upload_id is required"))
+	}
+
+	if err := h.uc.Delete(ctx, uploadID); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
 func (h *HTTPEndpoint) Balance(ctx context.Context, r *http.Request) (any, error) {
 	uploadID := strings.TrimSpace(r.URL.Query().Get("upload_id"))
 	if uploadID == "" {
@@ -54,7 +328,7 @@ func (h *HTTPEndpoint) Balance(ctx context.Context, r *http.Request) (any, error
 	return BalanceResponse{
 		UploadID: result.UploadID,
 		Status:   result.Status,
-		Balance:  result.Balance,
+		Balances: toCurrencyBalances(result.Balances),
 	}, nil
 }
 
@@ -95,6 +369,43 @@ func (h *HTTPEndpoint) TransactionIssues(ctx context.Context, r *http.Request) (
 	}, nil
 }
 
+func (h *HTTPEndpoint) Transactions(ctx context.Context, r *http.Request) (any, error) {
+	query := r.URL.Query()
+	uploadID := strings.TrimSpace(query.Get("upload_id"))
+	if uploadID == "" {
+		return nil, pkgerror.NewInvalidInput(errors.New("upload_id is required"))
+	}
+
+	page, pageSize, err := parsePagination(query.Get("page"), query.Get("page_size"))
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := parseTxFilter(query.Get("status"), query.Get("type"), true)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := h.uc.Transactions(ctx, uploadID, filter, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := make([]Transaction, 0, len(result.Transactions))
+	for _, tx := range result.Transactions {
+		transactions = append(transactions, toHTTPTransaction(tx))
+	}
+
+	return TransactionsResponse{
+		UploadID:     result.UploadID,
+		Status:       result.Status,
+		Transactions: transactions,
+		page:         result.Page,
+		pageSize:     result.PageSize,
+		total:        result.Total,
+	}, nil
+}
+
 func parsePagination(pageRaw, sizeRaw string) (int, int, error) {
 	page := 1
 	pageSize := 10
@@ -121,7 +432,90 @@ func parsePagination(pageRaw, sizeRaw string) (int, int, error) {
 	return page, pageSize, nil
 }
 
+func parseUploadFilter(statusRaw, fromRaw, toRaw string) (usecase.UploadFilter, error) {
+	filter := usecase.UploadFilter{}
+
+	for _, value := range strings.Split(statusRaw, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		status, err := parseUploadStatus(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.Statuses = append(filter.Statuses, status)
+	}
+
+	var err error
+	if filter.CreatedFrom, err = parseTimeParam(fromRaw, "created_from"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedTo, err = parseTimeParam(toRaw, "created_to"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+// parseTimeParam accepts either Unix seconds or an RFC 3339 timestamp.
+func parseTimeParam(raw, name string) (int64, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+
+	if value, err := strconv.ParseInt(raw, 10, 64); err == nil && value >= 0 {
+		return value, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return 0, pkgerror.NewInvalidInput(errors.New("invalid " + name))
+	}
+
+	return t.Unix(), nil
+}
+
+func parseBoolParam(raw, name string) (bool, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return false, nil
+	}
+
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, pkgerror.NewInvalidInput(errors.New("invalid " + name))
+	}
+
+	return value, nil
+}
+
+func parseUploadStatus(value string) (entity.UploadStatus, error) {
+	switch status := entity.UploadStatus(strings.ToUpper(value)); status {
+	case entity.UploadStatusQueued, entity.UploadStatusProcessing, entity.UploadStatusDone, entity.UploadStatusFailed, entity.UploadStatusCanceled:
+		return status, nil
+	default:
+		return "", pkgerror.NewInvalidInput(errors.New("invalid status filter"))
+	}
+}
+
 func parseIssueFilter(statusRaw, typeRaw string) (usecase.IssueFilter, error) {
+	filter, err := parseTxFilter(statusRaw, typeRaw, false)
+	if err != nil {
+		return filter, err
+	}
+
+	if len(filter.Statuses) == 0 {
+		filter.Statuses = []entity.TxStatus{entity.TxStatusFailed, entity.TxStatusPending}
+	}
+
+	return filter, nil
+}
+
+// parseTxFilter parses comma separated status and type filters. SUCCESS is only
+// accepted when allowSuccess is set, since issues never contain it.
+func parseTxFilter(statusRaw, typeRaw string, allowSuccess bool) (usecase.IssueFilter, error) {
 	filter := usecase.IssueFilter{}
 
 	if statusRaw != "" {
@@ -131,7 +525,7 @@ func parseIssueFilter(statusRaw, typeRaw string) (usecase.IssueFilter, error) {
 			if value == "" {
 				continue
 			}
-			status, err := parseStatus(value)
+			status, err := parseStatus(value, allowSuccess)
 			if err != nil {
 				return filter, err
 			}
@@ -154,15 +548,16 @@ func parseIssueFilter(statusRaw, typeRaw string) (usecase.IssueFilter, error) {
 		}
 	}
 
-	if len(filter.Statuses) == 0 {
-		filter.Statuses = []entity.TxStatus{entity.TxStatusFailed, entity.TxStatusPending}
-	}
-
 	return filter, nil
 }
 
-func parseStatus(value string) (entity.TxStatus, error) {
+func parseStatus(value string, allowSuccess bool) (entity.TxStatus, error) {
 	switch strings.ToUpper(value) {
+	case string(entity.TxStatusSuccess):
+		if allowSuccess {
+			return entity.TxStatusSuccess, nil
+		}
+		return "", pkgerror.NewInvalidInput(errors.New("invalid status filter"))
 	case string(entity.TxStatusFailed):
 		return entity.TxStatusFailed, nil
 	case string(entity.TxStatusPending):
@@ -188,45 +583,111 @@ func toHTTPTransaction(tx entity.Transaction) Transaction {
 		Timestamp:    tx.Timestamp,
 		Counterparty: tx.Counterparty,
 		Type:         tx.Type,
-		Amount:       tx.Amount,
+		Amount:       tx.Amount.String(),
+		Currency:     tx.Currency,
 		Status:       tx.Status,
 		Description:  tx.Description,
 	}
 }
 
-func extractCSVReader(r *http.Request) (io.ReadCloser, func(), error) {
+func toStatementResponse(result usecase.StatementResult) StatementResponse {
+	meta := result.Meta
+	return StatementResponse{
+		UploadID:        meta.ID,
+		Status:          meta.Status,
+		Error:           meta.Err,
+		Profile:         meta.Profile,
+		FileName:        meta.FileName,
+		CallbackURL:     meta.CallbackURL,
+		IdempotencyKey:  meta.IdempotencyKey,
+		ContentSHA256:   meta.ContentHash,
+		DuplicateOf:     meta.DuplicateOf,
+		CreatedAt:       meta.CreatedAt,
+		StartedAt:       meta.StartedAt,
+		EndedAt:         meta.EndedAt,
+		DurationSeconds: int64(result.Duration / time.Second),
+		TotalLines:      meta.TotalLines,
+		ParsedOK:        meta.ParsedOK,
+		ParseErr:        meta.ParseErr,
+	}
+}
+
+func toParseError(perr entity.ParseError) ParseError {
+	return ParseError{
+		File:   perr.File,
+		Line:   perr.Line,
+		Field:  perr.Field,
+		Reason: perr.Reason,
+		Raw:    perr.Raw,
+	}
+}
+
+// toCurrencyBalances lists balances sorted by currency code.
+func toCurrencyBalances(balances entity.Balances) []CurrencyBalance {
+	result := make([]CurrencyBalance, 0, len(balances))
+	for _, currency := range slices.Sorted(maps.Keys(balances)) {
+		result = append(result, CurrencyBalance{
+			Currency: currency,
+			Amount:   balances[currency].String(),
+		})
+	}
+	return result
+}
+
+func extractUpload(r *http.Request) (uploadSource, func(), error) {
 	contentType := r.Header.Get("Content-Type")
+	mediaType := ""
 	if contentType != "" {
-		mediaType, _, err := mime.ParseMediaType(contentType)
+		parsed, _, err := mime.ParseMediaType(contentType)
+		if err == nil {
+			mediaType = parsed
+		}
 		if err == nil && strings.EqualFold(mediaType, "multipart/form-data") {
 			return extractMultipartFile(r)
 		}
 	}
 
 	if r.Body == nil {
-		return nil, func() {}, pkgerror.NewInvalidInput(errors.New("empty request body"))
+		return uploadSource{}, func() {}, pkgerror.NewInvalidInput(errors.New("empty request body"))
 	}
 
-	return r.Body, func() {}, nil
+	src := uploadSource{
+		body:            r.Body,
+		contentType:     mediaType,
+		contentEncoding: r.Header.Get("Content-Encoding"),
+	}
+	if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); err == nil {
+		src.fileName = path.Base(params["filename"])
+	}
+
+	return src, func() {}, nil
 }
 
-func extractMultipartFile(r *http.Request) (io.ReadCloser, func(), error) {
+func extractMultipartFile(r *http.Request) (uploadSource, func(), error) {
 	reader, err := r.MultipartReader()
 	if err != nil {
-		return nil, func() {}, pkgerror.NewInvalidFormat()
+		return uploadSource{}, func() {}, pkgerror.NewInvalidFormat()
 	}
 
 	for {
 		part, err := reader.NextPart()
 		if err != nil {
 			if errors.Is(err, io.EOF) {
-				return nil, func() {}, pkgerror.NewInvalidInput(errors.New("file part is required"))
+				return uploadSource{}, func() {}, pkgerror.NewInvalidInput(errors.New("file part is required"))
 			}
-			return nil, func() {}, pkgerror.NewInvalidFormat()
+			return uploadSource{}, func() {}, pkgerror.NewInvalidFormat()
 		}
 
 		if part.FormName() == "file" {
-			return part, func() { _ = part.Close() }, nil
+			src := uploadSource{
+				body:            part,
+				fileName:        part.FileName(),
+				contentEncoding: part.Header.Get("Content-Encoding"),
+			}
+			if mediaType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type")); err == nil {
+				src.contentType = mediaType
+			}
+			return src, func() { _ = part.Close() }, nil
 		}
 		_ = part.Close()
 	}
@@ -0,0 +1,89 @@
+package inbound
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shandysiswandi/goflip/internal/flip/usecase"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgerror"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgrouter"
+)
+
+// sseHeartbeat is how often a comment is sent on an idle event stream.
+const sseHeartbeat = 15 * time.Second
+
+// StatementEvents streams the progress of an upload as Server-Sent Events:
+// the current state first, then status, progress and parse_error events, and
+// a final summary. A client that falls behind is disconnected and picks up
+// the current state again when it reconnects.
+func (h *HTTPEndpoint) StatementEvents(ctx context.Context, r *http.Request) (any, error) {
+	uploadID := strings.TrimSpace(pkgrouter.GetParam(ctx, "upload_id"))
+	if uploadID == "" {
+		return nil, pkgerror.NewInvalidInput(errors.New("upload_id is required"))
+	}
+
+	stream, err := h.uc.SubscribeProgress(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &progressStream{stream: stream}, nil
+}
+
+type progressStream struct {
+	stream *usecase.ProgressStream
+}
+
+func (p *progressStream) Stream(ctx context.Context, w *pkgrouter.SSEWriter) error {
+	defer p.stream.Close()
+
+	if err := sendProgress(w, p.stream.Snapshot); err != nil {
+		return err
+	}
+	if p.stream.Snapshot.Type == usecase.ProgressSummary {
+		return nil
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-heartbeat.C:
+			if err := w.Comment("heartbeat"); err != nil {
+				return err
+			}
+		case event, ok := <-p.stream.Events:
+			if !ok {
+				return nil
+			}
+			if err := sendProgress(w, event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func sendProgress(w *pkgrouter.SSEWriter, event usecase.ProgressEvent) error {
+	statement := toStatementResponse(event.Statement)
+
+	switch event.Type {
+	case usecase.ProgressParseError:
+		return w.Send(string(event.Type), ParseErrorEvent{
+			UploadID:   statement.UploadID,
+			ParseError: toParseError(event.ParseError),
+		})
+	case usecase.ProgressSummary:
+		return w.Send(string(event.Type), SummaryEvent{
+			StatementResponse: statement,
+			Balances:          toCurrencyBalances(event.Balances),
+		})
+	default:
+		return w.Send(string(event.Type), statement)
+	}
+}
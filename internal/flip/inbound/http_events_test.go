@@ -0,0 +1,156 @@
+package inbound
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/flip/store"
+	"github.com/shandysiswandi/goflip/internal/flip/usecase"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgrouter"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgroutine"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkguid"
+)
+
+type sseEvent struct {
+	name string
+	data string
+}
+
+// readSSE returns the next event from an event stream, skipping comments.
+func readSSE(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var event sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+
+		switch {
+		case line == "":
+			if event.name != "" {
+				return event
+			}
+		case strings.HasPrefix(line, "event: "):
+			event.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestStatementEventsStreamsProgress(t *testing.T) {
+	runner := pkgroutine.NewManager(10)
+	uc := usecase.New(usecase.Dependency{
+		Store:            store.NewInMemoryStore(),
+		Runner:           runner,
+		ID:               pkguid.NewUUID(),
+		RootCtx:          context.Background(),
+		ProgressInterval: 1,
+	})
+
+	router := pkgrouter.NewRouter(pkguid.NewUUID())
+	RegisterHTTPEndpoint(router, uc, Config{})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	pr, pw := io.Pipe()
+	result, err := uc.Upload(context.Background(), pr, usecase.UploadOptions{})
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/statements/"+result.UploadID+"/events", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("get events: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	stream := bufio.NewReader(resp.Body)
+	if first := readSSE(t, stream); first.name != "status" {
+		t.Fatalf("expected status snapshot first, got %+v", first)
+	}
+
+	go func() {
+		_, _ = io.WriteString(pw, "1674507883, JOHN DOE, CREDIT, 100, SUCCESS, salary\nbad,row\n")
+		_ = pw.Close()
+	}()
+
+	var names []string
+	var summary SummaryEvent
+	for {
+		event := readSSE(t, stream)
+		names = append(names, event.name)
+		if event.name == "summary" {
+			if err := json.Unmarshal([]byte(event.data), &summary); err != nil {
+				t.Fatalf("decode summary: %v", err)
+			}
+			break
+		}
+	}
+
+	if !strings.Contains(strings.Join(names, ","), "progress,parse_error") {
+		t.Fatalf("expected progress and parse_error events, got %v", names)
+	}
+	if summary.Status != entity.UploadStatusDone || summary.ParsedOK != 1 || summary.ParseErr != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	if len(summary.Balances) != 1 || summary.Balances[0].Amount != "100" {
+		t.Fatalf("unexpected summary balances: %+v", summary.Balances)
+	}
+
+	if _, err := stream.ReadString('\n'); err != io.EOF {
+		t.Fatalf("expected stream to end after summary, got %v", err)
+	}
+	if err := runner.Wait(); err != nil {
+		t.Fatalf("runner wait: %v", err)
+	}
+}
+
+func TestStatementEventsOnFinishedUpload(t *testing.T) {
+	router, runner := newArchiveRouter(t)
+
+	rec := postUpload(t, router, "/statements", []byte(archiveCSV), http.Header{"Content-Type": {"text/csv"}})
+	uploadID := decodeUploadID(t, rec)
+	waitStatement(t, router, uploadID)
+
+	req := httptest.NewRequest(http.MethodGet, "/statements/"+uploadID+"/events", nil)
+	events := httptest.NewRecorder()
+	router.ServeHTTP(events, req)
+
+	event := readSSE(t, bufio.NewReader(events.Body))
+	if event.name != "summary" || !strings.Contains(event.data, `"status":"DONE"`) {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/statements/missing/events", nil)
+	missing := httptest.NewRecorder()
+	router.ServeHTTP(missing, req)
+	if missing.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown upload, got %d", missing.Code)
+	}
+	if err := runner.Wait(); err != nil {
+		t.Fatalf("runner wait: %v", err)
+	}
+}
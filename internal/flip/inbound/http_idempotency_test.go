@@ -0,0 +1,63 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/shandysiswandi/goflip/internal/flip/store"
+	"github.com/shandysiswandi/goflip/internal/flip/usecase"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgrouter"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgroutine"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkguid"
+)
+
+func TestUploadIdempotencyAndDuplicates(t *testing.T) {
+	runner := pkgroutine.NewManager(10)
+	uc := usecase.New(usecase.Dependency{
+		Store:            store.NewInMemoryStore(),
+		Runner:           runner,
+		ID:               pkguid.NewUUID(),
+		RootCtx:          context.Background(),
+		DetectDuplicates: true,
+	})
+	router := pkgrouter.NewRouter(pkguid.NewUUID())
+	RegisterHTTPEndpoint(router, uc, Config{})
+
+	header := http.Header{"Content-Type": {"text/csv"}, "Idempotency-Key": {"retry-1"}}
+	first := decodeUploadID(t, postUpload(t, router, "/statements", []byte(archiveCSV), header))
+	if statement := waitStatement(t, router, first); len(statement.ContentSHA256) != 64 || statement.IdempotencyKey != "retry-1" {
+		t.Fatalf("unexpected first statement: %+v", statement)
+	}
+
+	rec := postUpload(t, router, "/statements", []byte(archiveCSV), header)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a replay, got %d %s", rec.Code, rec.Body.String())
+	}
+	var env envelope[UploadResponse]
+	if err := json.NewDecoder(rec.Body).Decode(&env); err != nil {
+		t.Fatalf("decode replay: %v", err)
+	}
+	if env.Data.UploadID != first || !env.Data.Replayed {
+		t.Fatalf("expected replay of %s, got %+v", first, env.Data)
+	}
+
+	second := decodeUploadID(t, postUpload(t, router, "/statements", []byte(archiveCSV), http.Header{"Content-Type": {"text/csv"}}))
+	if second == first {
+		t.Fatal("expected a new upload without an idempotency key")
+	}
+	if statement := waitStatement(t, router, second); statement.DuplicateOf != first {
+		t.Fatalf("expected duplicate_of %s, got %+v", first, statement)
+	}
+
+	rec = postUpload(t, router, "/statements", []byte(archiveCSV), http.Header{"Idempotency-Key": {strings.Repeat("k", 256)}})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for an oversized key, got %d", rec.Code)
+	}
+
+	if err := runner.Wait(); err != nil {
+		t.Fatalf("runner wait: %v", err)
+	}
+}
@@ -31,14 +31,14 @@ func TestUploadProcessQuery(t *testing.T) {
 
 	uc := usecase.New(usecase.Dependency{
 		Store:   storage,
-		Events:  bus,
+		Events:  event.NewPublisher(nil, bus),
 		Runner:  runner,
 		ID:      pkguid.NewUUID(),
 		RootCtx: context.Background(),
 	})
 
 	router := pkgrouter.NewRouter(pkguid.NewUUID())
-	RegisterHTTPEndpoint(router, uc)
+	RegisterHTTPEndpoint(router, uc, Config{})
 
 	uploadID := uploadCSV(t, router)
 
@@ -55,8 +55,8 @@ func TestUploadProcessQuery(t *testing.T) {
 	if balance.Status != entity.UploadStatusDone {
 		t.Fatalf("upload not done, status=%s", balance.Status)
 	}
-	if balance.Balance != 50 {
-		t.Fatalf("unexpected balance: %d", balance.Balance)
+	if len(balance.Balances) != 1 || balance.Balances[0] != (CurrencyBalance{Currency: "IDR", Amount: "50"}) {
+		t.Fatalf("unexpected balances: %+v", balance.Balances)
 	}
 
 	issues := getIssues(t, router, uploadID)
@@ -64,9 +64,92 @@ func TestUploadProcessQuery(t *testing.T) {
 		t.Fatalf("expected 2 issues, got %d", len(issues.Transactions))
 	}
 
+	statement := getStatement(t, router, uploadID)
+	if statement.TotalLines != 4 || statement.ParsedOK != 4 || statement.CreatedAt == 0 {
+		t.Fatalf("unexpected statement: %+v", statement)
+	}
+
+	listReq := httptest.NewRequest(http.MethodGet, "/statements?status=DONE&page=1&page_size=5", nil)
+	listRec := httptest.NewRecorder()
+	router.ServeHTTP(listRec, listReq)
+	var list envelope[StatementsResponse]
+	if err := json.NewDecoder(listRec.Body).Decode(&list); err != nil {
+		t.Fatalf("decode statements: %v", err)
+	}
+	if len(list.Data.Statements) != 1 || list.Data.Statements[0].UploadID != uploadID {
+		t.Fatalf("unexpected statements list: %+v", list.Data)
+	}
+
 	if err := runner.Wait(); err != nil {
 		t.Fatalf("runner wait: %v", err)
 	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/statements/"+uploadID, nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("unexpected delete status: %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/balance?upload_id="+uploadID, nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected deleted upload to be gone, got status %d", rec.Code)
+	}
+}
+
+func newTransactionsRouter(t *testing.T, keep bool) http.Handler {
+	t.Helper()
+
+	uc := usecase.New(usecase.Dependency{
+		Store:   store.NewInMemoryStore(),
+		Runner:  pkgroutine.NewManager(10),
+		ID:      pkguid.NewUUID(),
+		RootCtx: context.Background(),
+
+		KeepTransactions: keep,
+	})
+
+	router := pkgrouter.NewRouter(pkguid.NewUUID())
+	RegisterHTTPEndpoint(router, uc, Config{})
+
+	return router
+}
+
+func TestTransactionsKeptWhenEnabled(t *testing.T) {
+	router := newTransactionsRouter(t, true)
+
+	uploadID := uploadCSV(t, router)
+	if statement := waitStatement(t, router, uploadID); statement.Status != entity.UploadStatusDone {
+		t.Fatalf("upload not done, status=%s", statement.Status)
+	}
+
+	txs := getTransactions(t, router, uploadID, "SUCCESS")
+	if len(txs.Transactions) != 2 {
+		t.Fatalf("expected 2 successful transactions, got %d", len(txs.Transactions))
+	}
+
+	issues := getIssues(t, router, uploadID)
+	if len(issues.Transactions) != 2 {
+		t.Fatalf("expected 2 issues, got %d", len(issues.Transactions))
+	}
+}
+
+func TestTransactionsDisabledByDefault(t *testing.T) {
+	router := newTransactionsRouter(t, false)
+
+	uploadID := uploadCSV(t, router)
+	if statement := waitStatement(t, router, uploadID); statement.Status != entity.UploadStatusDone {
+		t.Fatalf("upload not done, status=%s", statement.Status)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/transactions?upload_id="+uploadID, nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected transaction history to be disabled, got status %d", rec.Code)
+	}
 }
 
 func uploadCSV(t *testing.T, router http.Handler) string {
@@ -147,3 +230,39 @@ func getIssues(t *testing.T, router http.Handler, uploadID string) TransactionIs
 
 	return env.Data
 }
+
+func getTransactions(t *testing.T, router http.Handler, uploadID, status string) TransactionsResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/transactions?upload_id="+uploadID+"&status="+status, nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected transactions status: %d", rec.Code)
+	}
+
+	var env envelope[TransactionsResponse]
+	if err := json.NewDecoder(rec.Body).Decode(&env); err != nil {
+		t.Fatalf("decode transactions: %v", err)
+	}
+
+	return env.Data
+}
+
+func getStatement(t *testing.T, router http.Handler, uploadID string) StatementResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/statements/"+uploadID, nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected statement status: %d", rec.Code)
+	}
+
+	var env envelope[StatementResponse]
+	if err := json.NewDecoder(rec.Body).Decode(&env); err != nil {
+		t.Fatalf("decode statement: %v", err)
+	}
+
+	return env.Data
+}
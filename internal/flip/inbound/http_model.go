@@ -10,27 +10,159 @@ type Transaction struct {
 	Timestamp    int64           `json:"timestamp"`
 	Counterparty string          `json:"counterparty"`
 	Type         entity.TxType   `json:"type"`
-	Amount       int64           `json:"amount"`
+	Amount       string          `json:"amount"`
+	Currency     string          `json:"currency"`
 	Status       entity.TxStatus `json:"status"`
 	Description  string          `json:"description"`
 }
 
+// UploadResponse sets Replayed when the Idempotency-Key matched an earlier
+// upload, which is then answered with 200 instead of 202.
 type UploadResponse struct {
 	UploadID string `json:"upload_id"`
+	FileName string `json:"file_name,omitempty"`
+	Replayed bool   `json:"idempotent_replay,omitempty"`
 }
 
-func (UploadResponse) StatusCode() int {
+func (r UploadResponse) StatusCode() int {
+	if r.Replayed {
+		return http.StatusOK
+	}
 	return http.StatusAccepted
 }
 
-func (UploadResponse) Message() string {
+func (r UploadResponse) Message() string {
+	if r.Replayed {
+		return "upload already accepted"
+	}
 	return "upload accepted"
 }
 
+// UploadsResponse lists the uploads started from the entries of an archive.
+type UploadsResponse struct {
+	Uploads []UploadResponse `json:"uploads"`
+}
+
+func (UploadsResponse) StatusCode() int {
+	return http.StatusAccepted
+}
+
+func (UploadsResponse) Message() string {
+	return "uploads accepted"
+}
+
+type StatementResponse struct {
+	UploadID        string              `json:"upload_id"`
+	Status          entity.UploadStatus `json:"status"`
+	Error           string              `json:"error,omitempty"`
+	Profile         string              `json:"profile,omitempty"`
+	FileName        string              `json:"file_name,omitempty"`
+	CallbackURL     string              `json:"callback_url,omitempty"`
+	IdempotencyKey  string              `json:"idempotency_key,omitempty"`
+	ContentSHA256   string              `json:"content_sha256,omitempty"`
+	DuplicateOf     string              `json:"duplicate_of,omitempty"`
+	CreatedAt       int64               `json:"created_at"`
+	StartedAt       int64               `json:"started_at"`
+	EndedAt         int64               `json:"ended_at"`
+	DurationSeconds int64               `json:"duration_seconds"`
+	TotalLines      int64               `json:"total_lines"`
+	ParsedOK        int64               `json:"parsed_ok"`
+	ParseErr        int64               `json:"parse_err"`
+}
+
+type StatementsResponse struct {
+	Statements []StatementResponse `json:"statements"`
+	page       int
+	pageSize   int
+	total      int
+}
+
+func (r StatementsResponse) Meta() map[string]any {
+	return map[string]any{
+		"page":      r.page,
+		"page_size": r.pageSize,
+		"total":     r.total,
+	}
+}
+
+type ParseError struct {
+	File   string `json:"file,omitempty"`
+	Line   int64  `json:"line"`
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason"`
+	Raw    string `json:"raw"`
+}
+
+type ParseErrorsResponse struct {
+	UploadID string              `json:"upload_id"`
+	Status   entity.UploadStatus `json:"status"`
+	ParseErr int64               `json:"parse_err"`
+	Errors   []ParseError        `json:"errors"`
+	page     int
+	pageSize int
+	total    int
+}
+
+// Meta reports the number of recorded errors, which can be lower than
+// ParseErr when the per-upload cap was reached.
+func (r ParseErrorsResponse) Meta() map[string]any {
+	return map[string]any{
+		"page":      r.page,
+		"page_size": r.pageSize,
+		"total":     r.total,
+	}
+}
+
+type WebhookDelivery struct {
+	EventID    string `json:"event_id"`
+	URL        string `json:"url"`
+	Attempt    int    `json:"attempt"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Delivered  bool   `json:"delivered"`
+	At         int64  `json:"at"`
+}
+
+// WebhookDeliveriesResponse lists every delivery attempt of an upload, oldest
+// first.
+type WebhookDeliveriesResponse struct {
+	UploadID   string              `json:"upload_id"`
+	Status     entity.UploadStatus `json:"status"`
+	Deliveries []WebhookDelivery   `json:"deliveries"`
+	page       int
+	pageSize   int
+	total      int
+}
+
+func (r WebhookDeliveriesResponse) Meta() map[string]any {
+	return map[string]any{
+		"page":      r.page,
+		"page_size": r.pageSize,
+		"total":     r.total,
+	}
+}
+
+// ParseErrorEvent is the payload of a parse_error event.
+type ParseErrorEvent struct {
+	UploadID string `json:"upload_id"`
+	ParseError
+}
+
+// SummaryEvent is the payload of the final summary event.
+type SummaryEvent struct {
+	StatementResponse
+	Balances []CurrencyBalance `json:"balances"`
+}
+
 type BalanceResponse struct {
 	UploadID string              `json:"upload_id"`
 	Status   entity.UploadStatus `json:"status"`
-	Balance  int64               `json:"balance"`
+	Balances []CurrencyBalance   `json:"balances"`
+}
+
+type CurrencyBalance struct {
+	Currency string `json:"currency"`
+	Amount   string `json:"amount"`
 }
 
 type TransactionIssuesResponse struct {
@@ -49,3 +181,54 @@ func (r TransactionIssuesResponse) Meta() map[string]any {
 		"total":     r.total,
 	}
 }
+
+type TransactionsResponse struct {
+	UploadID     string              `json:"upload_id"`
+	Status       entity.UploadStatus `json:"status"`
+	Transactions []Transaction       `json:"transactions"`
+	page         int
+	pageSize     int
+	total        int
+}
+
+func (r TransactionsResponse) Meta() map[string]any {
+	return map[string]any{
+		"page":      r.page,
+		"page_size": r.pageSize,
+		"total":     r.total,
+	}
+}
+
+// DeadLetter is a failed-transaction event the reconciliation consumer gave
+// up on.
+type DeadLetter struct {
+	EventID     string      `json:"event_id"`
+	UploadID    string      `json:"upload_id"`
+	Transaction Transaction `json:"transaction"`
+	Attempts    int         `json:"attempts"`
+	Error       string      `json:"error"`
+	FailedAt    int64       `json:"failed_at"`
+}
+
+type DeadLettersResponse struct {
+	DeadLetters []DeadLetter `json:"dead_letters"`
+	page        int
+	pageSize    int
+	total       int
+}
+
+func (r DeadLettersResponse) Meta() map[string]any {
+	return map[string]any{
+		"page":      r.page,
+		"page_size": r.pageSize,
+		"total":     r.total,
+	}
+}
+
+// ReplayResponse lists the replayed event IDs and the dead letters that
+// failed again, with their new error.
+type ReplayResponse struct {
+	Replayed []string     `json:"replayed"`
+	Failed   []DeadLetter `json:"failed"`
+	NotFound []string     `json:"not_found,omitempty"`
+}
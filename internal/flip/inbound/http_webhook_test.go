@@ -0,0 +1,93 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/shandysiswandi/goflip/internal/flip/store"
+	"github.com/shandysiswandi/goflip/internal/flip/usecase"
+	"github.com/shandysiswandi/goflip/internal/flip/webhook"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgrouter"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgroutine"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkguid"
+)
+
+func TestUploadCallbackWebhook(t *testing.T) {
+	received := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !webhook.Verify("secret", r.Header.Get(webhook.HeaderTimestamp), body, r.Header.Get(webhook.HeaderSignature)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		received <- body
+	}))
+	defer receiver.Close()
+
+	storage := store.NewInMemoryStore()
+	dispatcher := webhook.NewDispatcher(webhook.Config{Secret: "secret", AllowPrivateCallbacks: true}, storage, nil)
+	dispatcher.Start()
+
+	runner := pkgroutine.NewManager(10)
+	uc := usecase.New(usecase.Dependency{
+		Store:    storage,
+		Notifier: dispatcher,
+		Runner:   runner,
+		ID:       pkguid.NewUUID(),
+		RootCtx:  context.Background(),
+	})
+
+	router := pkgrouter.NewRouter(pkguid.NewUUID())
+	RegisterHTTPEndpoint(router, uc, Config{})
+
+	target := "/statements?callback_url=" + url.QueryEscape(receiver.URL+"/hook")
+	rec := postUpload(t, router, target, []byte(archiveCSV), http.Header{"Content-Type": {"text/csv"}})
+	uploadID := decodeUploadID(t, rec)
+
+	select {
+	case body := <-received:
+		var payload struct {
+			UploadID string `json:"upload_id"`
+			Status   string `json:"status"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Fatalf("decode payload: %v", err)
+		}
+		if payload.UploadID != uploadID || payload.Status != "DONE" {
+			t.Fatalf("unexpected payload: %s", body)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+
+	if err := runner.Wait(); err != nil {
+		t.Fatalf("runner wait: %v", err)
+	}
+	if err := dispatcher.Stop(context.Background()); err != nil {
+		t.Fatalf("stop dispatcher: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/statements/"+uploadID+"/webhooks", nil)
+	logRec := httptest.NewRecorder()
+	router.ServeHTTP(logRec, req)
+
+	var env envelope[WebhookDeliveriesResponse]
+	if err := json.NewDecoder(logRec.Body).Decode(&env); err != nil {
+		t.Fatalf("decode deliveries: %v", err)
+	}
+	deliveries := env.Data.Deliveries
+	if len(deliveries) != 1 || !deliveries[0].Delivered || deliveries[0].URL != receiver.URL+"/hook" || deliveries[0].StatusCode != http.StatusOK {
+		t.Fatalf("unexpected deliveries: %+v", deliveries)
+	}
+
+	statement := getStatement(t, router, uploadID)
+	if statement.CallbackURL != receiver.URL+"/hook" {
+		t.Fatalf("expected callback url on statement, got %+v", statement)
+	}
+}
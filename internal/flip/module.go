@@ -2,13 +2,19 @@ package flip
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/shandysiswandi/goflip/internal/flip/event"
 	"github.com/shandysiswandi/goflip/internal/flip/inbound"
 	"github.com/shandysiswandi/goflip/internal/flip/store"
 	"github.com/shandysiswandi/goflip/internal/flip/usecase"
+	"github.com/shandysiswandi/goflip/internal/flip/webhook"
 	"github.com/shandysiswandi/goflip/internal/pkg/pkgconfig"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkghealth"
 	"github.com/shandysiswandi/goflip/internal/pkg/pkgrouter"
 	"github.com/shandysiswandi/goflip/internal/pkg/pkgroutine"
 	"github.com/shandysiswandi/goflip/internal/pkg/pkguid"
@@ -20,32 +26,412 @@ type Dependency struct {
 	Router    *pkgrouter.Router
 	Context   context.Context
 	ID        pkguid.StringID
+
+	// Metrics, if set, receives the metrics of the module.
+	Metrics prometheus.Registerer
+	// Health, if set, receives the health checks of the module.
+	Health *pkghealth.Registry
 }
 
 func New(dep Dependency) (func(context.Context) error, error) {
-	storage := store.NewInMemoryStore()
+	storage, closeStore, err := newStore(dep.Config)
+	if err != nil {
+		return nil, err
+	}
+	storage = tracedBackend{next: storage}
+
+	// undo holds what has been started so far, so a failure further down
+	// does not leak the store file or running goroutines.
+	undo := []func(context.Context) error{func(context.Context) error { return closeStore() }}
+	fail := func(err error) (func(context.Context) error, error) {
+		for i := len(undo) - 1; i >= 0; i-- {
+			err = errors.Join(err, undo[i](context.Background()))
+		}
+		return nil, err
+	}
+
+	handler, err := newReconciler(dep.Config)
+	if err != nil {
+		return fail(err)
+	}
+
+	retry, err := newRetryPolicy(dep.Config)
+	if err != nil {
+		return fail(err)
+	}
+
+	dedup, err := newDeduper(dep.Config, storage)
+	if err != nil {
+		return fail(err)
+	}
+
+	backpressure := event.Backpressure(dep.Config.GetString("modules.flip.reconciler.backpressure"))
+	switch backpressure {
+	case "", event.BackpressureBlock, event.BackpressureDropOldest, event.BackpressureError:
+	default:
+		return fail(fmt.Errorf("unknown reconciler backpressure %q", backpressure))
+	}
+
+	partitionBy := event.PartitionKey(dep.Config.GetString("modules.flip.reconciler.partition_by"))
+	switch partitionBy {
+	case event.PartitionNone, event.PartitionByUpload, event.PartitionByCounterparty:
+	default:
+		return fail(fmt.Errorf("unknown reconciler partition_by %q", partitionBy))
+	}
+
 	bus := event.NewBus(512)
-	consumer := event.NewReconciliationConsumer(bus, event.NoopReconciler{}, event.ConsumerConfig{
-		Workers:     4,
-		MaxRetries:  3,
-		BaseBackoff: 200 * time.Millisecond,
+	undo = append(undo, func(context.Context) error {
+		bus.Close()
+		return nil
+	})
+	if dep.Metrics != nil {
+		if err := bus.RegisterMetrics(dep.Metrics); err != nil {
+			return fail(err)
+		}
+	}
+	consumer := event.NewReconciliationConsumer(bus, handler, storage, event.ConsumerConfig{
+		Workers:      int(dep.Config.GetInt("modules.flip.reconciler.workers")),
+		Retry:        retry,
+		Dedup:        dedup,
+		Subscription: event.SubscribeOptions{Backpressure: backpressure},
+		PartitionBy:  partitionBy,
+		Metrics:      event.NewMetrics(dep.Metrics),
 	})
 	consumer.Start()
+	undo = append(undo, consumer.Stop)
 
 	if dep.ID == nil {
 		dep.ID = pkguid.NewUUID()
 	}
 
+	retention, err := newRetentionPolicy(dep.Config)
+	if err != nil {
+		return fail(err)
+	}
+
+	profiles, err := newParseProfiles(dep.Config)
+	if err != nil {
+		return fail(err)
+	}
+
+	loc, err := time.LoadLocation(dep.Config.GetString("tz"))
+	if err != nil {
+		return fail(fmt.Errorf("invalid tz: %w", err))
+	}
+
+	idemWindow, err := parseDuration(dep.Config, "modules.flip.idempotency.window")
+	if err != nil {
+		return fail(err)
+	}
+
+	dispatcher, err := newWebhookDispatcher(dep.Config, storage)
+	if err != nil {
+		return fail(err)
+	}
+
+	var notifier usecase.Notifier
+	stopWebhooks := func(context.Context) error { return nil }
+	if dispatcher != nil {
+		dispatcher.Start()
+		notifier = dispatcher
+		stopWebhooks = dispatcher.Stop
+		undo = append(undo, stopWebhooks)
+	}
+
 	uc := usecase.New(usecase.Dependency{
-		Store:   storage,
-		Events:  bus,
-		Runner:  dep.Goroutine,
-		Clock:   nil,
-		ID:      dep.ID,
-		RootCtx: dep.Context,
+		Store:       storage,
+		Events:      event.NewPublisher(storage, bus),
+		DeadLetters: consumer,
+		Notifier:    notifier,
+		Runner:      dep.Goroutine,
+		Clock:       nil,
+		ID:          dep.ID,
+		RootCtx:     dep.Context,
+		Retention:   retention,
+		Metrics:     usecase.NewMetrics(dep.Metrics),
+
+		KeepTransactions: dep.Config.GetBool("modules.flip.keep_all_transactions"),
+		MaxParseErrors:   int(dep.Config.GetInt("modules.flip.max_parse_errors")),
+		Profiles:         profiles,
+		Location:         loc,
+		ProgressInterval: int(dep.Config.GetInt("modules.flip.progress_interval")),
+
+		IdempotencyWindow: idemWindow,
+		DetectDuplicates:  dep.Config.GetBool("modules.flip.idempotency.content_hash"),
 	})
+	uc.StartJanitor()
+
+	inbound.RegisterHTTPEndpoint(dep.Router, uc, inbound.Config{
+		MaxArchiveSize:      dep.Config.GetInt("modules.flip.compression.max_archive_mb") << 20,
+		MaxDecompressedSize: dep.Config.GetInt("modules.flip.compression.max_decompressed_mb") << 20,
+	})
+
+	if dep.Health != nil {
+		// A closed bus never reopens, so it fails liveness too; a stopped
+		// consumer only matters for readiness during shutdown.
+		dep.Health.AddLiveness("flip.bus", bus.Check)
+		dep.Health.AddReadiness("flip.bus", bus.Check)
+		dep.Health.AddReadiness("flip.consumer", consumer.Check)
+	}
+
+	return func(ctx context.Context) error {
+		bus.Close()
+		return errors.Join(uc.StopJanitor(ctx), consumer.Stop(ctx), stopWebhooks(ctx), closeStore())
+	}, nil
+}
+
+// backend is what the module needs from a store backend: uploads for the
+// usecase, and the failed-transaction outbox and handled event IDs for the
+// event consumer.
+type backend interface {
+	usecase.Store
+	event.Outbox
+	event.HandledStore
+}
+
+func newStore(cfg pkgconfig.Config) (backend, func() error, error) {
+	switch driver := cfg.GetString("modules.flip.store.driver"); driver {
+	case "", "memory":
+		return store.NewInMemoryStore(), func() error { return nil }, nil
+	case "file":
+		fs, err := store.NewFileStore(store.FileStoreConfig{
+			Dir:   cfg.GetString("modules.flip.store.dir"),
+			FSync: cfg.GetBool("modules.flip.store.fsync"),
+
+			CompactAfter: cfg.GetInt("modules.flip.store.compact_after_mb") << 20,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return fs, fs.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown store driver %q", driver)
+	}
+}
+
+// reconcilers builds the failed-transaction handler named by
+// modules.flip.reconciler.handler.
+//
+//nolint:gochecknoglobals // registry of the reconciliation handlers
+var reconcilers = map[string]func(cfg pkgconfig.Config) (event.Handler, error){
+	"noop": func(pkgconfig.Config) (event.Handler, error) {
+		return event.NoopReconciler{}, nil
+	},
+	"http": func(cfg pkgconfig.Config) (event.Handler, error) {
+		timeout, err := parseDuration(cfg, "modules.flip.reconciler.http.timeout")
+		if err != nil {
+			return nil, err
+		}
+
+		return event.NewHTTPReconciler(event.HTTPReconcilerConfig{
+			URL:     strings.TrimSpace(cfg.GetString("modules.flip.reconciler.http.url")),
+			Token:   cfg.GetString("modules.flip.reconciler.http.token"),
+			Timeout: timeout,
+		}, nil)
+	},
+}
+
+func newReconciler(cfg pkgconfig.Config) (event.Handler, error) {
+	name := strings.TrimSpace(cfg.GetString("modules.flip.reconciler.handler"))
+	if name == "" {
+		name = "noop"
+	}
+
+	build, ok := reconcilers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown reconciler handler %q", name)
+	}
+
+	return build(cfg)
+}
+
+// newDeduper keeps handled event IDs in memory, or in the store when
+// modules.flip.reconciler.dedup.persist is set, which with the file store
+// catches duplicates across restarts.
+func newDeduper(cfg pkgconfig.Config, storage event.HandledStore) (event.Deduper, error) {
+	ttl, err := parseDuration(cfg, "modules.flip.reconciler.dedup.ttl")
+	if err != nil {
+		return nil, err
+	}
 
-	inbound.RegisterHTTPEndpoint(dep.Router, uc)
+	if cfg.GetBool("modules.flip.reconciler.dedup.persist") {
+		return event.NewStoreDeduper(storage, ttl), nil
+	}
+
+	return event.NewMemoryDeduper(int(cfg.GetInt("modules.flip.reconciler.dedup.size")), ttl), nil
+}
+
+// newRetryPolicy reads modules.flip.reconciler.retry. max_retries 0 uses the
+// default of 3, negative disables retries.
+func newRetryPolicy(cfg pkgconfig.Config) (event.RetryPolicy, error) {
+	policy := event.RetryPolicy{
+		MaxRetries: int(cfg.GetInt("modules.flip.reconciler.retry.max_retries")),
+		Jitter:     event.Jitter(cfg.GetString("modules.flip.reconciler.retry.jitter")),
+	}
+	if policy.MaxRetries == 0 {
+		policy.MaxRetries = 3
+	}
+
+	switch policy.Jitter {
+	case "", event.JitterNone, event.JitterFull, event.JitterDecorrelated:
+	default:
+		return policy, fmt.Errorf("unknown retry jitter %q", policy.Jitter)
+	}
+
+	var err error
+	if policy.BaseBackoff, err = parseDuration(cfg, "modules.flip.reconciler.retry.base_backoff"); err != nil {
+		return policy, err
+	}
+	if policy.MaxBackoff, err = parseDuration(cfg, "modules.flip.reconciler.retry.max_backoff"); err != nil {
+		return policy, err
+	}
+	if policy.MaxElapsed, err = parseDuration(cfg, "modules.flip.reconciler.retry.max_elapsed"); err != nil {
+		return policy, err
+	}
+	if policy.BaseBackoff == 0 {
+		policy.BaseBackoff = 200 * time.Millisecond
+	}
+
+	return policy, nil
+}
+
+func newRetentionPolicy(cfg pkgconfig.Config) (usecase.RetentionPolicy, error) {
+	policy := usecase.RetentionPolicy{
+		MaxUploads: int(cfg.GetInt("modules.flip.retention.max_uploads")),
+	}
+
+	var err error
+	if policy.MaxAge, err = parseDuration(cfg, "modules.flip.retention.max_age"); err != nil {
+		return policy, err
+	}
+	if policy.Interval, err = parseDuration(cfg, "modules.flip.retention.interval"); err != nil {
+		return policy, err
+	}
+
+	return policy, nil
+}
+
+// newWebhookDispatcher returns nil when no webhook secret is configured, which
+// disables webhooks including per-upload callback URLs.
+func newWebhookDispatcher(cfg pkgconfig.Config, storage usecase.Store) (*webhook.Dispatcher, error) {
+	var urls []string
+	for _, raw := range cfg.GetArray("modules.flip.webhooks.urls") {
+		if raw = strings.TrimSpace(raw); raw != "" {
+			urls = append(urls, raw)
+		}
+	}
+
+	secret := cfg.GetString("modules.flip.webhooks.secret")
+	if secret == "" {
+		if len(urls) > 0 {
+			return nil, errors.New("modules.flip.webhooks.secret is required when webhook urls are configured")
+		}
+		return nil, nil
+	}
+
+	wcfg := webhook.Config{
+		URLs:        urls,
+		Secret:      secret,
+		MaxAttempts: int(cfg.GetInt("modules.flip.webhooks.max_attempts")),
+		Workers:     int(cfg.GetInt("modules.flip.webhooks.workers")),
+
+		AllowPrivateCallbacks: cfg.GetBool("modules.flip.webhooks.allow_private_callbacks"),
+	}
+
+	var err error
+	if wcfg.BaseBackoff, err = parseDuration(cfg, "modules.flip.webhooks.base_backoff"); err != nil {
+		return nil, err
+	}
+	if wcfg.MaxBackoff, err = parseDuration(cfg, "modules.flip.webhooks.max_backoff"); err != nil {
+		return nil, err
+	}
+	if wcfg.Timeout, err = parseDuration(cfg, "modules.flip.webhooks.timeout"); err != nil {
+		return nil, err
+	}
+
+	return webhook.NewDispatcher(wcfg, storage, nil), nil
+}
+
+// newParseProfiles reads every profile listed in modules.flip.parsing.profiles
+// from modules.flip.parsing.<name>.
+func newParseProfiles(cfg pkgconfig.Config) ([]usecase.ParseProfile, error) {
+	var profiles []usecase.ParseProfile
+	for _, name := range cfg.GetArray("modules.flip.parsing.profiles") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		prefix := "modules.flip.parsing." + name
+		profile := usecase.ParseProfile{
+			Name:              name,
+			SkipHeader:        cfg.GetBool(prefix + ".skip_header"),
+			AllowExtraColumns: cfg.GetBool(prefix + ".allow_extra_columns"),
+		}
+
+		if raw := cfg.GetString(prefix + ".columns"); raw != "" {
+			profile.Columns = strings.Split(raw, ",")
+		}
+
+		if raw := cfg.GetString(prefix + ".header_names"); raw != "" {
+			profile.HeaderNames = make(map[string]string)
+			for column, label := range cfg.GetMap(prefix + ".header_names") {
+				profile.HeaderNames[strings.ToLower(strings.TrimSpace(column))] = strings.TrimSpace(label)
+			}
+		}
+
+		var err error
+		if profile.Delimiter, err = parseSeparator(cfg, prefix+".delimiter", ','); err != nil {
+			return nil, err
+		}
+		if profile.ThousandsSeparator, err = parseSeparator(cfg, prefix+".thousands_separator", 0); err != nil {
+			return nil, err
+		}
+		if profile.DecimalSeparator, err = parseSeparator(cfg, prefix+".decimal_separator", '.'); err != nil {
+			return nil, err
+		}
+		profile.Currency = strings.TrimSpace(cfg.GetString(prefix + ".currency"))
+		profile.TimestampFormat = cfg.GetString(prefix + ".timestamp_format")
+
+		if err := profile.Validate(); err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, nil
+}
+
+// parseSeparator reads a single character, or "tab"/"space" for whitespace.
+func parseSeparator(cfg pkgconfig.Config, key string, fallback rune) (rune, error) {
+	raw := cfg.GetString(key)
+	switch raw {
+	case "":
+		return fallback, nil
+	case "tab", `\t`:
+		return '\t', nil
+	case "space":
+		return ' ', nil
+	}
+
+	runes := []rune(raw)
+	if len(runes) != 1 {
+		return 0, fmt.Errorf("invalid %s: expected a single character, got %q", key, raw)
+	}
+
+	return runes[0], nil
+}
+
+func parseDuration(cfg pkgconfig.Config, key string) (time.Duration, error) {
+	raw := cfg.GetString(key)
+	if raw == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
 
-	return consumer.Stop, nil
+	return d, nil
 }
@@ -0,0 +1,181 @@
+package store
+
+import (
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/flip/usecase"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgdecimal"
+)
+
+// txChunkSize is the number of rows per chunk. Growing the table allocates a
+// new fixed-size chunk instead of reallocating one big slice.
+const txChunkSize = 4096
+
+// txTable stores transactions column by column in fixed-size chunks.
+//
+// Enum columns are kept as single bytes; counterparties and currencies are
+// interned per upload, since a statement usually repeats a handful of them.
+type txTable struct {
+	chunks         []*txChunk
+	counterparties stringPool
+	currencies     stringPool
+	rows           int
+}
+
+type txChunk struct {
+	timestamps     []int64
+	amounts        []int64
+	counterparties []uint32
+	currencies     []uint32
+	types          []uint8
+	statuses       []uint8
+	descriptions   []string
+}
+
+// stringPool hands out a stable index per distinct string.
+type stringPool struct {
+	values []string
+	index  map[string]uint32
+}
+
+func (p *stringPool) intern(value string) uint32 {
+	if p.index == nil {
+		p.index = make(map[string]uint32)
+	}
+
+	idx, ok := p.index[value]
+	if !ok {
+		idx = uint32(len(p.values)) //nolint:gosec // bounded by the number of rows in an upload
+		p.values = append(p.values, value)
+		p.index[value] = idx
+	}
+	return idx
+}
+
+func (p *stringPool) get(idx uint32) string {
+	return p.values[idx]
+}
+
+//nolint:gochecknoglobals // lookup tables for the enum columns
+var (
+	txTypeCodes   = []entity.TxType{entity.TxTypeCredit, entity.TxTypeDebit}
+	txStatusCodes = []entity.TxStatus{entity.TxStatusSuccess, entity.TxStatusFailed, entity.TxStatusPending}
+)
+
+func newTxChunk() *txChunk {
+	return &txChunk{
+		timestamps:     make([]int64, 0, txChunkSize),
+		amounts:        make([]int64, 0, txChunkSize),
+		counterparties: make([]uint32, 0, txChunkSize),
+		currencies:     make([]uint32, 0, txChunkSize),
+		types:          make([]uint8, 0, txChunkSize),
+		statuses:       make([]uint8, 0, txChunkSize),
+		descriptions:   make([]string, 0, txChunkSize),
+	}
+}
+
+func (t *txTable) len() int {
+	if t == nil {
+		return 0
+	}
+	return t.rows
+}
+
+func (t *txTable) append(txs []entity.Transaction) {
+	for _, tx := range txs {
+		var chunk *txChunk
+		if n := len(t.chunks); n > 0 && len(t.chunks[n-1].timestamps) < txChunkSize {
+			chunk = t.chunks[n-1]
+		} else {
+			chunk = newTxChunk()
+			t.chunks = append(t.chunks, chunk)
+		}
+
+		chunk.timestamps = append(chunk.timestamps, tx.Timestamp)
+		chunk.amounts = append(chunk.amounts, tx.Amount.Units())
+		chunk.counterparties = append(chunk.counterparties, t.counterparties.intern(tx.Counterparty))
+		chunk.currencies = append(chunk.currencies, t.currencies.intern(tx.Currency))
+		chunk.types = append(chunk.types, encodeEnum(txTypeCodes, tx.Type))
+		chunk.statuses = append(chunk.statuses, encodeEnum(txStatusCodes, tx.Status))
+		chunk.descriptions = append(chunk.descriptions, tx.Description)
+		t.rows++
+	}
+}
+
+func (t *txTable) row(chunk *txChunk, i int) entity.Transaction {
+	return entity.Transaction{
+		Timestamp:    chunk.timestamps[i],
+		Counterparty: t.counterparties.get(chunk.counterparties[i]),
+		Type:         txTypeCodes[chunk.types[i]],
+		Amount:       pkgdecimal.FromUnits(chunk.amounts[i]),
+		Currency:     t.currencies.get(chunk.currencies[i]),
+		Status:       txStatusCodes[chunk.statuses[i]],
+		Description:  chunk.descriptions[i],
+	}
+}
+
+// each calls fn for every row in insertion order until fn returns false.
+func (t *txTable) each(fn func(tx entity.Transaction) bool) {
+	if t == nil {
+		return
+	}
+
+	for _, chunk := range t.chunks {
+		for i := range chunk.timestamps {
+			if !fn(t.row(chunk, i)) {
+				return
+			}
+		}
+	}
+}
+
+// page returns the rows matching filter on the given page plus the total
+// number of matching rows.
+func (t *txTable) page(filter usecase.IssueFilter, page, pageSize int) ([]entity.Transaction, int) {
+	total := 0
+	start := (page - 1) * pageSize
+	end := start + pageSize
+	items := make([]entity.Transaction, 0, pageSize)
+
+	t.each(func(tx entity.Transaction) bool {
+		if !filter.Matches(tx) {
+			return true
+		}
+		if total >= start && total < end {
+			items = append(items, tx)
+		}
+		total++
+		return true
+	})
+
+	return items, total
+}
+
+// eachChunk calls fn with the rows of every chunk in order, stopping at the
+// first error. The slice is reused between calls, so fn must not keep it.
+func (t *txTable) eachChunk(fn func(rows []entity.Transaction) error) error {
+	if t == nil {
+		return nil
+	}
+
+	var rows []entity.Transaction
+	for _, chunk := range t.chunks {
+		rows = rows[:0]
+		for i := range chunk.timestamps {
+			rows = append(rows, t.row(chunk, i))
+		}
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeEnum[T comparable](codes []T, value T) uint8 {
+	for i, code := range codes {
+		if code == value {
+			return uint8(i)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,549 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/flip/usecase"
+)
+
+const fileStoreLogName = "uploads.log"
+
+// DefaultCompactAfter is the number of bytes appended to the log after which
+// it is compacted, when FileStoreConfig.CompactAfter is zero.
+const DefaultCompactAfter int64 = 64 << 20
+
+// errInterrupted is recorded on uploads that were still running when the
+// process stopped.
+const errInterrupted = "interrupted by restart"
+
+const (
+	opCreate    = "create"
+	opMeta      = "meta"
+	opResults   = "results"
+	opDelete    = "delete"
+	opTxs       = "txs"
+	opParseErrs = "parse_errors"
+	opWebhooks  = "webhooks"
+	opClaim     = "claim"
+
+	opOutbox           = "outbox"
+	opAck              = "ack"
+	opDeadLetter       = "dead_letter"
+	opDeleteDeadLetter = "delete_dead_letter"
+	opHandled          = "handled"
+)
+
+// FileStore is a durable usecase.Store.
+//
+// It keeps an InMemoryStore as the read model and appends every mutation to a
+// JSON-lines log under the data directory. The log is replayed on open and
+// rewritten as a compact snapshot, and again whenever CompactAfter bytes were
+// appended since, so it does not grow without bound while running.
+//
+// Uploads that were still queued or processing when the log was written are
+// marked FAILED on open, since nothing will finish them anymore.
+type FileStore struct {
+	mem   *InMemoryStore
+	mu    sync.Mutex // serializes mutations so the log order matches the apply order
+	path  string
+	file  *os.File
+	fsync bool
+
+	compactAfter int64
+	appended     int64 // bytes appended since the last compaction
+}
+
+type FileStoreConfig struct {
+	Dir   string
+	FSync bool
+
+	// CompactAfter is the number of bytes appended to the log after which it
+	// is compacted. Zero uses DefaultCompactAfter, negative compacts only on
+	// open.
+	CompactAfter int64
+}
+
+type logRecord struct {
+	Op        string                   `json:"op"`
+	UploadID  string                   `json:"upload_id"`
+	Meta      *entity.UploadMeta       `json:"meta,omitempty"`
+	Balances  entity.Balances          `json:"balances,omitempty"`
+	Issues    []entity.Transaction     `json:"issues,omitempty"`
+	Txs       []entity.Transaction     `json:"txs,omitempty"`
+	ParseErrs []entity.ParseError      `json:"parse_errors,omitempty"`
+	Webhooks  []entity.WebhookDelivery `json:"webhooks,omitempty"`
+	Key       string                   `json:"key,omitempty"`
+	ExpiresAt int64                    `json:"expires_at,omitempty"`
+
+	EventID    string                `json:"event_id,omitempty"`
+	Event      *entity.FailedTxEvent `json:"event,omitempty"`
+	DeadLetter *entity.DeadLetter    `json:"dead_letter,omitempty"`
+}
+
+func NewFileStore(cfg FileStoreConfig) (*FileStore, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("store: data directory is required")
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("store: create data directory: %w", err)
+	}
+
+	path := filepath.Join(cfg.Dir, fileStoreLogName)
+	mem := NewInMemoryStore()
+	if err := replayLog(path, mem); err != nil {
+		return nil, err
+	}
+
+	if ids := mem.failInterrupted(time.Now().Unix()); len(ids) > 0 {
+		slog.Warn("uploads interrupted by restart marked as failed", "count", len(ids), "upload_ids", ids)
+	}
+
+	if err := compactLog(path, mem); err != nil {
+		return nil, err
+	}
+
+	file, err := openLog(path)
+	if err != nil {
+		return nil, err
+	}
+
+	compactAfter := cfg.CompactAfter
+	if compactAfter == 0 {
+		compactAfter = DefaultCompactAfter
+	}
+
+	return &FileStore{
+		mem:          mem,
+		path:         path,
+		file:         file,
+		fsync:        cfg.FSync,
+		compactAfter: compactAfter,
+	}, nil
+}
+
+func (s *FileStore) CreateUpload(ctx context.Context, meta entity.UploadMeta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.mem.CreateUpload(ctx, meta); err != nil {
+		return err
+	}
+
+	return s.append(logRecord{Op: opCreate, UploadID: meta.ID, Meta: &meta})
+}
+
+func (s *FileStore) UpdateMeta(ctx context.Context, uploadID string, fn func(meta *entity.UploadMeta)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var snapshot entity.UploadMeta
+	if err := s.mem.UpdateMeta(ctx, uploadID, func(meta *entity.UploadMeta) {
+		fn(meta)
+		snapshot = *meta
+	}); err != nil {
+		return err
+	}
+
+	return s.append(logRecord{Op: opMeta, UploadID: uploadID, Meta: &snapshot})
+}
+
+func (s *FileStore) SaveResults(ctx context.Context, uploadID string, balances entity.Balances, issues []entity.Transaction, totalLines, parsedOK, parseErr int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.mem.SaveResults(ctx, uploadID, balances, issues, totalLines, parsedOK, parseErr); err != nil {
+		return err
+	}
+
+	_, meta, err := s.mem.GetBalance(ctx, uploadID)
+	if err != nil {
+		return err
+	}
+
+	return s.append(logRecord{Op: opResults, UploadID: uploadID, Meta: &meta, Balances: balances, Issues: issues})
+}
+
+func (s *FileStore) AppendTransactions(ctx context.Context, uploadID string, txs []entity.Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.mem.AppendTransactions(ctx, uploadID, txs); err != nil {
+		return err
+	}
+
+	return s.append(logRecord{Op: opTxs, UploadID: uploadID, Txs: txs})
+}
+
+func (s *FileStore) ListTransactions(ctx context.Context, uploadID string, filter usecase.IssueFilter, page, pageSize int) ([]entity.Transaction, int, entity.UploadMeta, error) {
+	return s.mem.ListTransactions(ctx, uploadID, filter, page, pageSize)
+}
+
+func (s *FileStore) AppendParseErrors(ctx context.Context, uploadID string, errs []entity.ParseError) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.mem.AppendParseErrors(ctx, uploadID, errs); err != nil {
+		return err
+	}
+
+	return s.append(logRecord{Op: opParseErrs, UploadID: uploadID, ParseErrs: errs})
+}
+
+func (s *FileStore) ListParseErrors(ctx context.Context, uploadID string, page, pageSize int) ([]entity.ParseError, int, entity.UploadMeta, error) {
+	return s.mem.ListParseErrors(ctx, uploadID, page, pageSize)
+}
+
+func (s *FileStore) AppendWebhookDeliveries(ctx context.Context, uploadID string, deliveries []entity.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.mem.AppendWebhookDeliveries(ctx, uploadID, deliveries); err != nil {
+		return err
+	}
+
+	return s.append(logRecord{Op: opWebhooks, UploadID: uploadID, Webhooks: deliveries})
+}
+
+func (s *FileStore) ListWebhookDeliveries(ctx context.Context, uploadID string, page, pageSize int) ([]entity.WebhookDelivery, int, entity.UploadMeta, error) {
+	return s.mem.ListWebhookDeliveries(ctx, uploadID, page, pageSize)
+}
+
+func (s *FileStore) ClaimKey(ctx context.Context, key, uploadID string, now, expiresAt int64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	owner, err := s.mem.ClaimKey(ctx, key, uploadID, now, expiresAt)
+	if err != nil || owner != uploadID {
+		return owner, err
+	}
+
+	return owner, s.append(logRecord{Op: opClaim, UploadID: uploadID, Key: key, ExpiresAt: expiresAt})
+}
+
+func (s *FileStore) DeleteUpload(ctx context.Context, uploadID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.mem.DeleteUpload(ctx, uploadID); err != nil {
+		return err
+	}
+
+	return s.append(logRecord{Op: opDelete, UploadID: uploadID})
+}
+
+func (s *FileStore) PruneUploads(ctx context.Context, endedBefore int64, maxUploads int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evicted, err := s.mem.PruneUploads(ctx, endedBefore, maxUploads)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range evicted {
+		if err := s.append(logRecord{Op: opDelete, UploadID: id}); err != nil {
+			return evicted, err
+		}
+	}
+
+	return evicted, nil
+}
+
+func (s *FileStore) GetBalance(ctx context.Context, uploadID string) (entity.Balances, entity.UploadMeta, error) {
+	return s.mem.GetBalance(ctx, uploadID)
+}
+
+func (s *FileStore) ListUploads(ctx context.Context, filter usecase.UploadFilter, page, pageSize int) ([]entity.UploadMeta, int, error) {
+	return s.mem.ListUploads(ctx, filter, page, pageSize)
+}
+
+func (s *FileStore) ListIssues(ctx context.Context, uploadID string, filter usecase.IssueFilter, page, pageSize int) ([]entity.Transaction, int, entity.UploadMeta, error) {
+	return s.mem.ListIssues(ctx, uploadID, filter, page, pageSize)
+}
+
+// Close flushes and closes the underlying log file.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := errors.Join(s.file.Sync(), s.file.Close())
+	s.file = nil
+
+	return err
+}
+
+func (s *FileStore) append(rec logRecord) error {
+	if s.file == nil {
+		return errors.New("store: file store is closed")
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("store: encode log record: %w", err)
+	}
+
+	n, err := s.file.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("store: write log record: %w", err)
+	}
+
+	if s.fsync {
+		if err := s.file.Sync(); err != nil {
+			return fmt.Errorf("store: sync log: %w", err)
+		}
+	}
+
+	s.appended += int64(n)
+	if s.compactAfter > 0 && s.appended >= s.compactAfter {
+		return s.compact()
+	}
+
+	return nil
+}
+
+// compact rewrites the log as a snapshot of the read model. It must be called
+// with s.mu held.
+func (s *FileStore) compact() error {
+	s.appended = 0
+
+	// The record that triggered compaction is already durable, so if the
+	// snapshot cannot be written the old log is kept until the next threshold.
+	if err := compactLog(s.path, s.mem); err != nil {
+		slog.Error("failed to compact store log", "path", s.path, "error", err)
+		return nil
+	}
+
+	// The old handle points at the replaced file, so writing through it
+	// would lose records: the store is closed instead.
+	_ = s.file.Close()
+	s.file = nil
+
+	file, err := openLog(s.path)
+	if err != nil {
+		return err
+	}
+	s.file = file
+
+	return nil
+}
+
+func openLog(path string) (*os.File, error) {
+	//nolint:gosec // path is built from operator configuration
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("store: open log: %w", err)
+	}
+
+	return file, nil
+}
+
+func replayLog(path string, mem *InMemoryStore) error {
+	//nolint:gosec // path is built from operator configuration
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("store: open log for replay: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	reader := bufio.NewReader(file)
+	for lineNo := 1; ; lineNo++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return fmt.Errorf("store: read log: %w", readErr)
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			var rec logRecord
+			if err := json.Unmarshal(line, &rec); err != nil {
+				// A torn write at the tail is expected after a crash; anything
+				// earlier means the log was corrupted.
+				if errors.Is(readErr, io.EOF) {
+					return nil
+				}
+				return fmt.Errorf("store: decode log line %d: %w", lineNo, err)
+			}
+			mem.apply(rec)
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			return nil
+		}
+	}
+}
+
+func compactLog(path string, mem *InMemoryStore) error {
+	tmpPath := path + ".tmp"
+
+	//nolint:gosec // path is built from operator configuration
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("store: create compacted log: %w", err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	if err := mem.snapshot(func(rec logRecord) error { return encoder.Encode(rec) }); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("store: write compacted log: %w", err)
+	}
+
+	if err := errors.Join(writer.Flush(), tmp.Sync(), tmp.Close()); err != nil {
+		return fmt.Errorf("store: flush compacted log: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("store: replace log: %w", err)
+	}
+
+	return nil
+}
+
+// apply replays a single log record onto the in-memory read model.
+func (s *InMemoryStore) apply(rec logRecord) {
+	if s.applyOutbox(rec) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch rec.Op {
+	case opCreate:
+		if rec.Meta != nil {
+			s.uploads[rec.UploadID] = &uploadRecord{meta: *rec.Meta}
+		}
+	case opMeta:
+		if r, ok := s.uploads[rec.UploadID]; ok && rec.Meta != nil {
+			r.meta = *rec.Meta
+		}
+	case opResults:
+		if r, ok := s.uploads[rec.UploadID]; ok {
+			r.balances = rec.Balances
+			r.issues = rec.Issues
+			if rec.Meta != nil {
+				r.meta = *rec.Meta
+			}
+		}
+	case opTxs:
+		if r, ok := s.uploads[rec.UploadID]; ok {
+			r.txs.append(rec.Txs)
+		}
+	case opParseErrs:
+		if r, ok := s.uploads[rec.UploadID]; ok {
+			r.parseErrs = append(r.parseErrs, rec.ParseErrs...)
+		}
+	case opWebhooks:
+		if r, ok := s.uploads[rec.UploadID]; ok {
+			r.webhooks = append(r.webhooks, rec.Webhooks...)
+		}
+	case opClaim:
+		// Only winning claims are logged, so the log order already settled
+		// ownership and a later claim always replaces an earlier one.
+		if r, ok := s.uploads[rec.UploadID]; ok {
+			s.setClaim(r, rec.Key, rec.UploadID, rec.ExpiresAt)
+		}
+	case opDelete:
+		s.remove(rec.UploadID)
+	}
+}
+
+// failInterrupted marks every upload that is not final as FAILED, and returns
+// their IDs sorted.
+func (s *InMemoryStore) failInterrupted(now int64) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []string
+	for id, r := range s.uploads {
+		r.mu.Lock()
+		if !r.meta.Status.IsFinal() {
+			r.meta.Status = entity.UploadStatusFailed
+			r.meta.Err = errInterrupted
+			r.meta.EndedAt = now
+			ids = append(ids, id)
+		}
+		r.mu.Unlock()
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// snapshot passes emit the minimal set of log records that rebuilds the
+// store, one at a time so the transaction history is never copied whole.
+func (s *InMemoryStore) snapshot(emit func(rec logRecord) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for id, r := range s.uploads {
+		if err := s.snapshotUpload(id, r, emit); err != nil {
+			return err
+		}
+	}
+
+	return s.outboxSnapshot(emit)
+}
+
+// snapshotUpload emits the records of one upload. Callers hold s.mu.
+func (s *InMemoryStore) snapshotUpload(id string, r *uploadRecord, emit func(rec logRecord) error) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	meta := r.meta
+	if err := emit(logRecord{Op: opCreate, UploadID: id, Meta: &meta}); err != nil {
+		return err
+	}
+	if len(r.balances) > 0 || len(r.issues) > 0 {
+		if err := emit(logRecord{Op: opResults, UploadID: id, Balances: r.balances, Issues: r.issues}); err != nil {
+			return err
+		}
+	}
+	if err := r.txs.eachChunk(func(txs []entity.Transaction) error {
+		return emit(logRecord{Op: opTxs, UploadID: id, Txs: txs})
+	}); err != nil {
+		return err
+	}
+	if len(r.parseErrs) > 0 {
+		if err := emit(logRecord{Op: opParseErrs, UploadID: id, ParseErrs: r.parseErrs}); err != nil {
+			return err
+		}
+	}
+	if len(r.webhooks) > 0 {
+		if err := emit(logRecord{Op: opWebhooks, UploadID: id, Webhooks: r.webhooks}); err != nil {
+			return err
+		}
+	}
+	for _, key := range r.keys {
+		if claim := s.keys[key]; claim.uploadID == id {
+			if err := emit(logRecord{Op: opClaim, UploadID: id, Key: key, ExpiresAt: claim.expiresAt}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,466 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/flip/store/storetest"
+	"github.com/shandysiswandi/goflip/internal/flip/usecase"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgdecimal"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgerror"
+)
+
+func newTestFileStore(t *testing.T, dir string) *FileStore {
+	t.Helper()
+
+	fs, err := NewFileStore(FileStoreConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("NewFileStore() err = %v", err)
+	}
+	t.Cleanup(func() {
+		_ = fs.Close()
+	})
+
+	return fs
+}
+
+func TestFileStore_Contract(t *testing.T) {
+	t.Parallel()
+
+	storetest.Run(t, func(t *testing.T) usecase.Store {
+		return newTestFileStore(t, t.TempDir())
+	})
+	storetest.RunDurable(t, func(t *testing.T) usecase.Store {
+		return newTestFileStore(t, t.TempDir())
+	}, func(t *testing.T, s usecase.Store) usecase.Store {
+		fs, ok := s.(*FileStore)
+		if !ok {
+			t.Fatalf("unexpected store %T", s)
+		}
+		if err := fs.Close(); err != nil {
+			t.Fatalf("Close() err = %v", err)
+		}
+		return newTestFileStore(t, filepath.Dir(fs.path))
+	})
+}
+
+func TestNewFileStore_RequiresDir(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewFileStore(FileStoreConfig{}); err == nil {
+		t.Fatal("NewFileStore() expected error for empty dir, got nil")
+	}
+}
+
+func TestFileStore_SurvivesRestart(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := newTestFileStore(t, dir)
+
+	meta := entity.UploadMeta{ID: "upload-1", Status: entity.UploadStatusQueued}
+	if err := store.CreateUpload(ctx, meta); err != nil {
+		t.Fatalf("CreateUpload() err = %v", err)
+	}
+	if err := store.UpdateMeta(ctx, meta.ID, func(m *entity.UploadMeta) {
+		m.Status = entity.UploadStatusProcessing
+		m.StartedAt = 10
+	}); err != nil {
+		t.Fatalf("UpdateMeta() err = %v", err)
+	}
+
+	issues := []entity.Transaction{
+		{Timestamp: 2, Counterparty: "B", Type: entity.TxTypeDebit, Amount: pkgdecimal.MustParse("50"), Currency: "IDR", Status: entity.TxStatusFailed, Description: "fail"},
+		{Timestamp: 3, Counterparty: "C", Type: entity.TxTypeCredit, Amount: pkgdecimal.MustParse("70"), Currency: "IDR", Status: entity.TxStatusPending, Description: "pending"},
+	}
+	if err := store.AppendTransactions(ctx, meta.ID, issues); err != nil {
+		t.Fatalf("AppendTransactions() err = %v", err)
+	}
+	if err := store.SaveResults(ctx, meta.ID, entity.Balances{"IDR": pkgdecimal.MustParse("250.75")}, issues, 3, 3, 0); err != nil {
+		t.Fatalf("SaveResults() err = %v", err)
+	}
+	if err := store.UpdateMeta(ctx, meta.ID, func(m *entity.UploadMeta) {
+		m.Status = entity.UploadStatusDone
+		m.EndedAt = 20
+	}); err != nil {
+		t.Fatalf("UpdateMeta() err = %v", err)
+	}
+	deliveries := []entity.WebhookDelivery{{EventID: "evt-1", URL: "http://a.test/hook", Attempt: 1, StatusCode: 200, Delivered: true, At: 21}}
+	if err := store.AppendWebhookDeliveries(ctx, meta.ID, deliveries); err != nil {
+		t.Fatalf("AppendWebhookDeliveries() err = %v", err)
+	}
+	if _, err := store.ClaimKey(ctx, "idempotency:retry-1", meta.ID, 20, 100); err != nil {
+		t.Fatalf("ClaimKey() err = %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() err = %v", err)
+	}
+
+	reopened := newTestFileStore(t, dir)
+
+	balance, gotMeta, err := reopened.GetBalance(ctx, meta.ID)
+	if err != nil {
+		t.Fatalf("GetBalance() err = %v", err)
+	}
+	if want := (entity.Balances{"IDR": pkgdecimal.MustParse("250.75")}); !reflect.DeepEqual(balance, want) {
+		t.Fatalf("GetBalance() balance = %v, want %v", balance, want)
+	}
+	want := entity.UploadMeta{
+		ID:         meta.ID,
+		Status:     entity.UploadStatusDone,
+		StartedAt:  10,
+		EndedAt:    20,
+		TotalLines: 3,
+		ParsedOK:   3,
+	}
+	if !reflect.DeepEqual(gotMeta, want) {
+		t.Fatalf("GetBalance() meta = %+v, want %+v", gotMeta, want)
+	}
+
+	got, total, _, err := reopened.ListIssues(ctx, meta.ID, usecase.IssueFilter{}, 1, 10)
+	if err != nil {
+		t.Fatalf("ListIssues() err = %v", err)
+	}
+	if total != 2 || !reflect.DeepEqual(got, issues) {
+		t.Fatalf("ListIssues() = %+v (total %d), want %+v", got, total, issues)
+	}
+
+	got, total, _, err = reopened.ListTransactions(ctx, meta.ID, usecase.IssueFilter{}, 1, 10)
+	if err != nil {
+		t.Fatalf("ListTransactions() err = %v", err)
+	}
+	if total != 2 || !reflect.DeepEqual(got, issues) {
+		t.Fatalf("ListTransactions() = %+v (total %d), want %+v", got, total, issues)
+	}
+
+	gotDeliveries, _, _, err := reopened.ListWebhookDeliveries(ctx, meta.ID, 1, 10)
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries() err = %v", err)
+	}
+	if !reflect.DeepEqual(gotDeliveries, deliveries) {
+		t.Fatalf("ListWebhookDeliveries() = %+v, want %+v", gotDeliveries, deliveries)
+	}
+
+	if err := reopened.CreateUpload(ctx, entity.UploadMeta{ID: "upload-2"}); err != nil {
+		t.Fatalf("CreateUpload() err = %v", err)
+	}
+	if owner, err := reopened.ClaimKey(ctx, "idempotency:retry-1", "upload-2", 30, 110); err != nil || owner != meta.ID {
+		t.Fatalf("ClaimKey() after restart = %q, %v, want %q", owner, err, meta.ID)
+	}
+
+	err = reopened.CreateUpload(ctx, meta)
+	var perr *pkgerror.Error
+	if !errors.As(err, &perr) || perr.Code() != pkgerror.CodeConflict {
+		t.Fatalf("CreateUpload() after restart err = %v, want conflict", err)
+	}
+}
+
+func TestFileStore_OutboxSurvivesRestart(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := newTestFileStore(t, dir)
+
+	pending := entity.FailedTxEvent{EventID: "evt-1", UploadID: "upload-1"}
+	handled := entity.FailedTxEvent{EventID: "evt-2", UploadID: "upload-1"}
+	letter := entity.DeadLetter{Event: entity.FailedTxEvent{EventID: "evt-3", UploadID: "upload-2"}, Attempts: 4, Err: "boom", FailedAt: 30}
+	for _, e := range []entity.FailedTxEvent{pending, handled, letter.Event} {
+		if err := store.AppendOutbox(ctx, e); err != nil {
+			t.Fatalf("AppendOutbox() err = %v", err)
+		}
+	}
+	if err := store.AckOutbox(ctx, handled.EventID); err != nil {
+		t.Fatalf("AckOutbox() err = %v", err)
+	}
+	if err := store.SaveDeadLetter(ctx, letter); err != nil {
+		t.Fatalf("SaveDeadLetter() err = %v", err)
+	}
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	if err := store.MarkHandled(ctx, handled.EventID, expiresAt); err != nil {
+		t.Fatalf("MarkHandled() err = %v", err)
+	}
+	if err := store.MarkHandled(ctx, "evt-expired", time.Now().Add(-time.Hour).Unix()); err != nil {
+		t.Fatalf("MarkHandled() expired err = %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() err = %v", err)
+	}
+
+	reopened := newTestFileStore(t, dir)
+
+	got, err := reopened.PendingOutbox(ctx)
+	if err != nil || !reflect.DeepEqual(got, []entity.FailedTxEvent{pending}) {
+		t.Fatalf("PendingOutbox() after restart = %+v, %v", got, err)
+	}
+	letters, _, err := reopened.ListDeadLetters(ctx, 1, 10)
+	if err != nil || !reflect.DeepEqual(letters, []entity.DeadLetter{letter}) {
+		t.Fatalf("ListDeadLetters() after restart = %+v, %v", letters, err)
+	}
+	if ok, err := reopened.IsHandled(ctx, handled.EventID, time.Now().Unix()); err != nil || !ok {
+		t.Fatalf("IsHandled() after restart = %v, %v", ok, err)
+	}
+	if _, ok := reopened.mem.outbox.handled["evt-expired"]; ok {
+		t.Fatal("expected the expired handled id to be compacted away")
+	}
+}
+
+func TestFileStore_IgnoresTornTail(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := newTestFileStore(t, dir)
+
+	if err := store.CreateUpload(ctx, entity.UploadMeta{ID: "upload-1", Status: entity.UploadStatusDone}); err != nil {
+		t.Fatalf("CreateUpload() err = %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() err = %v", err)
+	}
+
+	path := filepath.Join(dir, fileStoreLogName)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatalf("open log: %v", err)
+	}
+	if _, err := file.WriteString(`{"op":"meta","upload_id":"upload-1","meta":{"ID":"up`); err != nil {
+		t.Fatalf("write torn record: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("close log: %v", err)
+	}
+
+	reopened := newTestFileStore(t, dir)
+	_, meta, err := reopened.GetBalance(ctx, "upload-1")
+	if err != nil {
+		t.Fatalf("GetBalance() err = %v", err)
+	}
+	if meta.Status != entity.UploadStatusDone {
+		t.Fatalf("GetBalance() status = %v, want %v", meta.Status, entity.UploadStatusDone)
+	}
+}
+
+func TestFileStore_FailsInterruptedUploads(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := newTestFileStore(t, dir)
+
+	for id, status := range map[string]entity.UploadStatus{
+		"queued":     entity.UploadStatusQueued,
+		"processing": entity.UploadStatusProcessing,
+		"done":       entity.UploadStatusDone,
+	} {
+		if err := store.CreateUpload(ctx, entity.UploadMeta{ID: id, Status: status, EndedAt: 5}); err != nil {
+			t.Fatalf("CreateUpload() err = %v", err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() err = %v", err)
+	}
+
+	reopened := newTestFileStore(t, dir)
+	for _, id := range []string{"queued", "processing"} {
+		_, meta, err := reopened.GetBalance(ctx, id)
+		if err != nil {
+			t.Fatalf("GetBalance() err = %v", err)
+		}
+		if meta.Status != entity.UploadStatusFailed || meta.Err != errInterrupted || meta.EndedAt == 0 {
+			t.Fatalf("GetBalance(%q) meta = %+v, want FAILED and interrupted", id, meta)
+		}
+	}
+	_, meta, err := reopened.GetBalance(ctx, "done")
+	if err != nil {
+		t.Fatalf("GetBalance() err = %v", err)
+	}
+	if meta.Status != entity.UploadStatusDone || meta.Err != "" || meta.EndedAt != 5 {
+		t.Fatalf("GetBalance(done) meta = %+v, want it untouched", meta)
+	}
+
+	// The finished uploads are now eligible for retention.
+	evicted, err := reopened.PruneUploads(ctx, 0, 1)
+	if err != nil || len(evicted) != 2 {
+		t.Fatalf("PruneUploads() = %v, %v, want two evicted", evicted, err)
+	}
+}
+
+func TestFileStore_CompactsWhileRunning(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileStore(FileStoreConfig{Dir: dir, CompactAfter: 4 << 10})
+	if err != nil {
+		t.Fatalf("NewFileStore() err = %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+
+	if err := store.CreateUpload(ctx, entity.UploadMeta{ID: "upload-1", Status: entity.UploadStatusProcessing}); err != nil {
+		t.Fatalf("CreateUpload() err = %v", err)
+	}
+	for n := range 1000 {
+		if err := store.UpdateMeta(ctx, "upload-1", func(m *entity.UploadMeta) {
+			m.TotalLines = int64(n)
+		}); err != nil {
+			t.Fatalf("UpdateMeta() err = %v", err)
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(dir, fileStoreLogName))
+	if err != nil {
+		t.Fatalf("stat log: %v", err)
+	}
+	if info.Size() > 8<<10 {
+		t.Fatalf("log size = %d, want it compacted below %d", info.Size(), 8<<10)
+	}
+
+	if err := store.UpdateMeta(ctx, "upload-1", func(m *entity.UploadMeta) {
+		m.Status = entity.UploadStatusDone
+	}); err != nil {
+		t.Fatalf("UpdateMeta() err = %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() err = %v", err)
+	}
+
+	reopened := newTestFileStore(t, dir)
+	_, meta, err := reopened.GetBalance(ctx, "upload-1")
+	if err != nil {
+		t.Fatalf("GetBalance() err = %v", err)
+	}
+	if meta.Status != entity.UploadStatusDone || meta.TotalLines != 999 {
+		t.Fatalf("GetBalance() meta = %+v, want DONE with 999 lines", meta)
+	}
+}
+
+func TestFileStore_CompactsTransactionsAcrossChunks(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := newTestFileStore(t, dir)
+
+	if err := store.CreateUpload(ctx, entity.UploadMeta{ID: "upload-1", Status: entity.UploadStatusDone}); err != nil {
+		t.Fatalf("CreateUpload() err = %v", err)
+	}
+	const rows = txChunkSize + 10
+	txs := make([]entity.Transaction, rows)
+	for i := range txs {
+		txs[i] = entity.Transaction{
+			Timestamp: int64(i), Counterparty: fmt.Sprintf("C%d", i%7), Type: entity.TxTypeCredit,
+			Amount: pkgdecimal.MustParse("1"), Currency: "IDR", Status: entity.TxStatusSuccess,
+		}
+	}
+	if err := store.AppendTransactions(ctx, "upload-1", txs); err != nil {
+		t.Fatalf("AppendTransactions() err = %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() err = %v", err)
+	}
+
+	// Opening compacts the log, so the second reopen reads the snapshot.
+	if err := newTestFileStore(t, dir).Close(); err != nil {
+		t.Fatalf("Close() err = %v", err)
+	}
+	reopened := newTestFileStore(t, dir)
+
+	got, total, _, err := reopened.ListTransactions(ctx, "upload-1", usecase.IssueFilter{}, 1, rows)
+	if err != nil {
+		t.Fatalf("ListTransactions() err = %v", err)
+	}
+	if total != rows || len(got) != rows {
+		t.Fatalf("ListTransactions() total = %d, rows = %d, want %d", total, len(got), rows)
+	}
+	for i, tx := range got {
+		if tx.Timestamp != int64(i) || tx.Counterparty != fmt.Sprintf("C%d", i%7) {
+			t.Fatalf("row %d = %+v", i, tx)
+		}
+	}
+}
+
+func TestFileStore_ConcurrentWritesSurviveRestart(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := newTestFileStore(t, dir)
+
+	const uploads = 8
+	for i := range uploads {
+		id := fmt.Sprintf("upload-%d", i)
+		if err := store.CreateUpload(ctx, entity.UploadMeta{ID: id, Status: entity.UploadStatusQueued}); err != nil {
+			t.Fatalf("CreateUpload() err = %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range uploads {
+		id := fmt.Sprintf("upload-%d", i)
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for n := range 50 {
+				_ = store.UpdateMeta(ctx, id, func(m *entity.UploadMeta) {
+					m.Status = entity.UploadStatusProcessing
+					m.TotalLines = int64(n)
+				})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			issues := []entity.Transaction{{Counterparty: id, Status: entity.TxStatusFailed}}
+			for range 50 {
+				_ = store.SaveResults(ctx, id, entity.Balances{"IDR": pkgdecimal.FromUnits(1)}, issues, 1, 1, 0)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				_, _, _, _ = store.ListIssues(ctx, id, usecase.IssueFilter{}, 1, 10)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Finish the uploads so the restart does not mark them as interrupted.
+	for i := range uploads {
+		if err := store.UpdateMeta(ctx, fmt.Sprintf("upload-%d", i), func(m *entity.UploadMeta) {
+			m.Status = entity.UploadStatusDone
+		}); err != nil {
+			t.Fatalf("UpdateMeta() err = %v", err)
+		}
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() err = %v", err)
+	}
+
+	reopened := newTestFileStore(t, dir)
+	for i := range uploads {
+		id := fmt.Sprintf("upload-%d", i)
+		live, liveMeta, err := store.mem.GetBalance(ctx, id)
+		if err != nil {
+			t.Fatalf("GetBalance() live err = %v", err)
+		}
+		got, gotMeta, err := reopened.GetBalance(ctx, id)
+		if err != nil {
+			t.Fatalf("GetBalance() reopened err = %v", err)
+		}
+		if !reflect.DeepEqual(got, live) || !reflect.DeepEqual(gotMeta, liveMeta) {
+			t.Fatalf("reopened %s = %v/%+v, want %v/%+v", id, got, gotMeta, live, liveMeta)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package store
 
 import (
 	"context"
+	"maps"
+	"slices"
+	"sort"
 	"sync"
 
 	"github.com/shandysiswandi/goflip/internal/flip/entity"
@@ -12,18 +15,35 @@ import (
 type InMemoryStore struct {
 	mu      sync.RWMutex
 	uploads map[string]*uploadRecord
+	keys    map[string]keyClaim
+	outbox  *outbox
+}
+
+// keyClaim ties an idempotency or content key to the upload that claimed it.
+type keyClaim struct {
+	uploadID  string
+	expiresAt int64
 }
 
 type uploadRecord struct {
-	mu      sync.RWMutex
-	meta    entity.UploadMeta
-	balance int64
-	issues  []entity.Transaction
+	mu        sync.RWMutex
+	meta      entity.UploadMeta
+	balances  entity.Balances
+	issues    []entity.Transaction
+	txs       txTable
+	parseErrs []entity.ParseError
+	webhooks  []entity.WebhookDelivery
+
+	// keys lists the claims made by this upload. It is guarded by the store
+	// lock, not by mu.
+	keys []string
 }
 
 func NewInMemoryStore() *InMemoryStore {
 	return &InMemoryStore{
 		uploads: make(map[string]*uploadRecord),
+		keys:    make(map[string]keyClaim),
+		outbox:  newOutbox(),
 	}
 }
 
@@ -56,7 +76,7 @@ func (s *InMemoryStore) UpdateMeta(ctx context.Context, uploadID string, fn func
 	return nil
 }
 
-func (s *InMemoryStore) SaveResults(ctx context.Context, uploadID string, balance int64, issues []entity.Transaction, totalLines, parsedOK, parseErr int64) error {
+func (s *InMemoryStore) SaveResults(ctx context.Context, uploadID string, balances entity.Balances, issues []entity.Transaction, totalLines, parsedOK, parseErr int64) error {
 	rec, err := s.get(uploadID)
 	if err != nil {
 		return err
@@ -65,7 +85,7 @@ func (s *InMemoryStore) SaveResults(ctx context.Context, uploadID string, balanc
 	rec.mu.Lock()
 	defer rec.mu.Unlock()
 
-	rec.balance = balance
+	rec.balances = maps.Clone(balances)
 	rec.issues = issues
 	rec.meta.TotalLines = totalLines
 	rec.meta.ParsedOK = parsedOK
@@ -74,16 +94,50 @@ func (s *InMemoryStore) SaveResults(ctx context.Context, uploadID string, balanc
 	return nil
 }
 
-func (s *InMemoryStore) GetBalance(ctx context.Context, uploadID string) (int64, entity.UploadMeta, error) {
+func (s *InMemoryStore) GetBalance(ctx context.Context, uploadID string) (entity.Balances, entity.UploadMeta, error) {
 	rec, err := s.get(uploadID)
 	if err != nil {
-		return 0, entity.UploadMeta{}, err
+		return nil, entity.UploadMeta{}, err
 	}
 
 	rec.mu.RLock()
 	defer rec.mu.RUnlock()
 
-	return rec.balance, rec.meta, nil
+	return maps.Clone(rec.balances), rec.meta, nil
+}
+
+// ListUploads returns uploads matching filter, newest first.
+func (s *InMemoryStore) ListUploads(ctx context.Context, filter usecase.UploadFilter, page, pageSize int) ([]entity.UploadMeta, int, error) {
+	s.mu.RLock()
+	records := make([]*uploadRecord, 0, len(s.uploads))
+	for _, rec := range s.uploads {
+		records = append(records, rec)
+	}
+	s.mu.RUnlock()
+
+	metas := make([]entity.UploadMeta, 0, len(records))
+	for _, rec := range records {
+		rec.mu.RLock()
+		meta := rec.meta
+		rec.mu.RUnlock()
+
+		if filter.Matches(meta) {
+			metas = append(metas, meta)
+		}
+	}
+
+	sort.Slice(metas, func(i, j int) bool {
+		if metas[i].CreatedAt != metas[j].CreatedAt {
+			return metas[i].CreatedAt > metas[j].CreatedAt
+		}
+		return metas[i].ID > metas[j].ID
+	})
+
+	total := len(metas)
+	start := min((page-1)*pageSize, total)
+	end := min(start+pageSize, total)
+
+	return metas[start:end], total, nil
 }
 
 func (s *InMemoryStore) ListIssues(ctx context.Context, uploadID string, filter usecase.IssueFilter, page, pageSize int) ([]entity.Transaction, int, entity.UploadMeta, error) {
@@ -114,6 +168,226 @@ func (s *InMemoryStore) ListIssues(ctx context.Context, uploadID string, filter
 	return items, total, rec.meta, nil
 }
 
+// AppendTransactions adds parsed rows to the upload's transaction history. The
+// slice is copied, so callers may reuse it.
+func (s *InMemoryStore) AppendTransactions(ctx context.Context, uploadID string, txs []entity.Transaction) error {
+	rec, err := s.get(uploadID)
+	if err != nil {
+		return err
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.txs.append(txs)
+
+	return nil
+}
+
+func (s *InMemoryStore) ListTransactions(ctx context.Context, uploadID string, filter usecase.IssueFilter, page, pageSize int) ([]entity.Transaction, int, entity.UploadMeta, error) {
+	rec, err := s.get(uploadID)
+	if err != nil {
+		return nil, 0, entity.UploadMeta{}, err
+	}
+
+	rec.mu.RLock()
+	defer rec.mu.RUnlock()
+
+	items, total := rec.txs.page(filter, page, pageSize)
+
+	return items, total, rec.meta, nil
+}
+
+func (s *InMemoryStore) AppendParseErrors(ctx context.Context, uploadID string, errs []entity.ParseError) error {
+	rec, err := s.get(uploadID)
+	if err != nil {
+		return err
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.parseErrs = append(rec.parseErrs, errs...)
+
+	return nil
+}
+
+func (s *InMemoryStore) ListParseErrors(ctx context.Context, uploadID string, page, pageSize int) ([]entity.ParseError, int, entity.UploadMeta, error) {
+	rec, err := s.get(uploadID)
+	if err != nil {
+		return nil, 0, entity.UploadMeta{}, err
+	}
+
+	rec.mu.RLock()
+	defer rec.mu.RUnlock()
+
+	total := len(rec.parseErrs)
+	start := min((page-1)*pageSize, total)
+	end := min(start+pageSize, total)
+	items := make([]entity.ParseError, end-start)
+	copy(items, rec.parseErrs[start:end])
+
+	return items, total, rec.meta, nil
+}
+
+func (s *InMemoryStore) AppendWebhookDeliveries(ctx context.Context, uploadID string, deliveries []entity.WebhookDelivery) error {
+	rec, err := s.get(uploadID)
+	if err != nil {
+		return err
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.webhooks = append(rec.webhooks, deliveries...)
+
+	return nil
+}
+
+func (s *InMemoryStore) ListWebhookDeliveries(ctx context.Context, uploadID string, page, pageSize int) ([]entity.WebhookDelivery, int, entity.UploadMeta, error) {
+	rec, err := s.get(uploadID)
+	if err != nil {
+		return nil, 0, entity.UploadMeta{}, err
+	}
+
+	rec.mu.RLock()
+	defer rec.mu.RUnlock()
+
+	total := len(rec.webhooks)
+	start := min((page-1)*pageSize, total)
+	end := min(start+pageSize, total)
+	items := make([]entity.WebhookDelivery, end-start)
+	copy(items, rec.webhooks[start:end])
+
+	return items, total, rec.meta, nil
+}
+
+// DeleteUpload removes an upload. Readers that already hold the record, such as
+// a running ListIssues, finish against their own copy.
+func (s *InMemoryStore) DeleteUpload(ctx context.Context, uploadID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.uploads[uploadID]; !ok {
+		return pkgerror.ErrNotFound
+	}
+
+	s.remove(uploadID)
+
+	return nil
+}
+
+// remove deletes an upload and releases its key claims. Callers hold s.mu.
+func (s *InMemoryStore) remove(uploadID string) {
+	rec, ok := s.uploads[uploadID]
+	if !ok {
+		return
+	}
+
+	for _, key := range rec.keys {
+		if s.keys[key].uploadID == uploadID {
+			delete(s.keys, key)
+		}
+	}
+	delete(s.uploads, uploadID)
+}
+
+// ClaimKey assigns key to uploadID until expiresAt and returns uploadID, or
+// returns the upload that already holds an unexpired claim. Claims of deleted
+// uploads are released.
+func (s *InMemoryStore) ClaimKey(ctx context.Context, key, uploadID string, now, expiresAt int64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.claim(key, uploadID, now, expiresAt)
+}
+
+// claim implements ClaimKey. Callers hold s.mu.
+func (s *InMemoryStore) claim(key, uploadID string, now, expiresAt int64) (string, error) {
+	rec, ok := s.uploads[uploadID]
+	if !ok {
+		return "", pkgerror.ErrNotFound
+	}
+
+	if existing, ok := s.keys[key]; ok && existing.expiresAt > now && existing.uploadID != uploadID {
+		if _, alive := s.uploads[existing.uploadID]; alive {
+			return existing.uploadID, nil
+		}
+	}
+
+	s.setClaim(rec, key, uploadID, expiresAt)
+
+	return uploadID, nil
+}
+
+// setClaim gives key to uploadID without checking the current owner. Callers
+// hold s.mu.
+func (s *InMemoryStore) setClaim(rec *uploadRecord, key, uploadID string, expiresAt int64) {
+	s.keys[key] = keyClaim{uploadID: uploadID, expiresAt: expiresAt}
+	if !slices.Contains(rec.keys, key) {
+		rec.keys = append(rec.keys, key)
+	}
+}
+
+// PruneUploads evicts finished uploads that ended before endedBefore, then the
+// oldest finished uploads until at most maxUploads remain. A zero value turns
+// the corresponding rule off. Uploads still in progress are never evicted.
+func (s *InMemoryStore) PruneUploads(ctx context.Context, endedBefore int64, maxUploads int) ([]string, error) {
+	type candidate struct {
+		id      string
+		endedAt int64
+	}
+
+	s.mu.RLock()
+	total := len(s.uploads)
+	records := make(map[string]*uploadRecord, total)
+	for id, rec := range s.uploads {
+		records[id] = rec
+	}
+	s.mu.RUnlock()
+
+	finished := make([]candidate, 0, len(records))
+	for id, rec := range records {
+		rec.mu.RLock()
+		meta := rec.meta
+		rec.mu.RUnlock()
+
+		if meta.Status.IsFinal() {
+			finished = append(finished, candidate{id: id, endedAt: meta.EndedAt})
+		}
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		if finished[i].endedAt != finished[j].endedAt {
+			return finished[i].endedAt < finished[j].endedAt
+		}
+		return finished[i].id < finished[j].id
+	})
+
+	excess := 0
+	if maxUploads > 0 {
+		excess = total - maxUploads
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var evicted []string
+	for i, c := range finished {
+		expired := endedBefore > 0 && c.endedAt < endedBefore
+		if !expired && i >= excess {
+			break
+		}
+		if s.uploads[c.id] != records[c.id] {
+			continue
+		}
+		s.remove(c.id)
+		evicted = append(evicted, c.id)
+	}
+
+	return evicted, nil
+}
+
 func (s *InMemoryStore) get(uploadID string) (*uploadRecord, error) {
 	s.mu.RLock()
 	rec, ok := s.uploads[uploadID]
@@ -7,10 +7,20 @@ import (
 	"testing"
 
 	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/flip/store/storetest"
 	"github.com/shandysiswandi/goflip/internal/flip/usecase"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgdecimal"
 	"github.com/shandysiswandi/goflip/internal/pkg/pkgerror"
 )
 
+func TestInMemoryStore_Contract(t *testing.T) {
+	t.Parallel()
+
+	storetest.Run(t, func(*testing.T) usecase.Store {
+		return NewInMemoryStore()
+	})
+}
+
 func TestInMemoryStore_CreateUpload_Duplicate(t *testing.T) {
 	t.Parallel()
 
@@ -70,8 +80,8 @@ func TestInMemoryStore_UpdateMeta_And_GetBalance(t *testing.T) {
 		t.Fatalf("GetBalance() err = %v", err)
 	}
 
-	if balance != 0 {
-		t.Fatalf("GetBalance() balance = %d, want 0", balance)
+	if len(balance) != 0 {
+		t.Fatalf("GetBalance() balance = %v, want empty", balance)
 	}
 
 	if gotMeta.Status != entity.UploadStatusDone {
@@ -102,13 +112,13 @@ func TestInMemoryStore_SaveResults_And_ListIssues(t *testing.T) {
 	}
 
 	issues := []entity.Transaction{
-		{Timestamp: 1, Counterparty: "A", Type: entity.TxTypeCredit, Amount: 100, Status: entity.TxStatusSuccess, Description: "ok"},
-		{Timestamp: 2, Counterparty: "B", Type: entity.TxTypeDebit, Amount: 50, Status: entity.TxStatusFailed, Description: "fail-1"},
-		{Timestamp: 3, Counterparty: "C", Type: entity.TxTypeCredit, Amount: 70, Status: entity.TxStatusFailed, Description: "fail-2"},
-		{Timestamp: 4, Counterparty: "D", Type: entity.TxTypeDebit, Amount: 30, Status: entity.TxStatusPending, Description: "pending"},
+		{Timestamp: 1, Counterparty: "A", Type: entity.TxTypeCredit, Amount: pkgdecimal.MustParse("100"), Currency: "IDR", Status: entity.TxStatusSuccess, Description: "ok"},
+		{Timestamp: 2, Counterparty: "B", Type: entity.TxTypeDebit, Amount: pkgdecimal.MustParse("50"), Currency: "IDR", Status: entity.TxStatusFailed, Description: "fail-1"},
+		{Timestamp: 3, Counterparty: "C", Type: entity.TxTypeCredit, Amount: pkgdecimal.MustParse("70"), Currency: "IDR", Status: entity.TxStatusFailed, Description: "fail-2"},
+		{Timestamp: 4, Counterparty: "D", Type: entity.TxTypeDebit, Amount: pkgdecimal.MustParse("30"), Currency: "IDR", Status: entity.TxStatusPending, Description: "pending"},
 	}
 
-	if err := store.SaveResults(ctx, meta.ID, 500, issues, 4, 3, 1); err != nil {
+	if err := store.SaveResults(ctx, meta.ID, entity.Balances{"IDR": pkgdecimal.MustParse("500")}, issues, 4, 3, 1); err != nil {
 		t.Fatalf("SaveResults() err = %v", err)
 	}
 
@@ -116,8 +126,8 @@ func TestInMemoryStore_SaveResults_And_ListIssues(t *testing.T) {
 	if err != nil {
 		t.Fatalf("GetBalance() err = %v", err)
 	}
-	if balance != 500 {
-		t.Fatalf("GetBalance() balance = %d, want 500", balance)
+	if got := balance["IDR"]; got.Cmp(pkgdecimal.MustParse("500")) != 0 || len(balance) != 1 {
+		t.Fatalf("GetBalance() balance = %v, want IDR 500", balance)
 	}
 	if gotMeta.TotalLines != 4 || gotMeta.ParsedOK != 3 || gotMeta.ParseErr != 1 {
 		t.Fatalf("GetBalance() meta stats = %d/%d/%d, want 4/3/1", gotMeta.TotalLines, gotMeta.ParsedOK, gotMeta.ParseErr)
@@ -195,7 +205,7 @@ func TestInMemoryStore_NotFound(t *testing.T) {
 	})
 
 	t.Run("SaveResults", func(t *testing.T) {
-		err := store.SaveResults(ctx, "missing", 0, nil, 0, 0, 0)
+		err := store.SaveResults(ctx, "missing", nil, nil, 0, 0, 0)
 		if !errors.Is(err, pkgerror.ErrNotFound) {
 			t.Fatalf("SaveResults() err = %v, want ErrNotFound", err)
 		}
@@ -0,0 +1,347 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgerror"
+)
+
+// outbox holds failed-transaction events until the consumer handles them, and
+// the dead letters it gave up on. Both keep insertion order. handled keeps the
+// IDs of handled events until they expire, for deduplication across restarts.
+type outbox struct {
+	mu      sync.RWMutex
+	seq     int64
+	pending map[string]outboxEntry
+	dead    map[string]outboxDeadLetter
+	handled map[string]int64 // event ID -> expires at
+	sweepAt int
+}
+
+type outboxEntry struct {
+	seq   int64
+	event entity.FailedTxEvent
+}
+
+type outboxDeadLetter struct {
+	seq    int64
+	letter entity.DeadLetter
+}
+
+func newOutbox() *outbox {
+	return &outbox{
+		pending: make(map[string]outboxEntry),
+		dead:    make(map[string]outboxDeadLetter),
+		handled: make(map[string]int64),
+		sweepAt: minHandledSweep,
+	}
+}
+
+// minHandledSweep is the number of handled IDs below which expired ones are
+// left in place. Above it they are swept whenever the map has doubled, which
+// keeps marking amortized O(1).
+const minHandledSweep = 1024
+
+func (o *outbox) markHandled(eventID string, expiresAt, now int64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.handled[eventID] = expiresAt
+	if len(o.handled) < o.sweepAt {
+		return
+	}
+
+	for id, exp := range o.handled {
+		if exp <= now {
+			delete(o.handled, id)
+		}
+	}
+	o.sweepAt = max(2*len(o.handled), minHandledSweep)
+}
+
+// snapshotHandled emits the handled IDs that have not expired at now.
+func (o *outbox) snapshotHandled(now int64, emit func(rec logRecord) error) error {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	for id, expiresAt := range o.handled {
+		if expiresAt > now {
+			if err := emit(logRecord{Op: opHandled, EventID: id, ExpiresAt: expiresAt}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (o *outbox) isHandled(eventID string, now int64) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	expiresAt, ok := o.handled[eventID]
+	return ok && expiresAt > now
+}
+
+func (o *outbox) append(event entity.FailedTxEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, ok := o.pending[event.EventID]; ok {
+		return
+	}
+	o.seq++
+	o.pending[event.EventID] = outboxEntry{seq: o.seq, event: event}
+}
+
+func (o *outbox) ack(eventID string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.pending, eventID)
+}
+
+// saveDeadLetter replaces the pending event, or an earlier dead letter of the
+// same event, keeping the position of the latter.
+func (o *outbox) saveDeadLetter(letter entity.DeadLetter) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	id := letter.Event.EventID
+	delete(o.pending, id)
+
+	entry, ok := o.dead[id]
+	if !ok {
+		o.seq++
+		entry.seq = o.seq
+	}
+	entry.letter = letter
+	o.dead[id] = entry
+}
+
+func (o *outbox) deleteDeadLetter(eventID string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, ok := o.dead[eventID]; !ok {
+		return false
+	}
+	delete(o.dead, eventID)
+	return true
+}
+
+func (o *outbox) pendingEvents() []entity.FailedTxEvent {
+	o.mu.RLock()
+	entries := make([]outboxEntry, 0, len(o.pending))
+	for _, entry := range o.pending {
+		entries = append(entries, entry)
+	}
+	o.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+
+	events := make([]entity.FailedTxEvent, 0, len(entries))
+	for _, entry := range entries {
+		events = append(events, entry.event)
+	}
+	return events
+}
+
+func (o *outbox) deadLetters() []entity.DeadLetter {
+	o.mu.RLock()
+	entries := make([]outboxDeadLetter, 0, len(o.dead))
+	for _, entry := range o.dead {
+		entries = append(entries, entry)
+	}
+	o.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+
+	letters := make([]entity.DeadLetter, 0, len(entries))
+	for _, entry := range entries {
+		letters = append(letters, entry.letter)
+	}
+	return letters
+}
+
+// AppendOutbox records an event before it is published. Appending an event
+// that is already pending is a no-op.
+func (s *InMemoryStore) AppendOutbox(ctx context.Context, event entity.FailedTxEvent) error {
+	s.outbox.append(event)
+	return nil
+}
+
+// AckOutbox drops a handled event. Unknown IDs are ignored.
+func (s *InMemoryStore) AckOutbox(ctx context.Context, eventID string) error {
+	s.outbox.ack(eventID)
+	return nil
+}
+
+// PendingOutbox lists the events not yet acknowledged, oldest first.
+func (s *InMemoryStore) PendingOutbox(ctx context.Context) ([]entity.FailedTxEvent, error) {
+	return s.outbox.pendingEvents(), nil
+}
+
+// SaveDeadLetter moves an event out of the outbox into the dead letters, or
+// updates its dead letter after a failed replay.
+func (s *InMemoryStore) SaveDeadLetter(ctx context.Context, letter entity.DeadLetter) error {
+	s.outbox.saveDeadLetter(letter)
+	return nil
+}
+
+func (s *InMemoryStore) ListDeadLetters(ctx context.Context, page, pageSize int) ([]entity.DeadLetter, int, error) {
+	letters := s.outbox.deadLetters()
+	total := len(letters)
+	start := min((page-1)*pageSize, total)
+	end := min(start+pageSize, total)
+	return letters[start:end], total, nil
+}
+
+func (s *InMemoryStore) GetDeadLetter(ctx context.Context, eventID string) (entity.DeadLetter, error) {
+	s.outbox.mu.RLock()
+	defer s.outbox.mu.RUnlock()
+
+	entry, ok := s.outbox.dead[eventID]
+	if !ok {
+		return entity.DeadLetter{}, pkgerror.ErrNotFound
+	}
+	return entry.letter, nil
+}
+
+func (s *InMemoryStore) DeleteDeadLetter(ctx context.Context, eventID string) error {
+	if !s.outbox.deleteDeadLetter(eventID) {
+		return pkgerror.ErrNotFound
+	}
+	return nil
+}
+
+// MarkHandled remembers a handled event until expiresAt (unix seconds).
+func (s *InMemoryStore) MarkHandled(ctx context.Context, eventID string, expiresAt int64) error {
+	s.outbox.markHandled(eventID, expiresAt, time.Now().Unix())
+	return nil
+}
+
+// IsHandled reports whether eventID was marked handled and has not expired
+// at now.
+func (s *InMemoryStore) IsHandled(ctx context.Context, eventID string, now int64) (bool, error) {
+	return s.outbox.isHandled(eventID, now), nil
+}
+
+func (s *FileStore) AppendOutbox(ctx context.Context, event entity.FailedTxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.mem.AppendOutbox(ctx, event); err != nil {
+		return err
+	}
+
+	return s.append(logRecord{Op: opOutbox, UploadID: event.UploadID, Event: &event})
+}
+
+func (s *FileStore) AckOutbox(ctx context.Context, eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.mem.AckOutbox(ctx, eventID); err != nil {
+		return err
+	}
+
+	return s.append(logRecord{Op: opAck, EventID: eventID})
+}
+
+func (s *FileStore) PendingOutbox(ctx context.Context) ([]entity.FailedTxEvent, error) {
+	return s.mem.PendingOutbox(ctx)
+}
+
+func (s *FileStore) SaveDeadLetter(ctx context.Context, letter entity.DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.mem.SaveDeadLetter(ctx, letter); err != nil {
+		return err
+	}
+
+	return s.append(logRecord{Op: opDeadLetter, UploadID: letter.Event.UploadID, DeadLetter: &letter})
+}
+
+func (s *FileStore) ListDeadLetters(ctx context.Context, page, pageSize int) ([]entity.DeadLetter, int, error) {
+	return s.mem.ListDeadLetters(ctx, page, pageSize)
+}
+
+func (s *FileStore) GetDeadLetter(ctx context.Context, eventID string) (entity.DeadLetter, error) {
+	return s.mem.GetDeadLetter(ctx, eventID)
+}
+
+func (s *FileStore) DeleteDeadLetter(ctx context.Context, eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.mem.DeleteDeadLetter(ctx, eventID); err != nil {
+		return err
+	}
+
+	return s.append(logRecord{Op: opDeleteDeadLetter, EventID: eventID})
+}
+
+func (s *FileStore) MarkHandled(ctx context.Context, eventID string, expiresAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.mem.MarkHandled(ctx, eventID, expiresAt); err != nil {
+		return err
+	}
+
+	return s.append(logRecord{Op: opHandled, EventID: eventID, ExpiresAt: expiresAt})
+}
+
+func (s *FileStore) IsHandled(ctx context.Context, eventID string, now int64) (bool, error) {
+	return s.mem.IsHandled(ctx, eventID, now)
+}
+
+// applyOutbox replays an outbox log record. It reports false for records of
+// other kinds.
+func (s *InMemoryStore) applyOutbox(rec logRecord) bool {
+	switch rec.Op {
+	case opOutbox:
+		if rec.Event != nil {
+			s.outbox.append(*rec.Event)
+		}
+	case opAck:
+		s.outbox.ack(rec.EventID)
+	case opDeadLetter:
+		if rec.DeadLetter != nil {
+			s.outbox.saveDeadLetter(*rec.DeadLetter)
+		}
+	case opDeleteDeadLetter:
+		s.outbox.deleteDeadLetter(rec.EventID)
+	case opHandled:
+		if now := time.Now().Unix(); rec.ExpiresAt > now {
+			s.outbox.markHandled(rec.EventID, rec.ExpiresAt, now)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// outboxSnapshot passes emit the log records that rebuild the outbox. Expired
+// handled IDs are dropped.
+func (s *InMemoryStore) outboxSnapshot(emit func(rec logRecord) error) error {
+	if err := s.outbox.snapshotHandled(time.Now().Unix(), emit); err != nil {
+		return err
+	}
+	for _, event := range s.outbox.pendingEvents() {
+		if err := emit(logRecord{Op: opOutbox, UploadID: event.UploadID, Event: &event}); err != nil {
+			return err
+		}
+	}
+	for _, letter := range s.outbox.deadLetters() {
+		if err := emit(logRecord{Op: opDeadLetter, UploadID: letter.Event.UploadID, DeadLetter: &letter}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
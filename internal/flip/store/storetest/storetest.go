@@ -0,0 +1,992 @@
+// Package storetest provides a conformance suite for usecase.Store backends.
+//
+// Every backend must behave the way Usecase expects: missing uploads return
+// pkgerror.ErrNotFound, duplicate uploads return CodeConflict, pagination
+// totals are computed after filtering, and concurrent writes and reads on the
+// same upload never deadlock or expose half-applied updates.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/flip/event"
+	"github.com/shandysiswandi/goflip/internal/flip/usecase"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgdecimal"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgerror"
+)
+
+// Factory returns a new, empty store for a single test. Backends that hold
+// resources should register their cleanup with t.Cleanup.
+type Factory func(t *testing.T) usecase.Store
+
+// Run executes the full conformance suite against stores built by newStore.
+func Run(t *testing.T, newStore Factory) {
+	t.Helper()
+
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, newStore(t)) })
+	t.Run("CreateUploadConflict", func(t *testing.T) { testCreateUploadConflict(t, newStore(t)) })
+	t.Run("UpdateMetaAndGetBalance", func(t *testing.T) { testUpdateMetaAndGetBalance(t, newStore(t)) })
+	t.Run("SaveResultsKeepsMeta", func(t *testing.T) { testSaveResultsKeepsMeta(t, newStore(t)) })
+	t.Run("ListIssuesPagination", func(t *testing.T) { testListIssuesPagination(t, newStore(t)) })
+	t.Run("ConcurrentCreateUpload", func(t *testing.T) { testConcurrentCreateUpload(t, newStore(t)) })
+	t.Run("ConcurrentUpdateAndReads", func(t *testing.T) { testConcurrentUpdateAndReads(t, newStore(t)) })
+	t.Run("SlowUpdateDoesNotBlockOtherUploads", func(t *testing.T) { testSlowUpdateDoesNotBlockOtherUploads(t, newStore(t)) })
+	t.Run("DeleteUpload", func(t *testing.T) { testDeleteUpload(t, newStore(t)) })
+	t.Run("PruneUploads", func(t *testing.T) { testPruneUploads(t, newStore(t)) })
+	t.Run("DeleteWhileListing", func(t *testing.T) { testDeleteWhileListing(t, newStore(t)) })
+	t.Run("TransactionsAcrossChunks", func(t *testing.T) { testTransactionsAcrossChunks(t, newStore(t)) })
+	t.Run("ConcurrentAppendAndList", func(t *testing.T) { testConcurrentAppendAndList(t, newStore(t)) })
+	t.Run("ListUploads", func(t *testing.T) { testListUploads(t, newStore(t)) })
+	t.Run("ParseErrors", func(t *testing.T) { testParseErrors(t, newStore(t)) })
+	t.Run("WebhookDeliveries", func(t *testing.T) { testWebhookDeliveries(t, newStore(t)) })
+	t.Run("ClaimKey", func(t *testing.T) { testClaimKey(t, newStore(t)) })
+	t.Run("Outbox", func(t *testing.T) { testOutbox(t, newStore(t)) })
+	t.Run("HandledEvents", func(t *testing.T) { testHandledEvents(t, newStore(t)) })
+}
+
+// Reopener closes s and returns a store over the same data. Only durable
+// backends can provide one.
+type Reopener func(t *testing.T, s usecase.Store) usecase.Store
+
+// RunDurable executes the cases that check state survives a reopen.
+func RunDurable(t *testing.T, newStore Factory, reopen Reopener) {
+	t.Helper()
+
+	t.Run("ReclaimKeyAfterExpiry", func(t *testing.T) { testReclaimKeyAfterExpiry(t, newStore(t), reopen) })
+}
+
+func mustCreate(t *testing.T, s usecase.Store, meta entity.UploadMeta) {
+	t.Helper()
+
+	if err := s.CreateUpload(context.Background(), meta); err != nil {
+		t.Fatalf("CreateUpload(%q) err = %v", meta.ID, err)
+	}
+}
+
+func sampleIssues() []entity.Transaction {
+	return []entity.Transaction{
+		{Timestamp: 1, Counterparty: "A", Type: entity.TxTypeDebit, Amount: pkgdecimal.MustParse("10"), Currency: "IDR", Status: entity.TxStatusFailed, Description: "f1"},
+		{Timestamp: 2, Counterparty: "B", Type: entity.TxTypeCredit, Amount: pkgdecimal.MustParse("20.5"), Currency: "USD", Status: entity.TxStatusPending, Description: "p1"},
+		{Timestamp: 3, Counterparty: "C", Type: entity.TxTypeCredit, Amount: pkgdecimal.MustParse("30"), Currency: "IDR", Status: entity.TxStatusFailed, Description: "f2"},
+		{Timestamp: 4, Counterparty: "D", Type: entity.TxTypeDebit, Amount: pkgdecimal.MustParse("40"), Currency: "IDR", Status: entity.TxStatusFailed, Description: "f3"},
+		{Timestamp: 5, Counterparty: "E", Type: entity.TxTypeDebit, Amount: pkgdecimal.MustParse("50"), Currency: "IDR", Status: entity.TxStatusPending, Description: "p2"},
+	}
+}
+
+func testNotFound(t *testing.T, s usecase.Store) {
+	ctx := context.Background()
+
+	if _, _, err := s.GetBalance(ctx, "missing"); !errors.Is(err, pkgerror.ErrNotFound) {
+		t.Errorf("GetBalance() err = %v, want ErrNotFound", err)
+	}
+
+	called := false
+	if err := s.UpdateMeta(ctx, "missing", func(*entity.UploadMeta) { called = true }); !errors.Is(err, pkgerror.ErrNotFound) {
+		t.Errorf("UpdateMeta() err = %v, want ErrNotFound", err)
+	}
+	if called {
+		t.Error("UpdateMeta() called fn for a missing upload")
+	}
+
+	if err := s.SaveResults(ctx, "missing", nil, nil, 0, 0, 0); !errors.Is(err, pkgerror.ErrNotFound) {
+		t.Errorf("SaveResults() err = %v, want ErrNotFound", err)
+	}
+
+	if _, _, _, err := s.ListIssues(ctx, "missing", usecase.IssueFilter{}, 1, 10); !errors.Is(err, pkgerror.ErrNotFound) {
+		t.Errorf("ListIssues() err = %v, want ErrNotFound", err)
+	}
+
+	if err := s.AppendTransactions(ctx, "missing", sampleIssues()); !errors.Is(err, pkgerror.ErrNotFound) {
+		t.Errorf("AppendTransactions() err = %v, want ErrNotFound", err)
+	}
+
+	if _, _, _, err := s.ListTransactions(ctx, "missing", usecase.IssueFilter{}, 1, 10); !errors.Is(err, pkgerror.ErrNotFound) {
+		t.Errorf("ListTransactions() err = %v, want ErrNotFound", err)
+	}
+
+	if err := s.AppendParseErrors(ctx, "missing", []entity.ParseError{{Line: 1}}); !errors.Is(err, pkgerror.ErrNotFound) {
+		t.Errorf("AppendParseErrors() err = %v, want ErrNotFound", err)
+	}
+
+	if _, _, _, err := s.ListParseErrors(ctx, "missing", 1, 10); !errors.Is(err, pkgerror.ErrNotFound) {
+		t.Errorf("ListParseErrors() err = %v, want ErrNotFound", err)
+	}
+
+	if err := s.DeleteUpload(ctx, "missing"); !errors.Is(err, pkgerror.ErrNotFound) {
+		t.Errorf("DeleteUpload() err = %v, want ErrNotFound", err)
+	}
+}
+
+func testCreateUploadConflict(t *testing.T, s usecase.Store) {
+	meta := entity.UploadMeta{ID: "upload-1", Status: entity.UploadStatusQueued}
+	mustCreate(t, s, meta)
+
+	err := s.CreateUpload(context.Background(), entity.UploadMeta{ID: meta.ID, Status: entity.UploadStatusDone})
+	var perr *pkgerror.Error
+	if !errors.As(err, &perr) {
+		t.Fatalf("CreateUpload() duplicate err = %v, want *pkgerror.Error", err)
+	}
+	if perr.Code() != pkgerror.CodeConflict {
+		t.Fatalf("CreateUpload() duplicate code = %v, want %v", perr.Code(), pkgerror.CodeConflict)
+	}
+
+	_, got, err := s.GetBalance(context.Background(), meta.ID)
+	if err != nil {
+		t.Fatalf("GetBalance() err = %v", err)
+	}
+	if got.Status != entity.UploadStatusQueued {
+		t.Fatalf("duplicate CreateUpload() overwrote status to %v", got.Status)
+	}
+}
+
+func testUpdateMetaAndGetBalance(t *testing.T, s usecase.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, entity.UploadMeta{ID: "upload-1", Status: entity.UploadStatusQueued, StartedAt: 1})
+
+	if err := s.UpdateMeta(ctx, "upload-1", func(m *entity.UploadMeta) {
+		m.Status = entity.UploadStatusFailed
+		m.Err = "boom"
+		m.EndedAt = 2
+	}); err != nil {
+		t.Fatalf("UpdateMeta() err = %v", err)
+	}
+
+	balance, got, err := s.GetBalance(ctx, "upload-1")
+	if err != nil {
+		t.Fatalf("GetBalance() err = %v", err)
+	}
+	want := entity.UploadMeta{ID: "upload-1", Status: entity.UploadStatusFailed, Err: "boom", StartedAt: 1, EndedAt: 2}
+	if len(balance) != 0 || !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetBalance() = %v/%+v, want empty/%+v", balance, got, want)
+	}
+}
+
+func testSaveResultsKeepsMeta(t *testing.T, s usecase.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, entity.UploadMeta{ID: "upload-1", Status: entity.UploadStatusProcessing, StartedAt: 7})
+
+	balances := entity.Balances{"IDR": pkgdecimal.MustParse("-120"), "USD": pkgdecimal.MustParse("12.34")}
+	if err := s.SaveResults(ctx, "upload-1", balances, sampleIssues(), 6, 5, 1); err != nil {
+		t.Fatalf("SaveResults() err = %v", err)
+	}
+	balances["IDR"] = pkgdecimal.MustParse("1")
+
+	balancesGot, got, err := s.GetBalance(ctx, "upload-1")
+	if err != nil {
+		t.Fatalf("GetBalance() err = %v", err)
+	}
+	want := entity.Balances{"IDR": pkgdecimal.MustParse("-120"), "USD": pkgdecimal.MustParse("12.34")}
+	if !reflect.DeepEqual(balancesGot, want) {
+		t.Fatalf("GetBalance() balances = %v, want %v", balancesGot, want)
+	}
+	balancesGot["USD"] = pkgdecimal.MustParse("0")
+	if again, _, _ := s.GetBalance(ctx, "upload-1"); !reflect.DeepEqual(again, want) {
+		t.Fatalf("GetBalance() returned a map shared with the store: %v", again)
+	}
+	if got.Status != entity.UploadStatusProcessing || got.StartedAt != 7 {
+		t.Fatalf("SaveResults() changed status/started_at: %+v", got)
+	}
+	if got.TotalLines != 6 || got.ParsedOK != 5 || got.ParseErr != 1 {
+		t.Fatalf("GetBalance() stats = %d/%d/%d, want 6/5/1", got.TotalLines, got.ParsedOK, got.ParseErr)
+	}
+}
+
+func testListIssuesPagination(t *testing.T, s usecase.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, entity.UploadMeta{ID: "upload-1", Status: entity.UploadStatusProcessing})
+
+	issues := sampleIssues()
+	if err := s.SaveResults(ctx, "upload-1", nil, issues, 5, 5, 0); err != nil {
+		t.Fatalf("SaveResults() err = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		filter    usecase.IssueFilter
+		page      int
+		pageSize  int
+		wantTotal int
+		want      []entity.Transaction
+	}{
+		{
+			name:      "no filter first page",
+			page:      1,
+			pageSize:  2,
+			wantTotal: 5,
+			want:      issues[0:2],
+		},
+		{
+			name:      "no filter last partial page",
+			page:      3,
+			pageSize:  2,
+			wantTotal: 5,
+			want:      issues[4:5],
+		},
+		{
+			name:      "failed only second page",
+			filter:    usecase.IssueFilter{Statuses: []entity.TxStatus{entity.TxStatusFailed}},
+			page:      2,
+			pageSize:  2,
+			wantTotal: 3,
+			want:      issues[3:4],
+		},
+		{
+			name: "failed debit",
+			filter: usecase.IssueFilter{
+				Statuses: []entity.TxStatus{entity.TxStatusFailed},
+				Types:    []entity.TxType{entity.TxTypeDebit},
+			},
+			page:      1,
+			pageSize:  10,
+			wantTotal: 2,
+			want:      []entity.Transaction{issues[0], issues[3]},
+		},
+		{
+			name:      "page past the end",
+			filter:    usecase.IssueFilter{Statuses: []entity.TxStatus{entity.TxStatusPending}},
+			page:      5,
+			pageSize:  10,
+			wantTotal: 2,
+			want:      []entity.Transaction{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, meta, err := s.ListIssues(ctx, "upload-1", tt.filter, tt.page, tt.pageSize)
+			if err != nil {
+				t.Fatalf("ListIssues() err = %v", err)
+			}
+			if total != tt.wantTotal {
+				t.Fatalf("ListIssues() total = %d, want %d", total, tt.wantTotal)
+			}
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Fatalf("ListIssues() = %+v, want %+v", got, tt.want)
+			}
+			if meta.ID != "upload-1" || meta.TotalLines != 5 {
+				t.Fatalf("ListIssues() meta = %+v", meta)
+			}
+		})
+	}
+}
+
+func testConcurrentCreateUpload(t *testing.T, s usecase.Store) {
+	const attempts = 32
+
+	var wg sync.WaitGroup
+	var created atomic.Int32
+	var conflicts atomic.Int32
+
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.CreateUpload(context.Background(), entity.UploadMeta{ID: "same", Status: entity.UploadStatusQueued})
+			if err == nil {
+				created.Add(1)
+				return
+			}
+			var perr *pkgerror.Error
+			if errors.As(err, &perr) && perr.Code() == pkgerror.CodeConflict {
+				conflicts.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created.Load() != 1 || conflicts.Load() != attempts-1 {
+		t.Fatalf("concurrent CreateUpload() created=%d conflicts=%d, want 1/%d", created.Load(), conflicts.Load(), attempts-1)
+	}
+}
+
+// testConcurrentUpdateAndReads hammers one upload with UpdateMeta, SaveResults,
+// GetBalance and ListIssues. Writers always keep TotalLines == ParsedOK, so a
+// reader that sees them differ observed a half-applied update.
+func testConcurrentUpdateAndReads(t *testing.T, s usecase.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, entity.UploadMeta{ID: "upload-1", Status: entity.UploadStatusQueued})
+
+	const rounds = 200
+	issues := sampleIssues()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*rounds)
+
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		for i := range rounds {
+			err := s.UpdateMeta(ctx, "upload-1", func(m *entity.UploadMeta) {
+				m.Status = entity.UploadStatusProcessing
+				m.TotalLines = int64(i)
+				m.ParsedOK = int64(i)
+			})
+			if err != nil {
+				errs <- fmt.Errorf("UpdateMeta() err = %w", err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := range rounds {
+			if err := s.SaveResults(ctx, "upload-1", entity.Balances{"IDR": pkgdecimal.FromUnits(int64(i))}, issues, int64(i), int64(i), 0); err != nil {
+				errs <- fmt.Errorf("SaveResults() err = %w", err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range rounds {
+			_, meta, err := s.GetBalance(ctx, "upload-1")
+			if err != nil {
+				errs <- fmt.Errorf("GetBalance() err = %w", err)
+				continue
+			}
+			if meta.TotalLines != meta.ParsedOK {
+				errs <- fmt.Errorf("GetBalance() saw torn meta %+v", meta)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range rounds {
+			items, total, meta, err := s.ListIssues(ctx, "upload-1", usecase.IssueFilter{}, 1, 2)
+			if err != nil {
+				errs <- fmt.Errorf("ListIssues() err = %w", err)
+				continue
+			}
+			if total != 0 && (total != len(issues) || len(items) != 2) {
+				errs <- fmt.Errorf("ListIssues() total=%d len=%d", total, len(items))
+			}
+			if meta.TotalLines != meta.ParsedOK {
+				errs <- fmt.Errorf("ListIssues() saw torn meta %+v", meta)
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// testSlowUpdateDoesNotBlockOtherUploads checks that a long UpdateMeta callback
+// only locks its own upload, so reads and writes on other uploads proceed.
+func testSlowUpdateDoesNotBlockOtherUploads(t *testing.T, s usecase.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, entity.UploadMeta{ID: "slow", Status: entity.UploadStatusQueued})
+	mustCreate(t, s, entity.UploadMeta{ID: "fast", Status: entity.UploadStatusQueued})
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 1)
+
+	go func() {
+		done <- s.UpdateMeta(ctx, "slow", func(m *entity.UploadMeta) {
+			close(entered)
+			<-release
+			m.Status = entity.UploadStatusDone
+		})
+	}()
+
+	<-entered
+
+	finished := make(chan error, 1)
+	go func() {
+		if _, _, err := s.GetBalance(ctx, "fast"); err != nil {
+			finished <- err
+			return
+		}
+		if _, _, _, err := s.ListIssues(ctx, "fast", usecase.IssueFilter{}, 1, 10); err != nil {
+			finished <- err
+			return
+		}
+		finished <- nil
+	}()
+
+	select {
+	case err := <-finished:
+		if err != nil {
+			t.Errorf("reads on another upload err = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("reads on another upload blocked by a slow UpdateMeta")
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("UpdateMeta() err = %v", err)
+	}
+
+	_, meta, err := s.GetBalance(ctx, "slow")
+	if err != nil {
+		t.Fatalf("GetBalance() err = %v", err)
+	}
+	if meta.Status != entity.UploadStatusDone {
+		t.Fatalf("GetBalance() status = %v, want %v", meta.Status, entity.UploadStatusDone)
+	}
+}
+
+func testDeleteUpload(t *testing.T, s usecase.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, entity.UploadMeta{ID: "upload-1", Status: entity.UploadStatusDone})
+	mustCreate(t, s, entity.UploadMeta{ID: "upload-2", Status: entity.UploadStatusDone})
+
+	if err := s.DeleteUpload(ctx, "upload-1"); err != nil {
+		t.Fatalf("DeleteUpload() err = %v", err)
+	}
+
+	if _, _, err := s.GetBalance(ctx, "upload-1"); !errors.Is(err, pkgerror.ErrNotFound) {
+		t.Fatalf("GetBalance() after delete err = %v, want ErrNotFound", err)
+	}
+	if _, _, err := s.GetBalance(ctx, "upload-2"); err != nil {
+		t.Fatalf("GetBalance() on other upload err = %v", err)
+	}
+
+	// The ID is free again once deleted.
+	mustCreate(t, s, entity.UploadMeta{ID: "upload-1", Status: entity.UploadStatusQueued})
+}
+
+func testPruneUploads(t *testing.T, s usecase.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, entity.UploadMeta{ID: "old-done", Status: entity.UploadStatusDone, EndedAt: 10})
+	mustCreate(t, s, entity.UploadMeta{ID: "old-failed", Status: entity.UploadStatusFailed, EndedAt: 20})
+	mustCreate(t, s, entity.UploadMeta{ID: "mid-done", Status: entity.UploadStatusDone, EndedAt: 30})
+	mustCreate(t, s, entity.UploadMeta{ID: "new-done", Status: entity.UploadStatusDone, EndedAt: 40})
+	mustCreate(t, s, entity.UploadMeta{ID: "running", Status: entity.UploadStatusProcessing})
+
+	evicted, err := s.PruneUploads(ctx, 25, 0)
+	if err != nil {
+		t.Fatalf("PruneUploads() by age err = %v", err)
+	}
+	if want := []string{"old-done", "old-failed"}; !reflect.DeepEqual(evicted, want) {
+		t.Fatalf("PruneUploads() by age evicted = %v, want %v", evicted, want)
+	}
+
+	// Three uploads remain; keeping two evicts the oldest finished one and
+	// never touches the running upload.
+	evicted, err = s.PruneUploads(ctx, 0, 2)
+	if err != nil {
+		t.Fatalf("PruneUploads() by count err = %v", err)
+	}
+	if want := []string{"mid-done"}; !reflect.DeepEqual(evicted, want) {
+		t.Fatalf("PruneUploads() by count evicted = %v, want %v", evicted, want)
+	}
+
+	evicted, err = s.PruneUploads(ctx, 1000, 1)
+	if err != nil {
+		t.Fatalf("PruneUploads() all finished err = %v", err)
+	}
+	if want := []string{"new-done"}; !reflect.DeepEqual(evicted, want) {
+		t.Fatalf("PruneUploads() all finished evicted = %v, want %v", evicted, want)
+	}
+
+	if _, _, err := s.GetBalance(ctx, "running"); err != nil {
+		t.Fatalf("GetBalance() running upload err = %v", err)
+	}
+}
+
+// testDeleteWhileListing deletes and prunes uploads while readers page through
+// their issues; readers must only ever see a full page or ErrNotFound.
+func testDeleteWhileListing(t *testing.T, s usecase.Store) {
+	ctx := context.Background()
+	issues := sampleIssues()
+
+	const uploads = 20
+	for i := range uploads {
+		id := fmt.Sprintf("upload-%d", i)
+		mustCreate(t, s, entity.UploadMeta{ID: id, Status: entity.UploadStatusProcessing})
+		if err := s.SaveResults(ctx, id, nil, issues, 5, 5, 0); err != nil {
+			t.Fatalf("SaveResults() err = %v", err)
+		}
+		if err := s.UpdateMeta(ctx, id, func(m *entity.UploadMeta) {
+			m.Status = entity.UploadStatusDone
+			m.EndedAt = int64(i)
+		}); err != nil {
+			t.Fatalf("UpdateMeta() err = %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, uploads*8)
+
+	for i := range uploads {
+		id := fmt.Sprintf("upload-%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				items, total, _, err := s.ListIssues(ctx, id, usecase.IssueFilter{}, 1, 10)
+				if errors.Is(err, pkgerror.ErrNotFound) {
+					return
+				}
+				if err != nil {
+					errs <- fmt.Errorf("ListIssues(%s) err = %w", id, err)
+					return
+				}
+				if total != len(issues) || len(items) != len(issues) {
+					errs <- fmt.Errorf("ListIssues(%s) total=%d len=%d", id, total, len(items))
+				}
+			}
+		}()
+	}
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < uploads; i += 2 {
+			err := s.DeleteUpload(ctx, fmt.Sprintf("upload-%d", i))
+			if err != nil && !errors.Is(err, pkgerror.ErrNotFound) {
+				errs <- fmt.Errorf("DeleteUpload() err = %w", err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if _, err := s.PruneUploads(ctx, uploads, 0); err != nil {
+			errs <- fmt.Errorf("PruneUploads() err = %w", err)
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for i := range uploads {
+		if _, _, err := s.GetBalance(ctx, fmt.Sprintf("upload-%d", i)); !errors.Is(err, pkgerror.ErrNotFound) {
+			t.Errorf("GetBalance(upload-%d) after prune err = %v, want ErrNotFound", i, err)
+		}
+	}
+}
+
+// testTransactionsAcrossChunks appends enough rows in uneven batches to cross
+// any reasonable internal chunk size and checks order, filtering and paging.
+func testTransactionsAcrossChunks(t *testing.T, s usecase.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, entity.UploadMeta{ID: "upload-1", Status: entity.UploadStatusProcessing})
+
+	const rows = 10_000
+	all := make([]entity.Transaction, 0, rows)
+	for i := range rows {
+		tx := entity.Transaction{
+			Timestamp:    int64(i),
+			Counterparty: fmt.Sprintf("cp-%d", i%7),
+			Type:         entity.TxTypeCredit,
+			Amount:       pkgdecimal.FromUnits(int64(i)),
+			Currency:     "IDR",
+			Status:       entity.TxStatusSuccess,
+			Description:  fmt.Sprintf("row-%d", i),
+		}
+		if i%3 == 0 {
+			tx.Type = entity.TxTypeDebit
+			tx.Status = entity.TxStatusFailed
+		}
+		all = append(all, tx)
+	}
+
+	batch := make([]entity.Transaction, 0, 777)
+	for _, tx := range all {
+		batch = append(batch, tx)
+		if len(batch) == cap(batch) {
+			if err := s.AppendTransactions(ctx, "upload-1", batch); err != nil {
+				t.Fatalf("AppendTransactions() err = %v", err)
+			}
+			// Reuse the buffer: the store must have copied the rows.
+			for i := range batch {
+				batch[i] = entity.Transaction{}
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := s.AppendTransactions(ctx, "upload-1", batch); err != nil {
+		t.Fatalf("AppendTransactions() err = %v", err)
+	}
+
+	got, total, _, err := s.ListTransactions(ctx, "upload-1", usecase.IssueFilter{}, 41, 100)
+	if err != nil {
+		t.Fatalf("ListTransactions() err = %v", err)
+	}
+	if total != rows || !reflect.DeepEqual(got, all[4000:4100]) {
+		t.Fatalf("ListTransactions() page 41 total=%d first=%+v, want %d/%+v", total, got[0], rows, all[4000])
+	}
+
+	failed := usecase.IssueFilter{Statuses: []entity.TxStatus{entity.TxStatusFailed}}
+	got, total, _, err = s.ListTransactions(ctx, "upload-1", failed, 2, 1500)
+	if err != nil {
+		t.Fatalf("ListTransactions() filtered err = %v", err)
+	}
+	if total != 3334 || len(got) != 1500 {
+		t.Fatalf("ListTransactions() filtered total=%d len=%d, want 3334/1500", total, len(got))
+	}
+	if got[0] != all[4500] {
+		t.Fatalf("ListTransactions() filtered first = %+v, want %+v", got[0], all[4500])
+	}
+}
+
+func testConcurrentAppendAndList(t *testing.T, s usecase.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, entity.UploadMeta{ID: "upload-1", Status: entity.UploadStatusProcessing})
+
+	const batches = 100
+	batch := sampleIssues()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*batches)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range batches {
+			if err := s.AppendTransactions(ctx, "upload-1", batch); err != nil {
+				errs <- fmt.Errorf("AppendTransactions() err = %w", err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range batches {
+			_, total, _, err := s.ListTransactions(ctx, "upload-1", usecase.IssueFilter{}, 1, 10)
+			if err != nil {
+				errs <- fmt.Errorf("ListTransactions() err = %w", err)
+				continue
+			}
+			if total%len(batch) != 0 {
+				errs <- fmt.Errorf("ListTransactions() saw a partial batch: total=%d", total)
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	_, total, _, err := s.ListTransactions(ctx, "upload-1", usecase.IssueFilter{}, 1, 1)
+	if err != nil {
+		t.Fatalf("ListTransactions() err = %v", err)
+	}
+	if total != batches*len(batch) {
+		t.Fatalf("ListTransactions() total = %d, want %d", total, batches*len(batch))
+	}
+}
+
+func testListUploads(t *testing.T, s usecase.Store) {
+	ctx := context.Background()
+
+	metas := []entity.UploadMeta{
+		{ID: "a", Status: entity.UploadStatusDone, CreatedAt: 10},
+		{ID: "b", Status: entity.UploadStatusFailed, CreatedAt: 20},
+		{ID: "c", Status: entity.UploadStatusDone, CreatedAt: 30},
+		{ID: "d", Status: entity.UploadStatusProcessing, CreatedAt: 40},
+		{ID: "e", Status: entity.UploadStatusDone, CreatedAt: 40},
+	}
+	for _, meta := range metas {
+		mustCreate(t, s, meta)
+	}
+
+	ids := func(metas []entity.UploadMeta) []string {
+		out := make([]string, 0, len(metas))
+		for _, meta := range metas {
+			out = append(out, meta.ID)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		filter    usecase.UploadFilter
+		page      int
+		pageSize  int
+		wantTotal int
+		wantIDs   []string
+	}{
+		{
+			name:      "newest first, ties by id",
+			page:      1,
+			pageSize:  3,
+			wantTotal: 5,
+			wantIDs:   []string{"e", "d", "c"},
+		},
+		{
+			name:      "second page",
+			page:      2,
+			pageSize:  3,
+			wantTotal: 5,
+			wantIDs:   []string{"b", "a"},
+		},
+		{
+			name:      "status filter",
+			filter:    usecase.UploadFilter{Statuses: []entity.UploadStatus{entity.UploadStatusDone}},
+			page:      1,
+			pageSize:  10,
+			wantTotal: 3,
+			wantIDs:   []string{"e", "c", "a"},
+		},
+		{
+			name:      "created range is inclusive",
+			filter:    usecase.UploadFilter{CreatedFrom: 20, CreatedTo: 30},
+			page:      1,
+			pageSize:  10,
+			wantTotal: 2,
+			wantIDs:   []string{"c", "b"},
+		},
+		{
+			name:      "page past the end",
+			page:      9,
+			pageSize:  10,
+			wantTotal: 5,
+			wantIDs:   []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := s.ListUploads(ctx, tt.filter, tt.page, tt.pageSize)
+			if err != nil {
+				t.Fatalf("ListUploads() err = %v", err)
+			}
+			if total != tt.wantTotal || !reflect.DeepEqual(ids(got), tt.wantIDs) {
+				t.Fatalf("ListUploads() = %v (total %d), want %v (total %d)", ids(got), total, tt.wantIDs, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func testParseErrors(t *testing.T, s usecase.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, entity.UploadMeta{ID: "upload-1", Status: entity.UploadStatusProcessing})
+
+	first := []entity.ParseError{
+		{Line: 2, Field: "amount", Reason: "invalid amount", Raw: "1,A,CREDIT,x,SUCCESS,d"},
+		{Line: 5, Reason: "expected 6 fields, got 2", Raw: "a,b"},
+	}
+	second := []entity.ParseError{
+		{Line: 9, Field: "status", Reason: "invalid tx status: X", Raw: "1,A,CREDIT,1,X,d"},
+	}
+	if err := s.AppendParseErrors(ctx, "upload-1", first); err != nil {
+		t.Fatalf("AppendParseErrors() err = %v", err)
+	}
+	if err := s.AppendParseErrors(ctx, "upload-1", second); err != nil {
+		t.Fatalf("AppendParseErrors() err = %v", err)
+	}
+
+	got, total, meta, err := s.ListParseErrors(ctx, "upload-1", 1, 2)
+	if err != nil {
+		t.Fatalf("ListParseErrors() err = %v", err)
+	}
+	if total != 3 || !reflect.DeepEqual(got, first) || meta.ID != "upload-1" {
+		t.Fatalf("ListParseErrors() page 1 = %+v (total %d)", got, total)
+	}
+
+	got, _, _, err = s.ListParseErrors(ctx, "upload-1", 2, 2)
+	if err != nil {
+		t.Fatalf("ListParseErrors() err = %v", err)
+	}
+	if !reflect.DeepEqual(got, second) {
+		t.Fatalf("ListParseErrors() page 2 = %+v, want %+v", got, second)
+	}
+
+	got, total, _, err = s.ListParseErrors(ctx, "upload-1", 3, 2)
+	if err != nil {
+		t.Fatalf("ListParseErrors() err = %v", err)
+	}
+	if total != 3 || len(got) != 0 {
+		t.Fatalf("ListParseErrors() past the end = %+v (total %d)", got, total)
+	}
+}
+
+func testWebhookDeliveries(t *testing.T, s usecase.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, entity.UploadMeta{ID: "upload-1", Status: entity.UploadStatusDone})
+
+	if err := s.AppendWebhookDeliveries(ctx, "missing", []entity.WebhookDelivery{{}}); !errors.Is(err, pkgerror.ErrNotFound) {
+		t.Fatalf("AppendWebhookDeliveries() on missing upload err = %v", err)
+	}
+
+	deliveries := []entity.WebhookDelivery{
+		{EventID: "evt-1", URL: "http://a.test/hook", Attempt: 1, StatusCode: 503, Err: "unexpected status 503", At: 10},
+		{EventID: "evt-1", URL: "http://a.test/hook", Attempt: 2, StatusCode: 204, Delivered: true, At: 11},
+		{EventID: "evt-1", URL: "http://b.test/hook", Attempt: 1, Err: "connection refused", At: 10},
+	}
+	for _, delivery := range deliveries {
+		if err := s.AppendWebhookDeliveries(ctx, "upload-1", []entity.WebhookDelivery{delivery}); err != nil {
+			t.Fatalf("AppendWebhookDeliveries() err = %v", err)
+		}
+	}
+
+	got, total, meta, err := s.ListWebhookDeliveries(ctx, "upload-1", 1, 2)
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries() err = %v", err)
+	}
+	if total != 3 || !reflect.DeepEqual(got, deliveries[:2]) || meta.ID != "upload-1" {
+		t.Fatalf("ListWebhookDeliveries() page 1 = %+v (total %d)", got, total)
+	}
+
+	got, _, _, err = s.ListWebhookDeliveries(ctx, "upload-1", 2, 2)
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries() err = %v", err)
+	}
+	if !reflect.DeepEqual(got, deliveries[2:]) {
+		t.Fatalf("ListWebhookDeliveries() page 2 = %+v, want %+v", got, deliveries[2:])
+	}
+}
+
+func testClaimKey(t *testing.T, s usecase.Store) {
+	ctx := context.Background()
+	for _, id := range []string{"upload-1", "upload-2", "upload-3"} {
+		mustCreate(t, s, entity.UploadMeta{ID: id, Status: entity.UploadStatusDone})
+	}
+
+	if _, err := s.ClaimKey(ctx, "key", "missing", 0, 100); !errors.Is(err, pkgerror.ErrNotFound) {
+		t.Fatalf("ClaimKey() on missing upload err = %v", err)
+	}
+
+	claim := func(key, uploadID string, now, expiresAt int64, want string) {
+		t.Helper()
+		got, err := s.ClaimKey(ctx, key, uploadID, now, expiresAt)
+		if err != nil {
+			t.Fatalf("ClaimKey(%s, %s) err = %v", key, uploadID, err)
+		}
+		if got != want {
+			t.Fatalf("ClaimKey(%s, %s) = %s, want %s", key, uploadID, got, want)
+		}
+	}
+
+	claim("key", "upload-1", 10, 100, "upload-1")
+	claim("key", "upload-2", 50, 150, "upload-1")
+	claim("key", "upload-1", 60, 160, "upload-1")
+	claim("key", "upload-2", 100, 200, "upload-1")
+	claim("key", "upload-2", 160, 260, "upload-2")
+	claim("other", "upload-1", 160, 260, "upload-1")
+
+	if err := s.DeleteUpload(ctx, "upload-2"); err != nil {
+		t.Fatalf("DeleteUpload() err = %v", err)
+	}
+	claim("key", "upload-3", 170, 270, "upload-3")
+	claim("other", "upload-3", 170, 270, "upload-1")
+}
+
+func testReclaimKeyAfterExpiry(t *testing.T, s usecase.Store, reopen Reopener) {
+	ctx := context.Background()
+	for _, id := range []string{"upload-1", "upload-2", "upload-3"} {
+		mustCreate(t, s, entity.UploadMeta{ID: id, Status: entity.UploadStatusDone})
+	}
+
+	if owner, err := s.ClaimKey(ctx, "key", "upload-1", 10, 100); err != nil || owner != "upload-1" {
+		t.Fatalf("ClaimKey(upload-1) = %s, %v", owner, err)
+	}
+	if owner, err := s.ClaimKey(ctx, "key", "upload-2", 150, 250); err != nil || owner != "upload-2" {
+		t.Fatalf("ClaimKey(upload-2) after expiry = %s, %v", owner, err)
+	}
+
+	s = reopen(t, s)
+
+	if owner, err := s.ClaimKey(ctx, "key", "upload-3", 160, 260); err != nil || owner != "upload-2" {
+		t.Fatalf("ClaimKey(upload-3) after reopen = %s, %v, want upload-2", owner, err)
+	}
+}
+
+func testOutbox(t *testing.T, s usecase.Store) {
+	outbox, ok := s.(event.Outbox)
+	if !ok {
+		t.Skip("store does not implement event.Outbox")
+	}
+
+	ctx := context.Background()
+	events := []entity.FailedTxEvent{
+		{EventID: "evt-1", UploadID: "upload-1", Tx: sampleIssues()[0]},
+		{EventID: "evt-2", UploadID: "upload-1"},
+		{EventID: "evt-3", UploadID: "upload-2"},
+	}
+	for _, e := range append(events, events[0]) {
+		if err := outbox.AppendOutbox(ctx, e); err != nil {
+			t.Fatalf("AppendOutbox() err = %v", err)
+		}
+	}
+
+	pending, err := outbox.PendingOutbox(ctx)
+	if err != nil || !reflect.DeepEqual(pending, events) {
+		t.Fatalf("PendingOutbox() = %+v, %v, want %+v", pending, err, events)
+	}
+
+	if err := outbox.AckOutbox(ctx, "evt-2"); err != nil {
+		t.Fatalf("AckOutbox() err = %v", err)
+	}
+	first := entity.DeadLetter{Event: events[0], Attempts: 3, Err: "boom", FailedAt: 10}
+	if err := outbox.SaveDeadLetter(ctx, first); err != nil {
+		t.Fatalf("SaveDeadLetter() err = %v", err)
+	}
+	if err := outbox.SaveDeadLetter(ctx, entity.DeadLetter{Event: events[2], Attempts: 1, Err: "bad request", FailedAt: 11}); err != nil {
+		t.Fatalf("SaveDeadLetter() err = %v", err)
+	}
+
+	pending, err = outbox.PendingOutbox(ctx)
+	if err != nil || len(pending) != 0 {
+		t.Fatalf("PendingOutbox() after ack and dead letters = %+v, %v", pending, err)
+	}
+
+	first.Attempts, first.Err = 4, "still failing"
+	if err := outbox.SaveDeadLetter(ctx, first); err != nil {
+		t.Fatalf("SaveDeadLetter() update err = %v", err)
+	}
+
+	letters, total, err := outbox.ListDeadLetters(ctx, 1, 1)
+	if err != nil || total != 2 || len(letters) != 1 || !reflect.DeepEqual(letters[0], first) {
+		t.Fatalf("ListDeadLetters() = %+v (total %d), %v", letters, total, err)
+	}
+
+	got, err := outbox.GetDeadLetter(ctx, "evt-3")
+	if err != nil || got.Err != "bad request" {
+		t.Fatalf("GetDeadLetter() = %+v, %v", got, err)
+	}
+	if err := outbox.DeleteDeadLetter(ctx, "evt-3"); err != nil {
+		t.Fatalf("DeleteDeadLetter() err = %v", err)
+	}
+	if _, err := outbox.GetDeadLetter(ctx, "evt-3"); !errors.Is(err, pkgerror.ErrNotFound) {
+		t.Fatalf("GetDeadLetter() after delete err = %v", err)
+	}
+	if err := outbox.DeleteDeadLetter(ctx, "evt-3"); !errors.Is(err, pkgerror.ErrNotFound) {
+		t.Fatalf("DeleteDeadLetter() twice err = %v", err)
+	}
+}
+
+func testHandledEvents(t *testing.T, s usecase.Store) {
+	handled, ok := s.(event.HandledStore)
+	if !ok {
+		t.Skip("store does not implement event.HandledStore")
+	}
+
+	ctx := context.Background()
+	if ok, err := handled.IsHandled(ctx, "evt-1", 100); err != nil || ok {
+		t.Fatalf("IsHandled() unknown = %v, %v", ok, err)
+	}
+
+	if err := handled.MarkHandled(ctx, "evt-1", 200); err != nil {
+		t.Fatalf("MarkHandled() err = %v", err)
+	}
+	if ok, err := handled.IsHandled(ctx, "evt-1", 199); err != nil || !ok {
+		t.Fatalf("IsHandled() before expiry = %v, %v", ok, err)
+	}
+	if ok, err := handled.IsHandled(ctx, "evt-1", 200); err != nil || ok {
+		t.Fatalf("IsHandled() at expiry = %v, %v", ok, err)
+	}
+
+	if err := handled.MarkHandled(ctx, "evt-1", 300); err != nil {
+		t.Fatalf("MarkHandled() again err = %v", err)
+	}
+	if ok, err := handled.IsHandled(ctx, "evt-1", 250); err != nil || !ok {
+		t.Fatalf("IsHandled() after extending = %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,174 @@
+package flip
+
+import (
+	"context"
+
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/flip/usecase"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgtrace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/shandysiswandi/goflip/internal/flip"
+
+// tracedBackend wraps every call to a store backend in a client span named
+// after the method.
+type tracedBackend struct {
+	next backend
+}
+
+var _ backend = tracedBackend{}
+
+func (b tracedBackend) start(ctx context.Context, method, uploadID string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("db.operation.name", method)}
+	if uploadID != "" {
+		attrs = append(attrs, attribute.String("upload.id", uploadID))
+	}
+	return otel.Tracer(tracerName).Start(ctx, "store."+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+func (b tracedBackend) CreateUpload(ctx context.Context, meta entity.UploadMeta) (err error) {
+	ctx, span := b.start(ctx, "CreateUpload", meta.ID)
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.CreateUpload(ctx, meta)
+}
+
+func (b tracedBackend) UpdateMeta(ctx context.Context, uploadID string, fn func(meta *entity.UploadMeta)) (err error) {
+	ctx, span := b.start(ctx, "UpdateMeta", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.UpdateMeta(ctx, uploadID, fn)
+}
+
+func (b tracedBackend) SaveResults(ctx context.Context, uploadID string, balances entity.Balances, issues []entity.Transaction, totalLines, parsedOK, parseErr int64) (err error) {
+	ctx, span := b.start(ctx, "SaveResults", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.SaveResults(ctx, uploadID, balances, issues, totalLines, parsedOK, parseErr)
+}
+
+func (b tracedBackend) GetBalance(ctx context.Context, uploadID string) (_ entity.Balances, _ entity.UploadMeta, err error) {
+	ctx, span := b.start(ctx, "GetBalance", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.GetBalance(ctx, uploadID)
+}
+
+func (b tracedBackend) ListUploads(ctx context.Context, filter usecase.UploadFilter, page, pageSize int) (_ []entity.UploadMeta, _ int, err error) {
+	ctx, span := b.start(ctx, "ListUploads", "")
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.ListUploads(ctx, filter, page, pageSize)
+}
+
+func (b tracedBackend) ListIssues(ctx context.Context, uploadID string, filter usecase.IssueFilter, page, pageSize int) (_ []entity.Transaction, _ int, _ entity.UploadMeta, err error) {
+	ctx, span := b.start(ctx, "ListIssues", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.ListIssues(ctx, uploadID, filter, page, pageSize)
+}
+
+func (b tracedBackend) AppendTransactions(ctx context.Context, uploadID string, txs []entity.Transaction) (err error) {
+	ctx, span := b.start(ctx, "AppendTransactions", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.AppendTransactions(ctx, uploadID, txs)
+}
+
+func (b tracedBackend) ListTransactions(ctx context.Context, uploadID string, filter usecase.IssueFilter, page, pageSize int) (_ []entity.Transaction, _ int, _ entity.UploadMeta, err error) {
+	ctx, span := b.start(ctx, "ListTransactions", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.ListTransactions(ctx, uploadID, filter, page, pageSize)
+}
+
+func (b tracedBackend) AppendParseErrors(ctx context.Context, uploadID string, errs []entity.ParseError) (err error) {
+	ctx, span := b.start(ctx, "AppendParseErrors", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.AppendParseErrors(ctx, uploadID, errs)
+}
+
+func (b tracedBackend) ListParseErrors(ctx context.Context, uploadID string, page, pageSize int) (_ []entity.ParseError, _ int, _ entity.UploadMeta, err error) {
+	ctx, span := b.start(ctx, "ListParseErrors", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.ListParseErrors(ctx, uploadID, page, pageSize)
+}
+
+func (b tracedBackend) AppendWebhookDeliveries(ctx context.Context, uploadID string, deliveries []entity.WebhookDelivery) (err error) {
+	ctx, span := b.start(ctx, "AppendWebhookDeliveries", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.AppendWebhookDeliveries(ctx, uploadID, deliveries)
+}
+
+func (b tracedBackend) ListWebhookDeliveries(ctx context.Context, uploadID string, page, pageSize int) (_ []entity.WebhookDelivery, _ int, _ entity.UploadMeta, err error) {
+	ctx, span := b.start(ctx, "ListWebhookDeliveries", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.ListWebhookDeliveries(ctx, uploadID, page, pageSize)
+}
+
+func (b tracedBackend) ClaimKey(ctx context.Context, key, uploadID string, now, expiresAt int64) (_ string, err error) {
+	ctx, span := b.start(ctx, "ClaimKey", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.ClaimKey(ctx, key, uploadID, now, expiresAt)
+}
+
+func (b tracedBackend) DeleteUpload(ctx context.Context, uploadID string) (err error) {
+	ctx, span := b.start(ctx, "DeleteUpload", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.DeleteUpload(ctx, uploadID)
+}
+
+func (b tracedBackend) PruneUploads(ctx context.Context, endedBefore int64, maxUploads int) (_ []string, err error) {
+	ctx, span := b.start(ctx, "PruneUploads", "")
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.PruneUploads(ctx, endedBefore, maxUploads)
+}
+
+func (b tracedBackend) AppendOutbox(ctx context.Context, event entity.FailedTxEvent) (err error) {
+	ctx, span := b.start(ctx, "AppendOutbox", event.UploadID)
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.AppendOutbox(ctx, event)
+}
+
+func (b tracedBackend) AckOutbox(ctx context.Context, eventID string) (err error) {
+	ctx, span := b.start(ctx, "AckOutbox", "")
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.AckOutbox(ctx, eventID)
+}
+
+func (b tracedBackend) PendingOutbox(ctx context.Context) (_ []entity.FailedTxEvent, err error) {
+	ctx, span := b.start(ctx, "PendingOutbox", "")
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.PendingOutbox(ctx)
+}
+
+func (b tracedBackend) SaveDeadLetter(ctx context.Context, letter entity.DeadLetter) (err error) {
+	ctx, span := b.start(ctx, "SaveDeadLetter", letter.Event.UploadID)
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.SaveDeadLetter(ctx, letter)
+}
+
+func (b tracedBackend) ListDeadLetters(ctx context.Context, page, pageSize int) (_ []entity.DeadLetter, _ int, err error) {
+	ctx, span := b.start(ctx, "ListDeadLetters", "")
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.ListDeadLetters(ctx, page, pageSize)
+}
+
+func (b tracedBackend) GetDeadLetter(ctx context.Context, eventID string) (_ entity.DeadLetter, err error) {
+	ctx, span := b.start(ctx, "GetDeadLetter", "")
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.GetDeadLetter(ctx, eventID)
+}
+
+func (b tracedBackend) DeleteDeadLetter(ctx context.Context, eventID string) (err error) {
+	ctx, span := b.start(ctx, "DeleteDeadLetter", "")
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.DeleteDeadLetter(ctx, eventID)
+}
+
+func (b tracedBackend) MarkHandled(ctx context.Context, eventID string, expiresAt int64) (err error) {
+	ctx, span := b.start(ctx, "MarkHandled", "")
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.MarkHandled(ctx, eventID, expiresAt)
+}
+
+func (b tracedBackend) IsHandled(ctx context.Context, eventID string, now int64) (_ bool, err error) {
+	ctx, span := b.start(ctx, "IsHandled", "")
+	defer func() { pkgtrace.End(span, err) }()
+	return b.next.IsHandled(ctx, eventID, now)
+}
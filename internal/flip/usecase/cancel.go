@@ -0,0 +1,156 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgerror"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgtrace"
+)
+
+// errUploadCanceled is the cancel cause of an upload stopped through Cancel,
+// and the error recorded on its meta.
+var errUploadCanceled = errors.New("upload canceled")
+
+// inflight tracks the uploads this process is working on, so one can be
+// canceled and waited for.
+type inflight struct {
+	mu   sync.Mutex
+	runs map[string]*run
+}
+
+type run struct {
+	cancel context.CancelCauseFunc
+	done   chan struct{}
+}
+
+func newInflight() *inflight {
+	return &inflight{runs: make(map[string]*run)}
+}
+
+func (f *inflight) add(uploadID string, cancel context.CancelCauseFunc) {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.runs[uploadID] = &run{cancel: cancel, done: make(chan struct{})}
+}
+
+// remove releases the context of uploadID and wakes up Cancel callers.
+func (f *inflight) remove(uploadID string) {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	r, ok := f.runs[uploadID]
+	delete(f.runs, uploadID)
+	f.mu.Unlock()
+
+	if ok {
+		r.cancel(nil)
+		close(r.done)
+	}
+}
+
+// cancel stops uploadID and returns a channel closed once its processing has
+// returned, or false if this process is not working on it.
+func (f *inflight) cancel(uploadID string) (<-chan struct{}, bool) {
+	if f == nil {
+		return nil, false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r, ok := f.runs[uploadID]
+	if !ok {
+		return nil, false
+	}
+
+	r.cancel(errUploadCanceled)
+	return r.done, true
+}
+
+// abandonUpload finishes an upload whose context ended while it waited for a
+// runner slot, so it was never processed. Cancel marks it CANCELED; any other
+// end, such as shutdown, marks it FAILED.
+func (u *Usecase) abandonUpload(ctx context.Context, uploadID string) {
+	defer u.inflight.remove(uploadID)
+	defer u.progress.finish(uploadID)
+
+	status, errMsg := entity.UploadStatusCanceled, errUploadCanceled.Error()
+	if cause := context.Cause(ctx); !errors.Is(cause, errUploadCanceled) {
+		status, errMsg = entity.UploadStatusFailed, cause.Error()
+	}
+	ctx = context.WithoutCancel(ctx)
+
+	endedAt := u.clock.Now().Unix()
+	var final entity.UploadMeta
+	if err := u.store.UpdateMeta(ctx, uploadID, func(meta *entity.UploadMeta) {
+		if !meta.Status.IsFinal() {
+			meta.Status = status
+			meta.Err = errMsg
+			meta.EndedAt = endedAt
+		}
+		final = *meta
+	}); err != nil {
+		slog.ErrorContext(ctx, "failed to finish unstarted upload", "upload_id", uploadID, "error", err)
+		return
+	}
+
+	slog.WarnContext(ctx, "upload ended before it started", "upload_id", uploadID, "status", final.Status)
+	u.progress.publish(uploadID, ProgressEvent{Type: ProgressSummary, Statement: u.toStatementResult(final)})
+	u.publishCompleted(ctx, final, nil)
+}
+
+// Cancel stops an upload that is queued or processing and marks it CANCELED.
+// It returns once processing has stopped. Failed transactions already
+// published stay published, and the balance of a canceled upload is left
+// empty rather than showing a partial sum.
+func (u *Usecase) Cancel(ctx context.Context, uploadID string) (_ StatementResult, err error) {
+	ctx, span := startSpan(ctx, "Cancel", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+
+	if uploadID == "" {
+		return StatementResult{}, pkgerror.NewInvalidInput(errors.New("upload_id is required"))
+	}
+
+	_, meta, err := u.store.GetBalance(ctx, uploadID)
+	if err != nil {
+		return StatementResult{}, mapStoreErr(err)
+	}
+
+	if meta.Status.IsFinal() {
+		return StatementResult{}, pkgerror.NewBusiness("upload is already finished", pkgerror.CodeConflict)
+	}
+
+	if done, ok := u.inflight.cancel(uploadID); ok {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return StatementResult{}, normalizeErr(ctx.Err())
+		}
+	} else {
+		// Nothing works on the upload in this process, e.g. it was left
+		// behind by a restart, so it is marked directly.
+		endedAt := u.clock.Now().Unix()
+		if err := u.store.UpdateMeta(ctx, uploadID, func(meta *entity.UploadMeta) {
+			if !meta.Status.IsFinal() {
+				meta.Status = entity.UploadStatusCanceled
+				meta.Err = errUploadCanceled.Error()
+				meta.EndedAt = endedAt
+			}
+		}); err != nil {
+			return StatementResult{}, mapStoreErr(err)
+		}
+	}
+
+	return u.Statement(ctx, uploadID)
+}
@@ -0,0 +1,140 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgerror"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgtrace"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// deadLetterPageSize is how many dead letters are read per page when all of
+// them are replayed.
+const deadLetterPageSize = 100
+
+// DeadLetterQueue lists failed-transaction events the consumer gave up on and
+// hands them to its handler again.
+type DeadLetterQueue interface {
+	DeadLetters(ctx context.Context, page, pageSize int) ([]entity.DeadLetter, int, error)
+	ReplayDeadLetter(ctx context.Context, eventID string) (entity.DeadLetter, bool, error)
+}
+
+func (u *Usecase) DeadLetters(ctx context.Context, page, pageSize int) (_ DeadLettersResult, err error) {
+	ctx, span := startSpan(ctx, "DeadLetters", "")
+	defer func() { pkgtrace.End(span, err) }()
+
+	if u.deadLetters == nil {
+		return DeadLettersResult{}, errDeadLettersDisabled()
+	}
+
+	if page < 1 || pageSize < 1 {
+		return DeadLettersResult{}, pkgerror.NewInvalidInput(errors.New("invalid pagination"))
+	}
+
+	letters, total, err := u.deadLetters.DeadLetters(ctx, page, pageSize)
+	if err != nil {
+		return DeadLettersResult{}, normalizeErr(err)
+	}
+
+	return DeadLettersResult{
+		DeadLetters: letters,
+		Page:        page,
+		PageSize:    pageSize,
+		Total:       total,
+	}, nil
+}
+
+// ReplayDeadLetter replays a single dead letter. A handler failure is not an
+// error; it is reported in ReplayResult.Failed.
+func (u *Usecase) ReplayDeadLetter(ctx context.Context, eventID string) (_ ReplayResult, err error) {
+	ctx, span := startSpan(ctx, "ReplayDeadLetter", "", attribute.String("event.id", eventID))
+	defer func() { pkgtrace.End(span, err) }()
+
+	if u.deadLetters == nil {
+		return ReplayResult{}, errDeadLettersDisabled()
+	}
+
+	if eventID == "" {
+		return ReplayResult{}, pkgerror.NewInvalidInput(errors.New("event_id is required"))
+	}
+
+	var result ReplayResult
+	if err := u.replay(ctx, eventID, &result); err != nil {
+		if errors.Is(err, pkgerror.ErrNotFound) {
+			return ReplayResult{}, pkgerror.NewBusiness("dead letter not found", pkgerror.CodeNotFound)
+		}
+		return ReplayResult{}, normalizeErr(err)
+	}
+
+	return result, nil
+}
+
+// ReplayDeadLetters replays the given dead letters, or all of them when
+// eventIDs is empty. Unknown IDs are reported in ReplayResult.NotFound.
+func (u *Usecase) ReplayDeadLetters(ctx context.Context, eventIDs []string) (_ ReplayResult, err error) {
+	ctx, span := startSpan(ctx, "ReplayDeadLetters", "", attribute.Int("event.count", len(eventIDs)))
+	defer func() { pkgtrace.End(span, err) }()
+
+	if u.deadLetters == nil {
+		return ReplayResult{}, errDeadLettersDisabled()
+	}
+
+	if len(eventIDs) == 0 {
+		ids, err := u.deadLetterIDs(ctx)
+		if err != nil {
+			return ReplayResult{}, normalizeErr(err)
+		}
+		eventIDs = ids
+	}
+
+	var result ReplayResult
+	for _, eventID := range eventIDs {
+		err := u.replay(ctx, eventID, &result)
+		switch {
+		case errors.Is(err, pkgerror.ErrNotFound):
+			result.NotFound = append(result.NotFound, eventID)
+		case err != nil:
+			return result, normalizeErr(err)
+		}
+	}
+
+	return result, nil
+}
+
+func (u *Usecase) replay(ctx context.Context, eventID string, result *ReplayResult) error {
+	letter, replayed, err := u.deadLetters.ReplayDeadLetter(ctx, eventID)
+	if err != nil {
+		return err
+	}
+
+	if replayed {
+		result.Replayed = append(result.Replayed, eventID)
+	} else {
+		result.Failed = append(result.Failed, letter)
+	}
+	return nil
+}
+
+// deadLetterIDs collects the IDs first, since replaying removes dead letters
+// and would shift the pages.
+func (u *Usecase) deadLetterIDs(ctx context.Context) ([]string, error) {
+	var ids []string
+	for page := 1; ; page++ {
+		letters, total, err := u.deadLetters.DeadLetters(ctx, page, deadLetterPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, letter := range letters {
+			ids = append(ids, letter.Event.EventID)
+		}
+		if len(letters) == 0 || page*deadLetterPageSize >= total {
+			return ids, nil
+		}
+	}
+}
+
+func errDeadLettersDisabled() error {
+	return pkgerror.NewBusiness("dead letter queue is not enabled", pkgerror.CodeNotFound)
+}
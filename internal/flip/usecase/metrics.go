@@ -0,0 +1,64 @@
+package usecase
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+)
+
+// Metrics counts uploads and the lines they parse. A nil *Metrics records
+// nothing.
+type Metrics struct {
+	inProgress  prometheus.Gauge
+	uploads     *prometheus.CounterVec
+	lines       prometheus.Counter
+	parseErrors prometheus.Counter
+}
+
+// NewMetrics registers the upload metrics on reg, unless reg is nil.
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		inProgress: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "flip_uploads_in_progress",
+			Help: "Uploads being parsed.",
+		}),
+		uploads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flip_uploads_total",
+			Help: "Uploads that finished processing, by final status.",
+		}, []string{"status"}),
+		lines: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "flip_lines_parsed_total",
+			Help: "CSV lines read, including the ones that failed to parse.",
+		}),
+		parseErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "flip_parse_errors_total",
+			Help: "CSV lines that failed to parse.",
+		}),
+	}
+	if reg != nil {
+		reg.MustRegister(m.inProgress, m.uploads, m.lines, m.parseErrors)
+	}
+	return m
+}
+
+func (m *Metrics) started() {
+	if m != nil {
+		m.inProgress.Inc()
+	}
+}
+
+func (m *Metrics) finished(status entity.UploadStatus) {
+	if m != nil {
+		m.inProgress.Dec()
+		m.uploads.WithLabelValues(string(status)).Inc()
+	}
+}
+
+func (m *Metrics) line(parsed bool) {
+	if m == nil {
+		return
+	}
+	m.lines.Inc()
+	if !parsed {
+		m.parseErrors.Inc()
+	}
+}
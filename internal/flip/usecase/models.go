@@ -1,19 +1,41 @@
 package usecase
 
 import (
+	"io"
 	"slices"
+	"time"
 
 	"github.com/shandysiswandi/goflip/internal/flip/entity"
 )
 
+// UploadOptions tunes how an uploaded file is parsed. An empty Profile uses
+// the default layout. CallbackURL receives a webhook once the upload is final.
+// A repeated IdempotencyKey returns the upload it was first used for.
+type UploadOptions struct {
+	Profile        string
+	FileName       string
+	CallbackURL    string
+	IdempotencyKey string
+}
+
+// UploadPart is one file of an upload. Parts are parsed in order, each with
+// its own header row, and their results are combined.
+type UploadPart struct {
+	Name   string
+	Reader io.Reader
+}
+
+// UploadResult reports Replayed when the idempotency key matched an earlier
+// upload and nothing new was started.
 type UploadResult struct {
 	UploadID string
+	Replayed bool
 }
 
 type BalanceResult struct {
 	UploadID string
 	Status   entity.UploadStatus
-	Balance  int64
+	Balances entity.Balances
 }
 
 type IssuesResult struct {
@@ -25,6 +47,85 @@ type IssuesResult struct {
 	Total        int
 }
 
+type TransactionsResult struct {
+	UploadID     string
+	Status       entity.UploadStatus
+	Transactions []entity.Transaction
+	Page         int
+	PageSize     int
+	Total        int
+}
+
+type ParseErrorsResult struct {
+	UploadID string
+	Status   entity.UploadStatus
+	Errors   []entity.ParseError
+	ParseErr int64
+	Page     int
+	PageSize int
+	Total    int
+}
+
+type WebhookDeliveriesResult struct {
+	UploadID   string
+	Status     entity.UploadStatus
+	Deliveries []entity.WebhookDelivery
+	Page       int
+	PageSize   int
+	Total      int
+}
+
+type DeadLettersResult struct {
+	DeadLetters []entity.DeadLetter
+	Page        int
+	PageSize    int
+	Total       int
+}
+
+// ReplayResult lists the dead letters the handler accepted, the ones it
+// failed again with their new error, and requested IDs that do not exist.
+type ReplayResult struct {
+	Replayed []string
+	Failed   []entity.DeadLetter
+	NotFound []string
+}
+
+type StatementResult struct {
+	Meta     entity.UploadMeta
+	Duration time.Duration
+}
+
+type StatementsResult struct {
+	Uploads  []StatementResult
+	Page     int
+	PageSize int
+	Total    int
+}
+
+// UploadFilter selects uploads by status and by a [CreatedFrom, CreatedTo]
+// range of Unix seconds. Zero values match everything.
+type UploadFilter struct {
+	Statuses    []entity.UploadStatus
+	CreatedFrom int64
+	CreatedTo   int64
+}
+
+func (f UploadFilter) Matches(meta entity.UploadMeta) bool {
+	if len(f.Statuses) > 0 && !slices.Contains(f.Statuses, meta.Status) {
+		return false
+	}
+
+	if f.CreatedFrom > 0 && meta.CreatedAt < f.CreatedFrom {
+		return false
+	}
+
+	if f.CreatedTo > 0 && meta.CreatedAt > f.CreatedTo {
+		return false
+	}
+
+	return true
+}
+
 type IssueFilter struct {
 	Statuses []entity.TxStatus
 	Types    []entity.TxType
@@ -3,87 +3,258 @@ package usecase
 import (
 	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
-	"strconv"
 	"strings"
 
 	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgdecimal"
 )
 
-func parseCSV(ctx context.Context, r io.Reader, onTx func(tx entity.Transaction)) (int64, int64, int64, error) {
-	reader := csv.NewReader(r)
+// maxRawLineLen caps how much of a rejected line is kept in its ParseError.
+const maxRawLineLen = 256
+
+// rawTapCompactAt is how many consumed bytes rawTap holds before dropping
+// them, so it does not shift its buffer on every record.
+const rawTapCompactAt = 64 << 10
+
+// fieldError reports which column of a record was rejected.
+type fieldError struct {
+	field string
+	err   error
+}
+
+func (e *fieldError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fieldError) Unwrap() error {
+	return e.err
+}
+
+// parseParts parses every part in order and sums their counters. It stops at
+// the first part that cannot be read.
+func parseParts(ctx context.Context, parts []UploadPart, profile ParseProfile, onTx func(tx entity.Transaction) error, onErr func(perr entity.ParseError)) (int64, int64, int64, error) {
+	var totalLines, parsedOK, parseErr int64
+	for _, part := range parts {
+		total, ok, failed, err := parseCSV(ctx, part.Reader, profile, onTx, func(perr entity.ParseError) {
+			perr.File = part.Name
+			onErr(perr)
+		})
+		totalLines += total
+		parsedOK += ok
+		parseErr += failed
+		if err != nil {
+			if part.Name != "" {
+				err = fmt.Errorf("%s: %w", part.Name, err)
+			}
+			return totalLines, parsedOK, parseErr, err
+		}
+	}
+
+	return totalLines, parsedOK, parseErr, nil
+}
+
+// rawTap keeps the bytes read from r that the csv reader has not moved past
+// yet, so a rejected record can be reported as it was written.
+type rawTap struct {
+	r    io.Reader
+	buf  []byte
+	base int64 // input offset of buf[0]
+}
+
+func (t *rawTap) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.buf = append(t.buf, p[:n]...)
+	return n, err
+}
+
+// text returns the input between two offsets, without the line ending.
+func (t *rawTap) text(start, end int64) string {
+	if start < t.base || end-t.base > int64(len(t.buf)) || start > end {
+		return ""
+	}
+	return strings.TrimRight(string(t.buf[start-t.base:end-t.base]), "\r\n")
+}
+
+// release forgets the input before offset.
+func (t *rawTap) release(offset int64) {
+	drop := offset - t.base
+	if drop < rawTapCompactAt {
+		return
+	}
+	t.buf = t.buf[:copy(t.buf, t.buf[drop:])]
+	t.base = offset
+}
+
+func parseCSV(ctx context.Context, r io.Reader, profile ParseProfile, onTx func(tx entity.Transaction) error, onErr func(perr entity.ParseError)) (int64, int64, int64, error) {
+	tap := &rawTap{r: r}
+	reader := csv.NewReader(tap)
 	reader.TrimLeadingSpace = true
 	reader.ReuseRecord = true
 	reader.FieldsPerRecord = -1
+	if profile.Delimiter != 0 {
+		reader.Comma = profile.Delimiter
+	}
 
 	var totalLines int64
 	var parsedOK int64
 	var parseErr int64
 
+	var cols layout
+	var err error
+	if profile.usesHeader() {
+		cols, err = readHeader(reader, profile)
+		if errors.Is(err, io.EOF) {
+			return 0, 0, 0, nil
+		}
+	} else {
+		cols, err = profile.positionalLayout()
+	}
+	if err != nil {
+		if cause := context.Cause(ctx); cause != nil {
+			return totalLines, parsedOK, parseErr, cause
+		}
+		parseErr++
+		slog.WarnContext(ctx, "failed to read csv header", "profile", profile.Name, "error", err)
+		onErr(newParseError(readErrLine(err, 1), "", &fieldError{field: "header", err: err}))
+		return totalLines, parsedOK, parseErr, err
+	}
+
+	// A canceled upload also has its readers closed, so a read error is
+	// reported as the cancel cause rather than as a malformed line.
+	done := ctx.Done()
 	for {
+		select {
+		case <-done:
+			return totalLines, parsedOK, parseErr, context.Cause(ctx)
+		default:
+		}
+
+		start := reader.InputOffset()
+		tap.release(start)
 		record, err := reader.Read()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
+			if cause := context.Cause(ctx); cause != nil {
+				return totalLines, parsedOK, parseErr, cause
+			}
 			parseErr++
 			slog.WarnContext(ctx, "failed to read csv line", "error", err)
+			onErr(newParseError(readErrLine(err, totalLines+1), "", err))
 			return totalLines, parsedOK, parseErr, err
 		}
 
 		totalLines++
-		tx, err := parseRecord(record)
+		line, _ := reader.FieldPos(0)
+		tx, err := parseRecord(cols, profile, record)
 		if err != nil {
 			parseErr++
-			slog.WarnContext(ctx, "failed to parse csv record", "error", err)
+			slog.WarnContext(ctx, "failed to parse csv record", "line", line, "error", err)
+			onErr(newParseError(int64(line), tap.text(start, reader.InputOffset()), err))
 			continue
 		}
 
 		parsedOK++
-		onTx(tx)
+		if err := onTx(tx); err != nil {
+			return totalLines, parsedOK, parseErr, err
+		}
 	}
 
 	return totalLines, parsedOK, parseErr, nil
 }
 
-func parseRecord(record []string) (entity.Transaction, error) {
-	if len(record) != 6 {
-		return entity.Transaction{}, fmt.Errorf("expected 6 fields, got %d", len(record))
+// readHeader consumes the first row. With HeaderNames it resolves the column
+// positions from it, otherwise the row is dropped and the positional layout
+// is used.
+func readHeader(reader *csv.Reader, profile ParseProfile) (layout, error) {
+	header, err := reader.Read()
+	if err != nil {
+		return layout{}, err
+	}
+
+	if len(profile.HeaderNames) == 0 {
+		return profile.positionalLayout()
+	}
+
+	return profile.headerLayout(header)
+}
+
+func newParseError(line int64, raw string, err error) entity.ParseError {
+	perr := entity.ParseError{
+		Line:   line,
+		Reason: err.Error(),
+		Raw:    raw,
+	}
+
+	var ferr *fieldError
+	if errors.As(err, &ferr) {
+		perr.Field = ferr.field
+	}
+
+	if len(perr.Raw) > maxRawLineLen {
+		perr.Raw = strings.ToValidUTF8(perr.Raw[:maxRawLineLen], "")
+	}
+
+	return perr
+}
+
+func readErrLine(err error, fallback int64) int64 {
+	var csvErr *csv.ParseError
+	if errors.As(err, &csvErr) {
+		return int64(csvErr.Line)
+	}
+	return fallback
+}
+
+func parseRecord(cols layout, profile ParseProfile, record []string) (entity.Transaction, error) {
+	if len(record) < cols.fields || (len(record) > cols.fields && !profile.AllowExtraColumns) {
+		return entity.Transaction{}, fmt.Errorf("expected %d fields, got %d", cols.fields, len(record))
 	}
 
 	for i := range record {
 		record[i] = strings.TrimSpace(record[i])
 	}
 
-	timestamp, err := strconv.ParseInt(record[0], 10, 64)
+	timestamp, err := parseTimestamp(cols.value(record, ColumnTimestamp), profile.TimestampFormat, profile.Location)
 	if err != nil {
-		return entity.Transaction{}, fmt.Errorf("invalid timestamp: %w", err)
+		return entity.Transaction{}, &fieldError{field: "timestamp", err: fmt.Errorf("invalid timestamp: %w", err)}
 	}
 
-	txType, err := parseTxType(record[2])
+	txType, err := parseTxType(cols.value(record, ColumnType))
 	if err != nil {
-		return entity.Transaction{}, err
+		return entity.Transaction{}, &fieldError{field: "type", err: err}
 	}
 
-	amount, err := strconv.ParseInt(record[3], 10, 64)
+	amount, err := pkgdecimal.ParseLocale(cols.value(record, ColumnAmount), profile.ThousandsSeparator, profile.decimalSeparator())
 	if err != nil {
-		return entity.Transaction{}, fmt.Errorf("invalid amount: %w", err)
+		return entity.Transaction{}, &fieldError{field: "amount", err: fmt.Errorf("invalid amount: %w", err)}
 	}
 
-	status, err := parseTxStatus(record[4])
+	currency := profile.currency()
+	if raw := cols.value(record, ColumnCurrency); raw != "" {
+		if currency, err = parseCurrency(raw); err != nil {
+			return entity.Transaction{}, &fieldError{field: "currency", err: err}
+		}
+	}
+
+	status, err := parseTxStatus(cols.value(record, ColumnStatus))
 	if err != nil {
-		return entity.Transaction{}, err
+		return entity.Transaction{}, &fieldError{field: "status", err: err}
 	}
 
 	return entity.Transaction{
 		Timestamp:    timestamp,
-		Counterparty: record[1],
+		Counterparty: cols.value(record, ColumnCounterparty),
 		Type:         txType,
 		Amount:       amount,
+		Currency:     currency,
 		Status:       status,
-		Description:  record[5],
+		Description:  cols.value(record, ColumnDescription),
 	}, nil
 }
 
@@ -98,6 +269,20 @@ func parseTxType(value string) (entity.TxType, error) {
 	}
 }
 
+// parseCurrency accepts a three-letter ISO 4217 style code.
+func parseCurrency(value string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(value))
+	if len(code) != 3 {
+		return "", fmt.Errorf("invalid currency: %s", value)
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", fmt.Errorf("invalid currency: %s", value)
+		}
+	}
+	return code, nil
+}
+
 func parseTxStatus(value string) (entity.TxStatus, error) {
 	switch strings.ToUpper(value) {
 	case string(entity.TxStatusSuccess):
@@ -0,0 +1,237 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Column names a ParseProfile can map.
+const (
+	ColumnTimestamp    = "timestamp"
+	ColumnCounterparty = "counterparty"
+	ColumnType         = "type"
+	ColumnAmount       = "amount"
+	ColumnStatus       = "status"
+	ColumnDescription  = "description"
+	ColumnCurrency     = "currency"
+)
+
+// ColumnIgnored marks a positional column that is present in the file but not used.
+const ColumnIgnored = "-"
+
+// DefaultProfileName is used when an upload does not pick a profile.
+const DefaultProfileName = "default"
+
+// DefaultCurrency is assumed for rows without a currency column when the
+// profile does not set its own.
+const DefaultCurrency = "IDR"
+
+// ParseProfile describes how one bank export lays out its CSV.
+type ParseProfile struct {
+	Name string
+
+	// Columns lists the column name found at each position. Use ColumnIgnored
+	// for positions that should be skipped.
+	Columns []string
+
+	// HeaderNames maps column names to the header labels that hold them. When
+	// set, the first row is read as a header and positions are resolved from
+	// it, so Columns is ignored.
+	HeaderNames map[string]string
+
+	// SkipHeader drops the first row when mapping by position.
+	SkipHeader bool
+
+	// Delimiter defaults to a comma.
+	Delimiter rune
+
+	// AllowExtraColumns accepts rows with more fields than the layout needs.
+	AllowExtraColumns bool
+
+	// Currency is used for rows without a currency column. Defaults to
+	// DefaultCurrency.
+	Currency string
+
+	// ThousandsSeparator groups integer digits in amounts, e.g. '.' for
+	// "1.250.000,50". Zero disallows grouping.
+	ThousandsSeparator rune
+
+	// DecimalSeparator defaults to '.'.
+	DecimalSeparator rune
+
+	// TimestampFormat is TimestampAuto (the default), TimestampUnix,
+	// TimestampUnixMS or a Go time layout such as "02/01/2006 15:04".
+	TimestampFormat string
+
+	// Location is used for timestamps without an offset. Defaults to
+	// Dependency.Location.
+	Location *time.Location
+}
+
+// DefaultParseProfile is the original six-column, header-less layout.
+func DefaultParseProfile() ParseProfile {
+	return ParseProfile{
+		Name: DefaultProfileName,
+		Columns: []string{
+			ColumnTimestamp,
+			ColumnCounterparty,
+			ColumnType,
+			ColumnAmount,
+			ColumnStatus,
+			ColumnDescription,
+		},
+		Delimiter:       ',',
+		TimestampFormat: TimestampAuto,
+	}
+}
+
+//nolint:gochecknoglobals // fixed list of columns a layout resolves
+var profileColumns = []string{
+	ColumnTimestamp,
+	ColumnCounterparty,
+	ColumnType,
+	ColumnAmount,
+	ColumnStatus,
+	ColumnDescription,
+	ColumnCurrency,
+}
+
+func isRequiredColumn(name string) bool {
+	return name != ColumnDescription && name != ColumnCurrency
+}
+
+// Validate reports whether the profile can be used to parse a file.
+func (p ParseProfile) Validate() error {
+	if p.Name == "" {
+		return errors.New("profile name is required")
+	}
+
+	if p.Delimiter == '\r' || p.Delimiter == '\n' || p.Delimiter == '"' {
+		return fmt.Errorf("profile %s: invalid delimiter %q", p.Name, p.Delimiter)
+	}
+
+	if p.decimalSeparator() == p.ThousandsSeparator {
+		return fmt.Errorf("profile %s: decimal and thousands separators must differ", p.Name)
+	}
+
+	if p.Currency != "" {
+		if _, err := parseCurrency(p.Currency); err != nil {
+			return fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+	}
+
+	if err := validateTimestampFormat(p.TimestampFormat); err != nil {
+		return fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+
+	if len(p.HeaderNames) > 0 {
+		for name := range p.HeaderNames {
+			if !isKnownColumn(name) {
+				return fmt.Errorf("profile %s: unknown column %q", p.Name, name)
+			}
+		}
+		for _, name := range profileColumns {
+			if _, ok := p.HeaderNames[name]; !ok && isRequiredColumn(name) {
+				return fmt.Errorf("profile %s: header name for %q is required", p.Name, name)
+			}
+		}
+		return nil
+	}
+
+	_, err := p.positionalLayout()
+	return err
+}
+
+func isKnownColumn(name string) bool {
+	for _, col := range profileColumns {
+		if col == name {
+			return true
+		}
+	}
+	return false
+}
+
+// layout holds the resolved position of every mapped column.
+type layout struct {
+	index  map[string]int
+	fields int
+}
+
+func (l layout) value(record []string, name string) string {
+	idx, ok := l.index[name]
+	if !ok || idx >= len(record) {
+		return ""
+	}
+	return record[idx]
+}
+
+func (p ParseProfile) positionalLayout() (layout, error) {
+	l := layout{index: make(map[string]int, len(profileColumns)), fields: len(p.Columns)}
+	for i, raw := range p.Columns {
+		name := strings.ToLower(strings.TrimSpace(raw))
+		if name == ColumnIgnored || name == "" {
+			continue
+		}
+		if !isKnownColumn(name) {
+			return layout{}, fmt.Errorf("profile %s: unknown column %q", p.Name, raw)
+		}
+		if _, dup := l.index[name]; dup {
+			return layout{}, fmt.Errorf("profile %s: column %q mapped twice", p.Name, name)
+		}
+		l.index[name] = i
+	}
+
+	for _, name := range profileColumns {
+		if _, ok := l.index[name]; !ok && isRequiredColumn(name) {
+			return layout{}, fmt.Errorf("profile %s: column %q is required", p.Name, name)
+		}
+	}
+
+	return l, nil
+}
+
+// headerLayout resolves column positions from a header row. Labels are
+// compared case-insensitively after trimming.
+func (p ParseProfile) headerLayout(header []string) (layout, error) {
+	positions := make(map[string]int, len(header))
+	for i, label := range header {
+		label = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(label, "\ufeff")))
+		if _, dup := positions[label]; !dup {
+			positions[label] = i
+		}
+	}
+
+	l := layout{index: make(map[string]int, len(profileColumns)), fields: len(header)}
+	for name, label := range p.HeaderNames {
+		idx, ok := positions[strings.ToLower(strings.TrimSpace(label))]
+		if !ok {
+			if isRequiredColumn(name) {
+				return layout{}, fmt.Errorf("header is missing column %q", label)
+			}
+			continue
+		}
+		l.index[name] = idx
+	}
+
+	return l, nil
+}
+
+func (p ParseProfile) decimalSeparator() rune {
+	if p.DecimalSeparator == 0 {
+		return '.'
+	}
+	return p.DecimalSeparator
+}
+
+func (p ParseProfile) currency() string {
+	if p.Currency == "" {
+		return DefaultCurrency
+	}
+	return strings.ToUpper(p.Currency)
+}
+
+func (p ParseProfile) usesHeader() bool {
+	return len(p.HeaderNames) > 0 || p.SkipHeader
+}
@@ -0,0 +1,194 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgerror"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgtrace"
+)
+
+// DefaultProgressInterval is used when Dependency.ProgressInterval is zero.
+const DefaultProgressInterval = 1000
+
+// progressBuffer is how many events a subscriber may fall behind before it is
+// disconnected. Publishing never waits for a slow reader.
+const progressBuffer = 256
+
+// ProgressEventType names the kind of update published while an upload is
+// processed.
+type ProgressEventType string
+
+const (
+	// ProgressStatus reports a status transition.
+	ProgressStatus ProgressEventType = "status"
+	// ProgressLines reports running line counts.
+	ProgressLines ProgressEventType = "progress"
+	// ProgressParseError carries one recorded parse error.
+	ProgressParseError ProgressEventType = "parse_error"
+	// ProgressSummary is the last event of an upload, sent once it is final.
+	ProgressSummary ProgressEventType = "summary"
+)
+
+// ProgressEvent is one update about an upload. Statement always holds the
+// status and counters at the time of the event; ParseError is set for
+// ProgressParseError and Balances for ProgressSummary.
+type ProgressEvent struct {
+	Type       ProgressEventType
+	Statement  StatementResult
+	ParseError entity.ParseError
+	Balances   entity.Balances
+}
+
+// ProgressStream is a subscription to the events of one upload. Snapshot is
+// the state when the subscription started; if it is a summary, Events is
+// already closed. Events is closed after the summary, when the subscriber
+// falls too far behind, or on shutdown. Close must be called once the caller
+// stops reading.
+type ProgressStream struct {
+	Snapshot ProgressEvent
+	Events   <-chan ProgressEvent
+	close    func()
+}
+
+// Close releases the subscription.
+func (s *ProgressStream) Close() {
+	if s.close != nil {
+		s.close()
+	}
+}
+
+// SubscribeProgress streams the progress of an upload. Events published
+// before the subscription are not replayed; the snapshot covers them.
+func (u *Usecase) SubscribeProgress(ctx context.Context, uploadID string) (_ *ProgressStream, err error) {
+	ctx, span := startSpan(ctx, "SubscribeProgress", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+
+	if uploadID == "" {
+		return nil, pkgerror.NewInvalidInput(errors.New("upload_id is required"))
+	}
+
+	// Subscribe before reading the snapshot so nothing published in between
+	// is lost.
+	sub := u.progress.subscribe(uploadID)
+	unsubscribe := func() { u.progress.unsubscribe(uploadID, sub) }
+
+	balances, meta, err := u.store.GetBalance(ctx, uploadID)
+	if err != nil {
+		unsubscribe()
+		return nil, mapStoreErr(err)
+	}
+
+	snapshot := ProgressEvent{Type: ProgressStatus, Statement: u.toStatementResult(meta)}
+	if meta.Status.IsFinal() {
+		unsubscribe()
+		snapshot.Type = ProgressSummary
+		snapshot.Balances = balances
+	}
+
+	return &ProgressStream{Snapshot: snapshot, Events: sub.ch, close: unsubscribe}, nil
+}
+
+type progressSub struct {
+	ch chan ProgressEvent
+}
+
+// progressHub fans out upload events to subscribers keyed by upload ID.
+type progressHub struct {
+	mu     sync.Mutex
+	closed bool
+	subs   map[string]map[*progressSub]struct{}
+}
+
+func newProgressHub() *progressHub {
+	return &progressHub{subs: make(map[string]map[*progressSub]struct{})}
+}
+
+// subscribe registers a subscriber. After shutdown it returns one whose
+// channel is already closed.
+func (h *progressHub) subscribe(uploadID string) *progressSub {
+	sub := &progressSub{ch: make(chan ProgressEvent, progressBuffer)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(sub.ch)
+		return sub
+	}
+
+	if h.subs[uploadID] == nil {
+		h.subs[uploadID] = make(map[*progressSub]struct{})
+	}
+	h.subs[uploadID][sub] = struct{}{}
+	return sub
+}
+
+func (h *progressHub) unsubscribe(uploadID string, sub *progressSub) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.remove(uploadID, sub)
+}
+
+// remove closes sub if it is still registered. Callers hold h.mu.
+func (h *progressHub) remove(uploadID string, sub *progressSub) {
+	subs := h.subs[uploadID]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subs, uploadID)
+	}
+	close(sub.ch)
+}
+
+// publish sends event to the subscribers of an upload, disconnecting any that
+// are too far behind. A nil hub publishes nothing.
+func (h *progressHub) publish(uploadID string, event ProgressEvent) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs[uploadID] {
+		select {
+		case sub.ch <- event:
+		default:
+			h.remove(uploadID, sub)
+		}
+	}
+}
+
+// finish ends every subscription of an upload.
+func (h *progressHub) finish(uploadID string) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs[uploadID] {
+		h.remove(uploadID, sub)
+	}
+}
+
+// shutdown ends every subscription and rejects new ones.
+func (h *progressHub) shutdown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for uploadID, subs := range h.subs {
+		for sub := range subs {
+			h.remove(uploadID, sub)
+		}
+	}
+}
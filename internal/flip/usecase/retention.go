@@ -0,0 +1,102 @@
+package usecase
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgtrace"
+)
+
+// RetentionPolicy bounds how many finished uploads are kept and for how long.
+// A zero MaxAge or MaxUploads disables that rule.
+type RetentionPolicy struct {
+	MaxAge     time.Duration
+	MaxUploads int
+	Interval   time.Duration
+}
+
+func (p RetentionPolicy) enabled() bool {
+	return p.MaxAge > 0 || p.MaxUploads > 0
+}
+
+// StartJanitor evicts finished uploads in the background according to the
+// retention policy until StopJanitor is called or the root context is
+// canceled.
+func (u *Usecase) StartJanitor() {
+	if !u.retention.enabled() {
+		return
+	}
+
+	interval := u.retention.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	u.janitorWG.Add(1)
+	go u.runJanitor(interval)
+}
+
+// StopJanitor stops the janitor and waits for a prune in progress to finish.
+func (u *Usecase) StopJanitor(ctx context.Context) error {
+	u.janitorOnce.Do(func() { close(u.janitorStop) })
+
+	done := make(chan struct{})
+	go func() {
+		u.janitorWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (u *Usecase) runJanitor(interval time.Duration) {
+	defer u.janitorWG.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-u.rootCtx.Done():
+			return
+		case <-u.janitorStop:
+			return
+		case <-ticker.C:
+			if _, err := u.PruneUploads(u.rootCtx); err != nil {
+				slog.WarnContext(u.rootCtx, "failed to prune uploads", "error", err)
+			}
+		}
+	}
+}
+
+// PruneUploads applies the retention policy once and returns how many uploads
+// were evicted.
+func (u *Usecase) PruneUploads(ctx context.Context) (_ int, err error) {
+	ctx, span := startSpan(ctx, "PruneUploads", "")
+	defer func() { pkgtrace.End(span, err) }()
+
+	if !u.retention.enabled() {
+		return 0, nil
+	}
+
+	var endedBefore int64
+	if u.retention.MaxAge > 0 {
+		endedBefore = u.clock.Now().Add(-u.retention.MaxAge).Unix()
+	}
+
+	evicted, err := u.store.PruneUploads(ctx, endedBefore, u.retention.MaxUploads)
+	if len(evicted) > 0 {
+		slog.InfoContext(ctx, "evicted finished uploads", "count", len(evicted))
+	}
+	if err != nil {
+		return len(evicted), normalizeErr(err)
+	}
+
+	return len(evicted), nil
+}
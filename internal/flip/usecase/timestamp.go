@@ -0,0 +1,108 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timestamp formats a ParseProfile understands besides Go time layouts.
+const (
+	TimestampAuto   = "auto"
+	TimestampUnix   = "unix"
+	TimestampUnixMS = "unix_ms"
+)
+
+// unixMSDigits is the length from which an all-digit timestamp is read as
+// milliseconds when auto-detecting. Millisecond timestamps have had 13 digits
+// since 2001, while second timestamps stay at 10 digits until 2286.
+const unixMSDigits = 12
+
+//nolint:gochecknoglobals // layouts tried in order when auto-detecting
+var autoTimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"02/01/2006",
+	"02-01-2006 15:04:05",
+	"02-01-2006",
+}
+
+// validateTimestampFormat accepts the keyword formats or a Go layout that
+// carries at least a four-digit year.
+func validateTimestampFormat(format string) error {
+	switch format {
+	case "", TimestampAuto, TimestampUnix, TimestampUnixMS:
+		return nil
+	}
+
+	if !strings.Contains(format, "2006") {
+		return fmt.Errorf("timestamp format %q must be %s, %s, %s or a Go time layout with a 2006 year",
+			format, TimestampAuto, TimestampUnix, TimestampUnixMS)
+	}
+
+	return nil
+}
+
+// parseTimestamp converts value to Unix seconds in UTC. Times without an
+// offset are read in loc.
+func parseTimestamp(value, format string, loc *time.Location) (int64, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	switch format {
+	case TimestampUnix:
+		return strconv.ParseInt(value, 10, 64)
+	case TimestampUnixMS:
+		ms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.UnixMilli(ms).Unix(), nil
+	case "", TimestampAuto:
+		return detectTimestamp(value, loc)
+	default:
+		t, err := time.ParseInLocation(format, value, loc)
+		if err != nil {
+			return 0, err
+		}
+		return t.UTC().Unix(), nil
+	}
+}
+
+func detectTimestamp(value string, loc *time.Location) (int64, error) {
+	if isDigits(value) {
+		if len(value) >= unixMSDigits {
+			return parseTimestamp(value, TimestampUnixMS, loc)
+		}
+		return parseTimestamp(value, TimestampUnix, loc)
+	}
+
+	for _, layout := range autoTimestampLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t.UTC().Unix(), nil
+		}
+	}
+
+	return 0, errors.New("unrecognized format")
+}
+
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,20 @@
+package usecase
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/shandysiswandi/goflip/internal/flip/usecase"
+
+// startSpan starts the span of a Usecase method, tagged with the upload it
+// works on when there is one.
+func startSpan(ctx context.Context, method, uploadID string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if uploadID != "" {
+		attrs = append(attrs, attribute.String("upload.id", uploadID))
+	}
+	return otel.Tracer(tracerName).Start(ctx, "Usecase."+method, trace.WithAttributes(attrs...))
+}
@@ -2,26 +2,57 @@ package usecase
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/shandysiswandi/goflip/internal/flip/entity"
 	"github.com/shandysiswandi/goflip/internal/pkg/pkgerror"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkglog"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgtrace"
 	"github.com/shandysiswandi/goflip/internal/pkg/pkguid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Store interface {
 	CreateUpload(ctx context.Context, meta entity.UploadMeta) error
 	UpdateMeta(ctx context.Context, uploadID string, fn func(meta *entity.UploadMeta)) error
-	SaveResults(ctx context.Context, uploadID string, balance int64, issues []entity.Transaction, totalLines, parsedOK, parseErr int64) error
-	GetBalance(ctx context.Context, uploadID string) (int64, entity.UploadMeta, error)
+	SaveResults(ctx context.Context, uploadID string, balances entity.Balances, issues []entity.Transaction, totalLines, parsedOK, parseErr int64) error
+	GetBalance(ctx context.Context, uploadID string) (entity.Balances, entity.UploadMeta, error)
+	ListUploads(ctx context.Context, filter UploadFilter, page, pageSize int) ([]entity.UploadMeta, int, error)
 	ListIssues(ctx context.Context, uploadID string, filter IssueFilter, page, pageSize int) ([]entity.Transaction, int, entity.UploadMeta, error)
+	AppendTransactions(ctx context.Context, uploadID string, txs []entity.Transaction) error
+	ListTransactions(ctx context.Context, uploadID string, filter IssueFilter, page, pageSize int) ([]entity.Transaction, int, entity.UploadMeta, error)
+	AppendParseErrors(ctx context.Context, uploadID string, errs []entity.ParseError) error
+	ListParseErrors(ctx context.Context, uploadID string, page, pageSize int) ([]entity.ParseError, int, entity.UploadMeta, error)
+	AppendWebhookDeliveries(ctx context.Context, uploadID string, deliveries []entity.WebhookDelivery) error
+	ListWebhookDeliveries(ctx context.Context, uploadID string, page, pageSize int) ([]entity.WebhookDelivery, int, entity.UploadMeta, error)
+	ClaimKey(ctx context.Context, key, uploadID string, now, expiresAt int64) (string, error)
+	DeleteUpload(ctx context.Context, uploadID string) error
+	PruneUploads(ctx context.Context, endedBefore int64, maxUploads int) ([]string, error)
 }
 
+// EventPublisher receives the lifecycle events of every upload: started,
+// each FAILED and PENDING transaction, and completed.
 type EventPublisher interface {
-	Publish(ctx context.Context, event entity.FailedTxEvent) error
+	PublishUploadStarted(ctx context.Context, event entity.UploadStartedEvent) error
+	PublishFailedTx(ctx context.Context, event entity.FailedTxEvent) error
+	PublishPendingTx(ctx context.Context, event entity.PendingTxEvent) error
+	PublishUploadCompleted(ctx context.Context, event entity.UploadCompletedEvent) error
+}
+
+// Notifier delivers an event to webhook endpoints once an upload is final.
+type Notifier interface {
+	NotifyUploadCompleted(ctx context.Context, event entity.UploadCompletedEvent) error
 }
 
 type Runner interface {
@@ -32,22 +63,86 @@ type Clock interface {
 	Now() time.Time
 }
 
+// txBatchSize is how many parsed rows are buffered before they are appended
+// to the store when KeepTransactions is enabled.
+const txBatchSize = 1024
+
+// parseErrBatchSize is how many parse errors are buffered before they are
+// appended to the store.
+const parseErrBatchSize = 128
+
+// DefaultMaxParseErrors is used when Dependency.MaxParseErrors is zero.
+const DefaultMaxParseErrors = 1000
+
+// DefaultIdempotencyWindow is used when Dependency.IdempotencyWindow is zero.
+const DefaultIdempotencyWindow = 24 * time.Hour
+
 type Dependency struct {
-	Store   Store
-	Events  EventPublisher
-	Runner  Runner
-	Clock   Clock
-	ID      pkguid.StringID
-	RootCtx context.Context
+	Store       Store
+	Events      EventPublisher
+	DeadLetters DeadLetterQueue
+	Notifier    Notifier
+	Runner      Runner
+	Clock       Clock
+	ID          pkguid.StringID
+	RootCtx     context.Context
+	Retention   RetentionPolicy
+	Metrics     *Metrics
+
+	// KeepTransactions stores every parsed row, not only FAILED/PENDING ones.
+	KeepTransactions bool
+
+	// MaxParseErrors caps how many per-line parse errors are recorded for a
+	// single upload. Lines beyond the cap are still counted in ParseErr.
+	// Negative disables recording.
+	MaxParseErrors int
+
+	// Profiles are the CSV layouts an upload can pick by name. The default
+	// layout is added unless a profile named DefaultProfileName overrides it.
+	Profiles []ParseProfile
+
+	// Location is the zone for timestamps without an offset in profiles that
+	// do not set their own. Defaults to UTC.
+	Location *time.Location
+
+	// ProgressInterval is how many lines are parsed between two progress
+	// events. Defaults to DefaultProgressInterval.
+	ProgressInterval int
+
+	// IdempotencyWindow is how long an idempotency key maps to its upload.
+	// Defaults to DefaultIdempotencyWindow.
+	IdempotencyWindow time.Duration
+
+	// DetectDuplicates hashes every upload before parsing it, spooling it to a
+	// temporary file, and links an exact re-upload with the same profile to
+	// the earlier one instead of parsing and storing it again.
+	DetectDuplicates bool
 }
 
 type Usecase struct {
-	store   Store
-	events  EventPublisher
-	runner  Runner
-	clock   Clock
-	id      pkguid.StringID
-	rootCtx context.Context
+	store         Store
+	events        EventPublisher
+	deadLetters   DeadLetterQueue
+	notifier      Notifier
+	runner        Runner
+	clock         Clock
+	id            pkguid.StringID
+	rootCtx       context.Context
+	retention     RetentionPolicy
+	metrics       *Metrics
+	keepTxs       bool
+	maxErrs       int
+	profiles      map[string]ParseProfile
+	progress      *progressHub
+	progressEvery int64
+	inflight      *inflight
+	idemWindow    time.Duration
+	dedup         bool
+
+	// The janitor runs in its own goroutine so it never holds a runner slot.
+	janitorStop chan struct{}
+	janitorOnce sync.Once
+	janitorWG   sync.WaitGroup
 }
 
 func New(dep Dependency) *Usecase {
@@ -61,13 +156,60 @@ func New(dep Dependency) *Usecase {
 		clock = realClock{}
 	}
 
+	maxErrs := dep.MaxParseErrors
+	if maxErrs == 0 {
+		maxErrs = DefaultMaxParseErrors
+	}
+
+	loc := dep.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	profiles := map[string]ParseProfile{DefaultProfileName: DefaultParseProfile()}
+	for _, profile := range dep.Profiles {
+		profiles[profile.Name] = profile
+	}
+	for name, profile := range profiles {
+		if profile.Location == nil {
+			profile.Location = loc
+			profiles[name] = profile
+		}
+	}
+
+	every := int64(dep.ProgressInterval)
+	if every <= 0 {
+		every = DefaultProgressInterval
+	}
+
+	idemWindow := dep.IdempotencyWindow
+	if idemWindow <= 0 {
+		idemWindow = DefaultIdempotencyWindow
+	}
+
+	progress := newProgressHub()
+	context.AfterFunc(root, progress.shutdown)
+
 	return &Usecase{
-		store:   dep.Store,
-		events:  dep.Events,
-		runner:  dep.Runner,
-		clock:   clock,
-		id:      dep.ID,
-		rootCtx: root,
+		store:         dep.Store,
+		events:        dep.Events,
+		deadLetters:   dep.DeadLetters,
+		notifier:      dep.Notifier,
+		runner:        dep.Runner,
+		clock:         clock,
+		id:            dep.ID,
+		rootCtx:       root,
+		retention:     dep.Retention,
+		metrics:       dep.Metrics,
+		keepTxs:       dep.KeepTransactions,
+		maxErrs:       maxErrs,
+		profiles:      profiles,
+		progress:      progress,
+		progressEvery: every,
+		inflight:      newInflight(),
+		idemWindow:    idemWindow,
+		dedup:         dep.DetectDuplicates,
+		janitorStop:   make(chan struct{}),
 	}
 }
 
@@ -77,22 +219,95 @@ func (realClock) Now() time.Time {
 	return time.Now()
 }
 
-func (u *Usecase) Upload(ctx context.Context, r io.Reader) (UploadResult, error) {
+func (u *Usecase) Upload(ctx context.Context, r io.Reader, opts UploadOptions) (UploadResult, error) {
+	return u.UploadParts(ctx, []UploadPart{{Reader: r}}, opts)
+}
+
+// UploadParts starts one upload that reads every part in order. Readers that
+// implement io.Closer are closed once processing stops, so a writer feeding a
+// pipe is released even if parsing ends early.
+func (u *Usecase) UploadParts(ctx context.Context, parts []UploadPart, opts UploadOptions) (_ UploadResult, err error) {
+	ctx, span := startSpan(ctx, "UploadParts", "", attribute.Int("upload.parts", len(parts)), attribute.String("upload.profile", opts.Profile))
+	defer func() { pkgtrace.End(span, err) }()
+
+	if len(parts) == 0 {
+		return UploadResult{}, pkgerror.NewInvalidInput(errors.New("no files to upload"))
+	}
+
 	if u.store == nil || u.id == nil || u.runner == nil {
 		return UploadResult{}, pkgerror.NewServer(errors.New("missing dependency"))
 	}
 
+	profile, err := u.profile(opts.Profile)
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	if err := u.validateCallbackURL(opts.CallbackURL); err != nil {
+		return UploadResult{}, err
+	}
+
+	now := u.clock.Now()
 	uploadID := u.id.Generate()
 	if err := u.store.CreateUpload(ctx, entity.UploadMeta{
-		ID:     uploadID,
-		Status: entity.UploadStatusQueued,
+		ID:             uploadID,
+		Status:         entity.UploadStatusQueued,
+		CreatedAt:      now.Unix(),
+		Profile:        profile.Name,
+		FileName:       opts.FileName,
+		CallbackURL:    opts.CallbackURL,
+		IdempotencyKey: opts.IdempotencyKey,
 	}); err != nil {
 		return UploadResult{}, normalizeErr(err)
 	}
 
-	u.runner.Go(u.rootCtx, func(ctx context.Context) error {
-		if err := u.processUpload(ctx, uploadID, r); err != nil {
-			slog.ErrorContext(ctx, "upload processing failed", "upload_id", uploadID, "error", err)
+	// The upload is created before the key is claimed so the claim can never
+	// point at an upload that does not exist. A retry that loses the race
+	// removes its own upload again.
+	if opts.IdempotencyKey != "" {
+		owner, err := u.store.ClaimKey(ctx, idempotencyKey(opts.IdempotencyKey), uploadID, now.Unix(), now.Add(u.idemWindow).Unix())
+		if err != nil {
+			_ = u.store.DeleteUpload(ctx, uploadID)
+			return UploadResult{}, normalizeErr(err)
+		}
+		if owner != uploadID {
+			if err := u.store.DeleteUpload(ctx, uploadID); err != nil {
+				slog.WarnContext(ctx, "failed to delete replayed upload", "upload_id", uploadID, "error", err)
+			}
+			closeParts(parts)
+			return UploadResult{UploadID: owner, Replayed: true}, nil
+		}
+	}
+
+	// Each upload gets its own context so Cancel can stop it. Canceling it
+	// also closes the parts, which unblocks a parser waiting on a pipe. It
+	// keeps the correlation ID and trace of the request for the logs, spans
+	// and events of the upload.
+	runCtx := pkgtrace.Detach(pkglog.Propagate(u.rootCtx, ctx), ctx)
+	uploadCtx, cancel := context.WithCancelCause(runCtx)
+	context.AfterFunc(uploadCtx, func() { closeParts(parts) })
+	u.inflight.add(uploadID, cancel)
+
+	// The runner waits for a slot on uploadCtx, so a canceled upload stops
+	// waiting, but then the runner never calls the function. Whichever comes
+	// first, the function starting or uploadCtx ending, sets started; in the
+	// second case the upload is finished without being processed.
+	var started atomic.Bool
+	context.AfterFunc(uploadCtx, func() {
+		if started.CompareAndSwap(false, true) {
+			u.abandonUpload(uploadCtx, uploadID)
+		}
+	})
+
+	u.runner.Go(uploadCtx, func(context.Context) error {
+		if !started.CompareAndSwap(false, true) {
+			return nil
+		}
+		defer u.inflight.remove(uploadID)
+		defer closeParts(parts)
+
+		if err := u.processUpload(uploadCtx, uploadID, profile, parts); err != nil {
+			slog.ErrorContext(uploadCtx, "upload processing failed", "upload_id", uploadID, "error", err)
 			return err
 		}
 		return nil
@@ -101,12 +316,44 @@ func (u *Usecase) Upload(ctx context.Context, r io.Reader) (UploadResult, error)
 	return UploadResult{UploadID: uploadID}, nil
 }
 
-func (u *Usecase) Balance(ctx context.Context, uploadID string) (BalanceResult, error) {
+func idempotencyKey(key string) string {
+	return "idempotency:" + key
+}
+
+func contentKey(profile, hash string) string {
+	return "content:" + profile + ":" + hash
+}
+
+func closeParts(parts []UploadPart) {
+	for _, part := range parts {
+		if c, ok := part.Reader.(io.Closer); ok {
+			_ = c.Close()
+		}
+	}
+}
+
+func (u *Usecase) profile(name string) (ParseProfile, error) {
+	if name == "" {
+		name = DefaultProfileName
+	}
+
+	profile, ok := u.profiles[name]
+	if !ok {
+		return ParseProfile{}, pkgerror.NewInvalidInput(fmt.Errorf("unknown profile %q", name))
+	}
+
+	return profile, nil
+}
+
+func (u *Usecase) Balance(ctx context.Context, uploadID string) (_ BalanceResult, err error) {
+	ctx, span := startSpan(ctx, "Balance", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+
 	if uploadID == "" {
 		return BalanceResult{}, pkgerror.NewInvalidInput(errors.New("upload_id is required"))
 	}
 
-	balance, meta, err := u.store.GetBalance(ctx, uploadID)
+	balances, meta, err := u.store.GetBalance(ctx, uploadID)
 	if err != nil {
 		return BalanceResult{}, mapStoreErr(err)
 	}
@@ -114,11 +361,79 @@ func (u *Usecase) Balance(ctx context.Context, uploadID string) (BalanceResult,
 	return BalanceResult{
 		UploadID: uploadID,
 		Status:   meta.Status,
-		Balance:  balance,
+		Balances: balances,
+	}, nil
+}
+
+func (u *Usecase) Statement(ctx context.Context, uploadID string) (_ StatementResult, err error) {
+	ctx, span := startSpan(ctx, "Statement", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+
+	if uploadID == "" {
+		return StatementResult{}, pkgerror.NewInvalidInput(errors.New("upload_id is required"))
+	}
+
+	_, meta, err := u.store.GetBalance(ctx, uploadID)
+	if err != nil {
+		return StatementResult{}, mapStoreErr(err)
+	}
+
+	return u.toStatementResult(meta), nil
+}
+
+func (u *Usecase) Statements(ctx context.Context, filter UploadFilter, page, pageSize int) (_ StatementsResult, err error) {
+	ctx, span := startSpan(ctx, "Statements", "")
+	defer func() { pkgtrace.End(span, err) }()
+
+	if page < 1 || pageSize < 1 {
+		return StatementsResult{}, pkgerror.NewInvalidInput(errors.New("invalid pagination"))
+	}
+
+	if filter.CreatedFrom > 0 && filter.CreatedTo > 0 && filter.CreatedFrom > filter.CreatedTo {
+		return StatementsResult{}, pkgerror.NewInvalidInput(errors.New("created_from must not be after created_to"))
+	}
+
+	metas, total, err := u.store.ListUploads(ctx, filter, page, pageSize)
+	if err != nil {
+		return StatementsResult{}, normalizeErr(err)
+	}
+
+	uploads := make([]StatementResult, 0, len(metas))
+	for _, meta := range metas {
+		uploads = append(uploads, u.toStatementResult(meta))
+	}
+
+	return StatementsResult{
+		Uploads:  uploads,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
 	}, nil
 }
 
-func (u *Usecase) Issues(ctx context.Context, uploadID string, filter IssueFilter, page, pageSize int) (IssuesResult, error) {
+// toStatementResult computes how long an upload ran, or has been running so
+// far if it has not finished yet.
+func (u *Usecase) toStatementResult(meta entity.UploadMeta) StatementResult {
+	result := StatementResult{Meta: meta}
+	if meta.StartedAt == 0 {
+		return result
+	}
+
+	end := meta.EndedAt
+	if end == 0 {
+		end = u.clock.Now().Unix()
+	}
+	if end > meta.StartedAt {
+		result.Duration = time.Duration(end-meta.StartedAt) * time.Second
+	}
+
+	return result
+}
+
+func (u *Usecase) Issues(ctx context.Context, uploadID string, filter IssueFilter, page, pageSize int) (_ IssuesResult, err error) {
+	ctx, span := startSpan(ctx, "Issues", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+
 	if uploadID == "" {
 		return IssuesResult{}, pkgerror.NewInvalidInput(errors.New("upload_id is required"))
 	}
@@ -142,54 +457,264 @@ func (u *Usecase) Issues(ctx context.Context, uploadID string, filter IssueFilte
 	}, nil
 }
 
-func (u *Usecase) processUpload(ctx context.Context, uploadID string, r io.Reader) error {
+func (u *Usecase) Transactions(ctx context.Context, uploadID string, filter IssueFilter, page, pageSize int) (_ TransactionsResult, err error) {
+	ctx, span := startSpan(ctx, "Transactions", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+
+	if uploadID == "" {
+		return TransactionsResult{}, pkgerror.NewInvalidInput(errors.New("upload_id is required"))
+	}
+
+	if page < 1 || pageSize < 1 {
+		return TransactionsResult{}, pkgerror.NewInvalidInput(errors.New("invalid pagination"))
+	}
+
+	if !u.keepTxs {
+		return TransactionsResult{}, pkgerror.NewBusiness("transaction history is not enabled", pkgerror.CodeNotFound)
+	}
+
+	txs, total, meta, err := u.store.ListTransactions(ctx, uploadID, filter, page, pageSize)
+	if err != nil {
+		return TransactionsResult{}, mapStoreErr(err)
+	}
+
+	return TransactionsResult{
+		UploadID:     uploadID,
+		Status:       meta.Status,
+		Transactions: txs,
+		Page:         page,
+		PageSize:     pageSize,
+		Total:        total,
+	}, nil
+}
+
+func (u *Usecase) ParseErrors(ctx context.Context, uploadID string, page, pageSize int) (_ ParseErrorsResult, err error) {
+	ctx, span := startSpan(ctx, "ParseErrors", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+
+	if uploadID == "" {
+		return ParseErrorsResult{}, pkgerror.NewInvalidInput(errors.New("upload_id is required"))
+	}
+
+	if page < 1 || pageSize < 1 {
+		return ParseErrorsResult{}, pkgerror.NewInvalidInput(errors.New("invalid pagination"))
+	}
+
+	errs, total, meta, err := u.store.ListParseErrors(ctx, uploadID, page, pageSize)
+	if err != nil {
+		return ParseErrorsResult{}, mapStoreErr(err)
+	}
+
+	return ParseErrorsResult{
+		UploadID: uploadID,
+		Status:   meta.Status,
+		Errors:   errs,
+		ParseErr: meta.ParseErr,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}, nil
+}
+
+func (u *Usecase) Delete(ctx context.Context, uploadID string) (err error) {
+	ctx, span := startSpan(ctx, "Delete", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+
+	if uploadID == "" {
+		return pkgerror.NewInvalidInput(errors.New("upload_id is required"))
+	}
+
+	_, meta, err := u.store.GetBalance(ctx, uploadID)
+	if err != nil {
+		return mapStoreErr(err)
+	}
+
+	if !meta.Status.IsFinal() {
+		return pkgerror.NewBusiness("upload is still processing", pkgerror.CodeConflict)
+	}
+
+	if err := u.store.DeleteUpload(ctx, uploadID); err != nil {
+		return mapStoreErr(err)
+	}
+
+	return nil
+}
+
+func (u *Usecase) processUpload(ctx context.Context, uploadID string, profile ParseProfile, parts []UploadPart) (err error) {
+	defer u.progress.finish(uploadID)
+
+	ctx, span := startSpan(ctx, "processUpload", uploadID, attribute.String("upload.profile", profile.Name), attribute.Int("upload.parts", len(parts)))
+	defer func() { pkgtrace.End(span, err) }()
+
+	u.metrics.started()
+	finalStatus := entity.UploadStatusFailed
+	defer func() { u.metrics.finished(finalStatus) }()
+
 	startedAt := u.clock.Now().Unix()
+	running := entity.UploadMeta{
+		ID:        uploadID,
+		Status:    entity.UploadStatusProcessing,
+		StartedAt: startedAt,
+		Profile:   profile.Name,
+	}
 	if err := u.store.UpdateMeta(ctx, uploadID, func(meta *entity.UploadMeta) {
 		meta.Status = entity.UploadStatusProcessing
 		meta.StartedAt = startedAt
+		running = *meta
 	}); err != nil {
 		return err
 	}
+	u.progress.publish(uploadID, ProgressEvent{Type: ProgressStatus, Statement: u.toStatementResult(running)})
+	u.publishStarted(ctx, running)
+
+	// running tracks the counters for progress events; the totals returned by
+	// parseParts remain authoritative.
+	every := u.progressEvery
+	if every <= 0 {
+		every = DefaultProgressInterval
+	}
+	reportLines := func() {
+		running.TotalLines = running.ParsedOK + running.ParseErr
+		u.progress.publish(uploadID, ProgressEvent{Type: ProgressLines, Statement: u.toStatementResult(running)})
+	}
 
-	var balance int64
+	balances := make(entity.Balances)
 	var issues []entity.Transaction
+	var batch []entity.Transaction
+	if u.keepTxs {
+		batch = make([]entity.Transaction, 0, txBatchSize)
+	}
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := u.store.AppendTransactions(ctx, uploadID, batch)
+		batch = batch[:0]
+		return err
+	}
+
+	var parseErrs []entity.ParseError
+	var recordedErrs int
+	flushErrs := func() {
+		if len(parseErrs) == 0 {
+			return
+		}
+		if err := u.store.AppendParseErrors(ctx, uploadID, parseErrs); err != nil {
+			slog.WarnContext(ctx, "failed to save parse errors", "upload_id", uploadID, "error", err)
+		}
+		parseErrs = parseErrs[:0]
+	}
+
+	onTx := func(tx entity.Transaction) error {
+		u.metrics.line(true)
+		running.ParsedOK++
+		if (running.ParsedOK+running.ParseErr)%every == 0 {
+			reportLines()
+		}
+
+		if u.keepTxs {
+			batch = append(batch, tx)
+			if len(batch) == txBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
 
-	totalLines, parsedOK, parseErr, err := parseCSV(ctx, r, func(tx entity.Transaction) {
 		if tx.Status == entity.TxStatusSuccess {
+			var err error
+			balance := balances[tx.Currency]
 			switch tx.Type {
 			case entity.TxTypeCredit:
-				balance += tx.Amount
+				balance, err = balance.Add(tx.Amount)
 			case entity.TxTypeDebit:
-				balance -= tx.Amount
+				balance, err = balance.Sub(tx.Amount)
 			}
-			return
+			if err != nil {
+				return fmt.Errorf("%s balance: %w", tx.Currency, err)
+			}
+			balances[tx.Currency] = balance
+			return nil
 		}
 
 		issues = append(issues, tx)
-		if tx.Status == entity.TxStatusFailed && u.events != nil {
-			event := entity.FailedTxEvent{
-				EventID:  u.id.Generate(),
-				UploadID: uploadID,
-				Tx:       tx,
-			}
-			if pubErr := u.events.Publish(ctx, event); pubErr != nil {
-				slog.WarnContext(ctx, "failed to publish event", "upload_id", uploadID, "event_id", event.EventID, "error", pubErr)
-			}
+		u.publishIssues(ctx, uploadID, tx)
+		return nil
+	}
+	onErr := func(perr entity.ParseError) {
+		u.metrics.line(false)
+		running.ParseErr++
+		if (running.ParsedOK+running.ParseErr)%every == 0 {
+			reportLines()
 		}
-	})
+
+		if recordedErrs >= u.maxErrs {
+			return
+		}
+		recordedErrs++
+		running.TotalLines = running.ParsedOK + running.ParseErr
+		u.progress.publish(uploadID, ProgressEvent{Type: ProgressParseError, Statement: u.toStatementResult(running), ParseError: perr})
+		parseErrs = append(parseErrs, perr)
+		if len(parseErrs) == parseErrBatchSize {
+			flushErrs()
+		}
+	}
+
+	// With content deduplication the file is hashed and claimed before it is
+	// parsed, so an exact re-upload is linked to the earlier one instead of
+	// being parsed and stored again.
+	var contentHash, duplicateOf string
+	if u.dedup {
+		var cleanup func()
+		parts, contentHash, cleanup, err = spoolParts(parts)
+		defer cleanup()
+		if err == nil {
+			duplicateOf = u.claimContent(ctx, uploadID, profile.Name, contentHash)
+		}
+	}
+
+	var totalLines, parsedOK, parseErr int64
+	if err == nil && duplicateOf == "" {
+		totalLines, parsedOK, parseErr, err = parseParts(ctx, parts, profile, onTx, onErr)
+	}
+	if err == nil {
+		err = flush()
+	}
+
+	// The results are written even if the upload was canceled meanwhile.
+	canceled := err != nil && errors.Is(context.Cause(ctx), errUploadCanceled)
+	ctx = context.WithoutCancel(ctx)
+	flushErrs()
 
 	endedAt := u.clock.Now().Unix()
 	status := entity.UploadStatusDone
 	errMsg := ""
-	if err != nil {
+	switch {
+	case canceled:
+		// A partial sum must not look like the balance of the statement.
+		status = entity.UploadStatusCanceled
+		errMsg = errUploadCanceled.Error()
+		balances = entity.Balances{}
+		err = nil
+	case err != nil:
 		status = entity.UploadStatusFailed
 		errMsg = err.Error()
 	}
 
-	if saveErr := u.store.SaveResults(ctx, uploadID, balance, issues, totalLines, parsedOK, parseErr); saveErr != nil {
+	span.SetAttributes(
+		attribute.String("upload.status", string(status)),
+		attribute.Int64("upload.lines.total", totalLines),
+		attribute.Int64("upload.lines.parsed", parsedOK),
+		attribute.Int64("upload.lines.parse_errors", parseErr),
+		attribute.Int("upload.issues", len(issues)),
+	)
+
+	if saveErr := u.store.SaveResults(ctx, uploadID, balances, issues, totalLines, parsedOK, parseErr); saveErr != nil {
 		return saveErr
 	}
 
+	var final entity.UploadMeta
 	if metaErr := u.store.UpdateMeta(ctx, uploadID, func(meta *entity.UploadMeta) {
 		meta.Status = status
 		meta.Err = errMsg
@@ -197,13 +722,182 @@ func (u *Usecase) processUpload(ctx context.Context, uploadID string, r io.Reade
 		meta.TotalLines = totalLines
 		meta.ParsedOK = parsedOK
 		meta.ParseErr = parseErr
+		meta.ContentHash = contentHash
+		meta.DuplicateOf = duplicateOf
+		final = *meta
 	}); metaErr != nil {
 		return metaErr
 	}
+	finalStatus = final.Status
+	u.progress.publish(uploadID, ProgressEvent{Type: ProgressSummary, Statement: u.toStatementResult(final), Balances: maps.Clone(balances)})
+	u.publishCompleted(ctx, final, balances)
 
 	return err
 }
 
+// spoolParts copies every part into one temporary file while hashing it, and
+// returns the hex SHA-256 with parts that read back from the file. cleanup
+// removes the file and is never nil.
+func spoolParts(parts []UploadPart) (_ []UploadPart, contentHash string, cleanup func(), err error) {
+	file, err := os.CreateTemp("", "goflip-upload-*")
+	if err != nil {
+		return nil, "", func() {}, fmt.Errorf("spool upload: %w", err)
+	}
+	cleanup = func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}
+
+	hasher := sha256.New()
+	spooled := make([]UploadPart, len(parts))
+	var offset int64
+	for i, part := range parts {
+		n, err := io.Copy(io.MultiWriter(file, hasher), part.Reader)
+		if err != nil {
+			return nil, "", cleanup, fmt.Errorf("spool upload: %w", err)
+		}
+		spooled[i] = UploadPart{Name: part.Name, Reader: io.NewSectionReader(file, offset, n)}
+		offset += n
+	}
+
+	return spooled, hex.EncodeToString(hasher.Sum(nil)), cleanup, nil
+}
+
+// claimContent records the hash for uploadID and returns the earlier upload
+// that claimed it within the idempotency window, or "" if there is none. Only
+// an earlier upload that is already DONE is linked to: one still processing
+// may yet fail, so the file is processed again instead.
+func (u *Usecase) claimContent(ctx context.Context, uploadID, profile, contentHash string) string {
+	now := u.clock.Now()
+	owner, err := u.store.ClaimKey(ctx, contentKey(profile, contentHash), uploadID, now.Unix(), now.Add(u.idemWindow).Unix())
+	if err != nil {
+		slog.WarnContext(ctx, "failed to record content hash", "upload_id", uploadID, "error", err)
+		return ""
+	}
+	if owner == uploadID {
+		return ""
+	}
+
+	_, meta, err := u.store.GetBalance(ctx, owner)
+	if err != nil || meta.Status != entity.UploadStatusDone {
+		return ""
+	}
+	return owner
+}
+
+func (u *Usecase) publishStarted(ctx context.Context, meta entity.UploadMeta) {
+	if u.events == nil {
+		return
+	}
+
+	event := entity.UploadStartedEvent{EventID: u.id.Generate(), Meta: meta}
+	if err := u.events.PublishUploadStarted(ctx, event); err != nil {
+		slog.WarnContext(ctx, "failed to publish event", "upload_id", meta.ID, "event_id", event.EventID, "error", err)
+	}
+}
+
+// publishIssues emits a FailedTxEvent or PendingTxEvent for every issue in
+// txs.
+func (u *Usecase) publishIssues(ctx context.Context, uploadID string, txs ...entity.Transaction) {
+	if u.events == nil {
+		return
+	}
+
+	for _, tx := range txs {
+		eventID := u.id.Generate()
+		var err error
+		switch tx.Status {
+		case entity.TxStatusFailed:
+			cid, _ := pkglog.LookupCorrelationID(ctx)
+			err = u.events.PublishFailedTx(ctx, entity.FailedTxEvent{
+				EventID:       eventID,
+				UploadID:      uploadID,
+				Tx:            tx,
+				CorrelationID: cid,
+				TraceParent:   pkgtrace.TraceParent(ctx),
+			})
+		case entity.TxStatusPending:
+			err = u.events.PublishPendingTx(ctx, entity.PendingTxEvent{EventID: eventID, UploadID: uploadID, Tx: tx})
+		case entity.TxStatusSuccess:
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "failed to publish event", "upload_id", uploadID, "event_id", eventID, "error", err)
+		}
+	}
+}
+
+// publishCompleted sends the same UploadCompletedEvent to the event bus and,
+// when the upload is DONE or FAILED, to the webhook notifier.
+func (u *Usecase) publishCompleted(ctx context.Context, meta entity.UploadMeta, balances entity.Balances) {
+	if u.events == nil && u.notifier == nil {
+		return
+	}
+
+	event := entity.UploadCompletedEvent{
+		EventID:  u.id.Generate(),
+		Meta:     meta,
+		Balances: maps.Clone(balances),
+	}
+
+	if u.events != nil {
+		if err := u.events.PublishUploadCompleted(ctx, event); err != nil {
+			slog.WarnContext(ctx, "failed to publish event", "upload_id", meta.ID, "event_id", event.EventID, "error", err)
+		}
+	}
+
+	if u.notifier != nil && (meta.Status == entity.UploadStatusDone || meta.Status == entity.UploadStatusFailed) {
+		if err := u.notifier.NotifyUploadCompleted(ctx, event); err != nil {
+			slog.WarnContext(ctx, "failed to queue webhook", "upload_id", meta.ID, "event_id", event.EventID, "error", err)
+		}
+	}
+}
+
+// validateCallbackURL accepts an absolute http or https URL, and only when a
+// notifier is configured to deliver to it.
+func (u *Usecase) validateCallbackURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+
+	if u.notifier == nil {
+		return pkgerror.NewInvalidInput(errors.New("callback_url is not supported: webhooks are not configured"))
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return pkgerror.NewInvalidInput(errors.New("callback_url must be an absolute http or https URL"))
+	}
+
+	return nil
+}
+
+func (u *Usecase) WebhookDeliveries(ctx context.Context, uploadID string, page, pageSize int) (_ WebhookDeliveriesResult, err error) {
+	ctx, span := startSpan(ctx, "WebhookDeliveries", uploadID)
+	defer func() { pkgtrace.End(span, err) }()
+
+	if uploadID == "" {
+		return WebhookDeliveriesResult{}, pkgerror.NewInvalidInput(errors.New("upload_id is required"))
+	}
+
+	if page < 1 || pageSize < 1 {
+		return WebhookDeliveriesResult{}, pkgerror.NewInvalidInput(errors.New("invalid pagination"))
+	}
+
+	deliveries, total, meta, err := u.store.ListWebhookDeliveries(ctx, uploadID, page, pageSize)
+	if err != nil {
+		return WebhookDeliveriesResult{}, mapStoreErr(err)
+	}
+
+	return WebhookDeliveriesResult{
+		UploadID:   uploadID,
+		Status:     meta.Status,
+		Deliveries: deliveries,
+		Page:       page,
+		PageSize:   pageSize,
+		Total:      total,
+	}, nil
+}
+
 func mapStoreErr(err error) error {
 	if errors.Is(err, pkgerror.ErrNotFound) {
 		return pkgerror.NewBusiness("upload not found", pkgerror.CodeNotFound)
@@ -2,28 +2,55 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgdecimal"
 	"github.com/shandysiswandi/goflip/internal/pkg/pkgerror"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkglog"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgroutine"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 type testStore struct {
 	mu      sync.RWMutex
 	metas   map[string]entity.UploadMeta
-	balance map[string]int64
+	balance map[string]entity.Balances
 	issues  map[string][]entity.Transaction
+	txs     map[string][]entity.Transaction
+	errs    map[string][]entity.ParseError
+	hooks   map[string][]entity.WebhookDelivery
+	claims  map[string]testClaim
+	appends int
+}
+
+type testClaim struct {
+	uploadID  string
+	expiresAt int64
 }
 
 func newTestStore() *testStore {
 	return &testStore{
 		metas:   make(map[string]entity.UploadMeta),
-		balance: make(map[string]int64),
+		balance: make(map[string]entity.Balances),
 		issues:  make(map[string][]entity.Transaction),
+		txs:     make(map[string][]entity.Transaction),
+		errs:    make(map[string][]entity.ParseError),
+		hooks:   make(map[string][]entity.WebhookDelivery),
+		claims:  make(map[string]testClaim),
 	}
 }
 
@@ -46,7 +73,7 @@ func (s *testStore) UpdateMeta(ctx context.Context, uploadID string, fn func(met
 	return nil
 }
 
-func (s *testStore) SaveResults(ctx context.Context, uploadID string, balance int64, issues []entity.Transaction, totalLines, parsedOK, parseErr int64) error {
+func (s *testStore) SaveResults(ctx context.Context, uploadID string, balance entity.Balances, issues []entity.Transaction, totalLines, parsedOK, parseErr int64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, ok := s.metas[uploadID]; !ok {
@@ -57,16 +84,33 @@ func (s *testStore) SaveResults(ctx context.Context, uploadID string, balance in
 	return nil
 }
 
-func (s *testStore) GetBalance(ctx context.Context, uploadID string) (int64, entity.UploadMeta, error) {
+func (s *testStore) GetBalance(ctx context.Context, uploadID string) (entity.Balances, entity.UploadMeta, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	meta, ok := s.metas[uploadID]
 	if !ok {
-		return 0, entity.UploadMeta{}, pkgerror.ErrNotFound
+		return nil, entity.UploadMeta{}, pkgerror.ErrNotFound
 	}
 	return s.balance[uploadID], meta, nil
 }
 
+func (s *testStore) ListUploads(ctx context.Context, filter UploadFilter, page, pageSize int) ([]entity.UploadMeta, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	metas := make([]entity.UploadMeta, 0, len(s.metas))
+	for _, meta := range s.metas {
+		if filter.Matches(meta) {
+			metas = append(metas, meta)
+		}
+	}
+	sort.Slice(metas, func(i, j int) bool { return metas[i].CreatedAt > metas[j].CreatedAt })
+
+	total := len(metas)
+	start := min((page-1)*pageSize, total)
+	end := min(start+pageSize, total)
+	return metas[start:end], total, nil
+}
+
 func (s *testStore) ListIssues(ctx context.Context, uploadID string, filter IssueFilter, page, pageSize int) ([]entity.Transaction, int, entity.UploadMeta, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -92,18 +136,172 @@ func (s *testStore) ListIssues(ctx context.Context, uploadID string, filter Issu
 	return issues, total, meta, nil
 }
 
+func (s *testStore) AppendTransactions(ctx context.Context, uploadID string, txs []entity.Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.metas[uploadID]; !ok {
+		return pkgerror.ErrNotFound
+	}
+	s.txs[uploadID] = append(s.txs[uploadID], txs...)
+	s.appends++
+	return nil
+}
+
+func (s *testStore) ListTransactions(ctx context.Context, uploadID string, filter IssueFilter, page, pageSize int) ([]entity.Transaction, int, entity.UploadMeta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	meta, ok := s.metas[uploadID]
+	if !ok {
+		return nil, 0, entity.UploadMeta{}, pkgerror.ErrNotFound
+	}
+
+	start := (page - 1) * pageSize
+	end := start + pageSize
+	total := 0
+	txs := make([]entity.Transaction, 0, pageSize)
+	for _, tx := range s.txs[uploadID] {
+		if !filter.Matches(tx) {
+			continue
+		}
+		if total >= start && total < end {
+			txs = append(txs, tx)
+		}
+		total++
+	}
+
+	return txs, total, meta, nil
+}
+
+func (s *testStore) AppendParseErrors(ctx context.Context, uploadID string, errs []entity.ParseError) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.metas[uploadID]; !ok {
+		return pkgerror.ErrNotFound
+	}
+	s.errs[uploadID] = append(s.errs[uploadID], errs...)
+	return nil
+}
+
+func (s *testStore) ListParseErrors(ctx context.Context, uploadID string, page, pageSize int) ([]entity.ParseError, int, entity.UploadMeta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	meta, ok := s.metas[uploadID]
+	if !ok {
+		return nil, 0, entity.UploadMeta{}, pkgerror.ErrNotFound
+	}
+	errs := s.errs[uploadID]
+	total := len(errs)
+	start := min((page-1)*pageSize, total)
+	end := min(start+pageSize, total)
+	return append([]entity.ParseError(nil), errs[start:end]...), total, meta, nil
+}
+
+func (s *testStore) AppendWebhookDeliveries(ctx context.Context, uploadID string, deliveries []entity.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.metas[uploadID]; !ok {
+		return pkgerror.ErrNotFound
+	}
+	s.hooks[uploadID] = append(s.hooks[uploadID], deliveries...)
+	return nil
+}
+
+func (s *testStore) ListWebhookDeliveries(ctx context.Context, uploadID string, page, pageSize int) ([]entity.WebhookDelivery, int, entity.UploadMeta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	meta, ok := s.metas[uploadID]
+	if !ok {
+		return nil, 0, entity.UploadMeta{}, pkgerror.ErrNotFound
+	}
+	hooks := s.hooks[uploadID]
+	total := len(hooks)
+	start := min((page-1)*pageSize, total)
+	end := min(start+pageSize, total)
+	return append([]entity.WebhookDelivery(nil), hooks[start:end]...), total, meta, nil
+}
+
+func (s *testStore) ClaimKey(ctx context.Context, key, uploadID string, now, expiresAt int64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.metas[uploadID]; !ok {
+		return "", pkgerror.ErrNotFound
+	}
+	if claim, ok := s.claims[key]; ok && claim.expiresAt > now && claim.uploadID != uploadID {
+		if _, alive := s.metas[claim.uploadID]; alive {
+			return claim.uploadID, nil
+		}
+	}
+	s.claims[key] = testClaim{uploadID: uploadID, expiresAt: expiresAt}
+	return uploadID, nil
+}
+
+func (s *testStore) DeleteUpload(ctx context.Context, uploadID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.metas[uploadID]; !ok {
+		return pkgerror.ErrNotFound
+	}
+	delete(s.metas, uploadID)
+	delete(s.balance, uploadID)
+	delete(s.issues, uploadID)
+	return nil
+}
+
+func (s *testStore) PruneUploads(ctx context.Context, endedBefore int64, maxUploads int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var evicted []string
+	for id, meta := range s.metas {
+		if meta.Status.IsFinal() && meta.EndedAt < endedBefore {
+			delete(s.metas, id)
+			evicted = append(evicted, id)
+		}
+	}
+	return evicted, nil
+}
+
 type testPublisher struct {
-	mu     sync.Mutex
-	events []entity.FailedTxEvent
+	mu        sync.Mutex
+	events    []entity.FailedTxEvent
+	pending   []entity.PendingTxEvent
+	started   []entity.UploadStartedEvent
+	completed []entity.UploadCompletedEvent
 }
 
-func (p *testPublisher) Publish(ctx context.Context, event entity.FailedTxEvent) error {
+func (p *testPublisher) PublishFailedTx(ctx context.Context, event entity.FailedTxEvent) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.events = append(p.events, event)
 	return nil
 }
 
+func (p *testPublisher) PublishPendingTx(ctx context.Context, event entity.PendingTxEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(p.pending, event)
+	return nil
+}
+
+func (p *testPublisher) PublishUploadStarted(ctx context.Context, event entity.UploadStartedEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.started = append(p.started, event)
+	return nil
+}
+
+func (p *testPublisher) PublishUploadCompleted(ctx context.Context, event entity.UploadCompletedEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.completed = append(p.completed, event)
+	return nil
+}
+
+type testRunner struct{}
+
+func (testRunner) Go(ctx context.Context, f func(ctx context.Context) error) {
+	_ = f(ctx)
+}
+
 type testID struct {
 	mu sync.Mutex
 	n  int
@@ -150,7 +348,7 @@ func TestProcessUploadComputesBalanceAndIssues(t *testing.T) {
 		"1674507886, JOHN DOE, CREDIT, 10, PENDING, transfer",
 	}, "\n")
 
-	if err := uc.processUpload(context.Background(), uploadID, strings.NewReader(csv)); err != nil {
+	if err := uc.processUpload(context.Background(), uploadID, DefaultParseProfile(), []UploadPart{{Reader: strings.NewReader(csv)}}); err != nil {
 		t.Fatalf("process upload: %v", err)
 	}
 
@@ -158,8 +356,8 @@ func TestProcessUploadComputesBalanceAndIssues(t *testing.T) {
 	if err != nil {
 		t.Fatalf("get balance: %v", err)
 	}
-	if balance != 50 {
-		t.Fatalf("unexpected balance: %d", balance)
+	if want := (entity.Balances{DefaultCurrency: pkgdecimal.MustParse("50")}); !reflect.DeepEqual(balance, want) {
+		t.Fatalf("unexpected balance: %v", balance)
 	}
 	if meta.Status != entity.UploadStatusDone {
 		t.Fatalf("expected status done, got %s", meta.Status)
@@ -178,6 +376,15 @@ func TestProcessUploadComputesBalanceAndIssues(t *testing.T) {
 	if len(events.events) != 1 {
 		t.Fatalf("expected 1 failed event, got %d", len(events.events))
 	}
+	if len(events.pending) != 1 || events.pending[0].Tx.Status != entity.TxStatusPending {
+		t.Fatalf("expected 1 pending event, got %+v", events.pending)
+	}
+	if len(events.started) != 1 || events.started[0].Meta.Status != entity.UploadStatusProcessing {
+		t.Fatalf("expected 1 started event, got %+v", events.started)
+	}
+	if len(events.completed) != 1 || events.completed[0].Meta.Status != entity.UploadStatusDone || events.completed[0].Balances[DefaultCurrency].Cmp(pkgdecimal.MustParse("50")) != 0 {
+		t.Fatalf("expected 1 completed event, got %+v", events.completed)
+	}
 }
 
 func TestProcessUploadCountsParseErrors(t *testing.T) {
@@ -203,7 +410,7 @@ func TestProcessUploadCountsParseErrors(t *testing.T) {
 		"1674507884, JOHN DOE, DEBIT, 50, SUCCESS, grocery",
 	}, "\n")
 
-	if err := uc.processUpload(context.Background(), uploadID, strings.NewReader(csv)); err != nil {
+	if err := uc.processUpload(context.Background(), uploadID, DefaultParseProfile(), []UploadPart{{Reader: strings.NewReader(csv)}}); err != nil {
 		t.Fatalf("process upload: %v", err)
 	}
 
@@ -215,3 +422,1244 @@ func TestProcessUploadCountsParseErrors(t *testing.T) {
 		t.Fatalf("unexpected stats: %+v", meta)
 	}
 }
+
+func TestDeleteRejectsUploadInProgress(t *testing.T) {
+	store := newTestStore()
+	uc := New(Dependency{Store: store})
+	ctx := context.Background()
+
+	if err := store.CreateUpload(ctx, entity.UploadMeta{ID: "running", Status: entity.UploadStatusProcessing}); err != nil {
+		t.Fatalf("create upload: %v", err)
+	}
+	if err := store.CreateUpload(ctx, entity.UploadMeta{ID: "done", Status: entity.UploadStatusDone}); err != nil {
+		t.Fatalf("create upload: %v", err)
+	}
+
+	var perr *pkgerror.Error
+	if err := uc.Delete(ctx, "running"); !errors.As(err, &perr) || perr.Code() != pkgerror.CodeConflict {
+		t.Fatalf("expected conflict deleting running upload, got %v", err)
+	}
+	if err := uc.Delete(ctx, "missing"); !errors.As(err, &perr) || perr.Code() != pkgerror.CodeNotFound {
+		t.Fatalf("expected not found deleting missing upload, got %v", err)
+	}
+	if err := uc.Delete(ctx, "done"); err != nil {
+		t.Fatalf("delete done upload: %v", err)
+	}
+	if _, _, err := store.GetBalance(ctx, "done"); !errors.Is(err, pkgerror.ErrNotFound) {
+		t.Fatalf("expected deleted upload to be gone, got %v", err)
+	}
+}
+
+func TestPruneUploadsUsesMaxAge(t *testing.T) {
+	store := newTestStore()
+	uc := New(Dependency{
+		Store:     store,
+		Clock:     fixedClock{now: time.Unix(1000, 0)},
+		Retention: RetentionPolicy{MaxAge: 100 * time.Second},
+	})
+	ctx := context.Background()
+
+	for id, endedAt := range map[string]int64{"old": 850, "fresh": 950} {
+		if err := store.CreateUpload(ctx, entity.UploadMeta{ID: id, Status: entity.UploadStatusDone, EndedAt: endedAt}); err != nil {
+			t.Fatalf("create upload: %v", err)
+		}
+	}
+
+	n, err := uc.PruneUploads(ctx)
+	if err != nil {
+		t.Fatalf("prune uploads: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 evicted upload, got %d", n)
+	}
+	if _, _, err := store.GetBalance(ctx, "fresh"); err != nil {
+		t.Fatalf("expected fresh upload to stay, got %v", err)
+	}
+}
+
+func TestJanitorRunsOutsideTheRunner(t *testing.T) {
+	store := newTestStore()
+	runner := pkgroutine.NewManager(1)
+	uc := New(Dependency{
+		Store:     store,
+		Runner:    runner,
+		Clock:     fixedClock{now: time.Unix(1000, 0)},
+		Retention: RetentionPolicy{MaxAge: 100 * time.Second, Interval: time.Millisecond},
+	})
+	ctx := context.Background()
+	if err := store.CreateUpload(ctx, entity.UploadMeta{ID: "old", Status: entity.UploadStatusDone, EndedAt: 850}); err != nil {
+		t.Fatalf("create upload: %v", err)
+	}
+
+	uc.StartJanitor()
+	if runner.InUse() != 0 {
+		t.Fatalf("expected the janitor not to take a runner slot, got %d in use", runner.InUse())
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if _, _, err := store.GetBalance(ctx, "old"); errors.Is(err, pkgerror.ErrNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("janitor did not prune the old upload")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := uc.StopJanitor(ctx); err != nil {
+		t.Fatalf("stop janitor: %v", err)
+	}
+	if err := uc.StopJanitor(ctx); err != nil {
+		t.Fatalf("stop janitor twice: %v", err)
+	}
+}
+
+func TestProcessUploadKeepsAllTransactionsInBatches(t *testing.T) {
+	store := newTestStore()
+	uc := New(Dependency{
+		Store:            store,
+		Clock:            fixedClock{now: time.Unix(1, 0)},
+		ID:               &testID{},
+		KeepTransactions: true,
+	})
+	ctx := context.Background()
+
+	uploadID := "upload-1"
+	if err := store.CreateUpload(ctx, entity.UploadMeta{ID: uploadID}); err != nil {
+		t.Fatalf("create upload: %v", err)
+	}
+
+	rows := txBatchSize + 10
+	var sb strings.Builder
+	for i := range rows {
+		status := "SUCCESS"
+		if i%2 == 1 {
+			status = "PENDING"
+		}
+		fmt.Fprintf(&sb, "%d, JOHN DOE, CREDIT, 1, %s, row\n", 1674507883+i, status)
+	}
+
+	if err := uc.processUpload(ctx, uploadID, DefaultParseProfile(), []UploadPart{{Reader: strings.NewReader(sb.String())}}); err != nil {
+		t.Fatalf("process upload: %v", err)
+	}
+
+	if store.appends != 2 {
+		t.Fatalf("expected 2 batched appends, got %d", store.appends)
+	}
+
+	result, err := uc.Transactions(ctx, uploadID, IssueFilter{Statuses: []entity.TxStatus{entity.TxStatusSuccess}}, 1, 10)
+	if err != nil {
+		t.Fatalf("transactions: %v", err)
+	}
+	if result.Total != (rows+1)/2 || len(result.Transactions) != 10 {
+		t.Fatalf("unexpected transactions result: total=%d len=%d", result.Total, len(result.Transactions))
+	}
+	if result.Transactions[0].Timestamp != 1674507883 {
+		t.Fatalf("expected rows in file order, got %+v", result.Transactions[0])
+	}
+}
+
+func TestTransactionsRequiresKeepTransactions(t *testing.T) {
+	uc := New(Dependency{Store: newTestStore()})
+
+	_, err := uc.Transactions(context.Background(), "upload-1", IssueFilter{}, 1, 10)
+	var perr *pkgerror.Error
+	if !errors.As(err, &perr) || perr.Code() != pkgerror.CodeNotFound {
+		t.Fatalf("expected not found when history is disabled, got %v", err)
+	}
+}
+
+func TestStatementReportsDuration(t *testing.T) {
+	store := newTestStore()
+	uc := New(Dependency{Store: store, Clock: fixedClock{now: time.Unix(200, 0)}})
+	ctx := context.Background()
+
+	metas := []entity.UploadMeta{
+		{ID: "done", Status: entity.UploadStatusFailed, Err: "boom", CreatedAt: 90, StartedAt: 100, EndedAt: 130},
+		{ID: "running", Status: entity.UploadStatusProcessing, CreatedAt: 140, StartedAt: 150},
+		{ID: "queued", Status: entity.UploadStatusQueued, CreatedAt: 190},
+	}
+	for _, meta := range metas {
+		if err := store.CreateUpload(ctx, meta); err != nil {
+			t.Fatalf("create upload: %v", err)
+		}
+	}
+
+	tests := map[string]time.Duration{
+		"done":    30 * time.Second,
+		"running": 50 * time.Second,
+		"queued":  0,
+	}
+	for id, want := range tests {
+		got, err := uc.Statement(ctx, id)
+		if err != nil {
+			t.Fatalf("statement %s: %v", id, err)
+		}
+		if got.Duration != want {
+			t.Fatalf("statement %s duration = %v, want %v", id, got.Duration, want)
+		}
+	}
+
+	got, err := uc.Statement(ctx, "done")
+	if err != nil {
+		t.Fatalf("statement: %v", err)
+	}
+	if got.Meta.Err != "boom" || got.Meta.CreatedAt != 90 {
+		t.Fatalf("unexpected meta: %+v", got.Meta)
+	}
+
+	list, err := uc.Statements(ctx, UploadFilter{CreatedFrom: 100}, 1, 10)
+	if err != nil {
+		t.Fatalf("statements: %v", err)
+	}
+	if list.Total != 2 || list.Uploads[0].Meta.ID != "queued" {
+		t.Fatalf("unexpected statements: %+v", list)
+	}
+
+	_, err = uc.Statements(ctx, UploadFilter{CreatedFrom: 10, CreatedTo: 5}, 1, 10)
+	var perr *pkgerror.Error
+	if !errors.As(err, &perr) || perr.Code() != pkgerror.CodeInvalidInput {
+		t.Fatalf("expected invalid input for inverted range, got %v", err)
+	}
+}
+
+func TestProcessUploadRecordsParseErrors(t *testing.T) {
+	store := newTestStore()
+	uc := New(Dependency{
+		Store:          store,
+		Clock:          fixedClock{now: time.Unix(1, 0)},
+		ID:             &testID{},
+		MaxParseErrors: 2,
+	})
+	ctx := context.Background()
+
+	uploadID := "upload-1"
+	if err := store.CreateUpload(ctx, entity.UploadMeta{ID: uploadID}); err != nil {
+		t.Fatalf("create upload: %v", err)
+	}
+
+	csv := strings.Join([]string{
+		"1674507883, JOHN DOE, CREDIT, 100, SUCCESS, salary",
+		"invalid,line",
+		"1674507884, JOHN DOE, DEBIT, ten, SUCCESS, grocery",
+		"1674507885, JOHN DOE, REFUND, 10, SUCCESS, grocery",
+	}, "\n")
+
+	if err := uc.processUpload(ctx, uploadID, DefaultParseProfile(), []UploadPart{{Reader: strings.NewReader(csv)}}); err != nil {
+		t.Fatalf("process upload: %v", err)
+	}
+
+	result, err := uc.ParseErrors(ctx, uploadID, 1, 10)
+	if err != nil {
+		t.Fatalf("parse errors: %v", err)
+	}
+	if result.ParseErr != 3 || result.Total != 2 {
+		t.Fatalf("expected 3 counted and 2 recorded errors, got %d/%d", result.ParseErr, result.Total)
+	}
+
+	first, second := result.Errors[0], result.Errors[1]
+	if first.Line != 2 || first.Field != "" || first.Raw != "invalid,line" {
+		t.Fatalf("unexpected first parse error: %+v", first)
+	}
+	if second.Line != 3 || second.Field != "amount" || !strings.Contains(second.Reason, "invalid amount") ||
+		second.Raw != "1674507884, JOHN DOE, DEBIT, ten, SUCCESS, grocery" {
+		t.Fatalf("unexpected second parse error: %+v", second)
+	}
+}
+
+func TestNewParseErrorTruncatesRawLine(t *testing.T) {
+	raw := strings.Repeat("a", maxRawLineLen) + ",b"
+	perr := newParseError(7, raw, &fieldError{field: "timestamp", err: errors.New("bad")})
+
+	if len(perr.Raw) != maxRawLineLen {
+		t.Fatalf("expected raw line truncated to %d, got %d", maxRawLineLen, len(perr.Raw))
+	}
+	if perr.Line != 7 || perr.Field != "timestamp" || perr.Reason != "bad" {
+		t.Fatalf("unexpected parse error: %+v", perr)
+	}
+}
+
+func TestParseCSVWithProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile ParseProfile
+		input   string
+	}{
+		{
+			name: "positional with header and extra columns",
+			profile: ParseProfile{
+				Name:              "positional",
+				Columns:           []string{"amount", "-", "timestamp", "type", "status", "counterparty"},
+				SkipHeader:        true,
+				Delimiter:         ';',
+				AllowExtraColumns: true,
+			},
+			input: "Amount;Ref;Time;Type;Status;Name;Note\n" +
+				"100;r1;1674507883;CREDIT;SUCCESS;JOHN DOE;x\n",
+		},
+		{
+			name: "header names",
+			profile: ParseProfile{
+				Name: "header",
+				HeaderNames: map[string]string{
+					ColumnTimestamp:    "Date",
+					ColumnCounterparty: "Name",
+					ColumnType:         "Type",
+					ColumnAmount:       "Amount",
+					ColumnStatus:       "Status",
+					ColumnDescription:  "Remarks",
+				},
+			},
+			input: "\ufeffstatus, TYPE ,Remarks,Amount,Name,Date\n" +
+				"SUCCESS,CREDIT,salary,100,JOHN DOE,1674507883\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.profile.Validate(); err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+
+			var got []entity.Transaction
+			total, ok, failed, err := parseCSV(context.Background(), strings.NewReader(tt.input), tt.profile, func(tx entity.Transaction) error {
+				got = append(got, tx)
+				return nil
+			}, func(perr entity.ParseError) {
+				t.Fatalf("unexpected parse error: %+v", perr)
+			})
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if total != 1 || ok != 1 || failed != 0 || len(got) != 1 {
+				t.Fatalf("unexpected stats total=%d ok=%d failed=%d rows=%d", total, ok, failed, len(got))
+			}
+
+			tx := got[0]
+			if tx.Timestamp != 1674507883 || tx.Counterparty != "JOHN DOE" || tx.Type != entity.TxTypeCredit ||
+				tx.Amount.Cmp(pkgdecimal.MustParse("100")) != 0 || tx.Status != entity.TxStatusSuccess {
+				t.Fatalf("unexpected transaction: %+v", tx)
+			}
+		})
+	}
+}
+
+func TestParseCSVFailsOnMissingHeaderColumn(t *testing.T) {
+	profile := ParseProfile{
+		Name: "header",
+		HeaderNames: map[string]string{
+			ColumnTimestamp:    "Date",
+			ColumnCounterparty: "Name",
+			ColumnType:         "Type",
+			ColumnAmount:       "Amount",
+			ColumnStatus:       "Status",
+		},
+	}
+
+	var perrs []entity.ParseError
+	_, _, failed, err := parseCSV(context.Background(), strings.NewReader("Date,Name,Type,Amount\n"), profile, func(entity.Transaction) error {
+		return nil
+	}, func(perr entity.ParseError) {
+		perrs = append(perrs, perr)
+	})
+	if err == nil || failed != 1 {
+		t.Fatalf("expected header error, got err=%v failed=%d", err, failed)
+	}
+	if len(perrs) != 1 || perrs[0].Field != "header" || perrs[0].Line != 1 {
+		t.Fatalf("unexpected parse errors: %+v", perrs)
+	}
+}
+
+func TestParseCSVKeepsRawLine(t *testing.T) {
+	profile := ParseProfile{
+		Name:      "semicolon",
+		Columns:   []string{"timestamp", "counterparty", "type", "amount", "status", "description"},
+		Delimiter: ';',
+	}
+	if err := profile.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	// Enough valid rows ahead of the bad ones to make the tap drop input.
+	input := strings.Repeat("1674507883; JOHN DOE;CREDIT;100;SUCCESS;salary\r\n", 2000) +
+		"1674507884;\"DOE; JOHN\";DEBIT;ten;SUCCESS;\"grocery\"\r\n" +
+		"1674507885;ACME;REFUND;10;SUCCESS;x\n"
+
+	var perrs []entity.ParseError
+	_, _, failed, err := parseCSV(context.Background(), strings.NewReader(input), profile, func(entity.Transaction) error {
+		return nil
+	}, func(perr entity.ParseError) {
+		perrs = append(perrs, perr)
+	})
+	if err != nil || failed != 2 || len(perrs) != 2 {
+		t.Fatalf("expected 2 parse errors, got err=%v failed=%d errors=%+v", err, failed, perrs)
+	}
+	if perrs[0].Raw != `1674507884;"DOE; JOHN";DEBIT;ten;SUCCESS;"grocery"` {
+		t.Fatalf("unexpected raw line: %q", perrs[0].Raw)
+	}
+	if perrs[1].Raw != "1674507885;ACME;REFUND;10;SUCCESS;x" {
+		t.Fatalf("unexpected raw line: %q", perrs[1].Raw)
+	}
+}
+
+func TestParseProfileValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile ParseProfile
+	}{
+		{name: "missing name", profile: ParseProfile{Columns: DefaultParseProfile().Columns}},
+		{name: "missing column", profile: ParseProfile{Name: "p", Columns: []string{"timestamp", "amount"}}},
+		{name: "unknown column", profile: ParseProfile{Name: "p", Columns: append([]string{"balance"}, DefaultParseProfile().Columns...)}},
+		{name: "duplicate column", profile: ParseProfile{Name: "p", Columns: append([]string{"amount"}, DefaultParseProfile().Columns...)}},
+		{name: "bad delimiter", profile: ParseProfile{Name: "p", Columns: DefaultParseProfile().Columns, Delimiter: '"'}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.profile.Validate(); err == nil {
+				t.Fatalf("expected validation error")
+			}
+		})
+	}
+}
+
+func TestUploadRejectsUnknownProfile(t *testing.T) {
+	uc := New(Dependency{
+		Store:  newTestStore(),
+		Runner: testRunner{},
+		ID:     &testID{},
+	})
+
+	_, err := uc.Upload(context.Background(), strings.NewReader(""), UploadOptions{Profile: "missing"})
+	var perr *pkgerror.Error
+	if !errors.As(err, &perr) || perr.Code() != pkgerror.CodeInvalidInput {
+		t.Fatalf("expected invalid input error, got %v", err)
+	}
+}
+
+func TestProcessUploadComputesBalancePerCurrency(t *testing.T) {
+	store := newTestStore()
+	uc := New(Dependency{
+		Store: store,
+		Clock: fixedClock{now: time.Unix(1, 0)},
+		ID:    &testID{},
+	})
+	ctx := context.Background()
+
+	uploadID := "upload-1"
+	if err := store.CreateUpload(ctx, entity.UploadMeta{ID: uploadID}); err != nil {
+		t.Fatalf("create upload: %v", err)
+	}
+
+	profile := ParseProfile{
+		Name:               "eu",
+		Columns:            []string{"timestamp", "counterparty", "type", "amount", "currency", "status"},
+		Delimiter:          ';',
+		ThousandsSeparator: '.',
+		DecimalSeparator:   ',',
+	}
+	if err := profile.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	csv := strings.Join([]string{
+		"1674507883;JOHN DOE;CREDIT;1.250.000,50;idr;SUCCESS",
+		"1674507884;JOHN DOE;DEBIT;250.000;IDR;SUCCESS",
+		"1674507885;ACME;CREDIT;10,25;USD;SUCCESS",
+		"1674507886;ACME;DEBIT;0,10;USD;SUCCESS",
+		"1674507887;ACME;DEBIT;99;USD;FAILED",
+		"1674507888;ACME;DEBIT;1;US;SUCCESS",
+	}, "\n")
+
+	if err := uc.processUpload(ctx, uploadID, profile, []UploadPart{{Reader: strings.NewReader(csv)}}); err != nil {
+		t.Fatalf("process upload: %v", err)
+	}
+
+	result, err := uc.Balance(ctx, uploadID)
+	if err != nil {
+		t.Fatalf("balance: %v", err)
+	}
+	want := entity.Balances{
+		"IDR": pkgdecimal.MustParse("1000000.5"),
+		"USD": pkgdecimal.MustParse("10.15"),
+	}
+	if !reflect.DeepEqual(result.Balances, want) {
+		t.Fatalf("unexpected balances: %v", result.Balances)
+	}
+
+	errs, err := uc.ParseErrors(ctx, uploadID, 1, 10)
+	if err != nil {
+		t.Fatalf("parse errors: %v", err)
+	}
+	if errs.Total != 1 || errs.Errors[0].Field != "currency" {
+		t.Fatalf("expected one currency parse error, got %+v", errs.Errors)
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	jakarta := time.FixedZone("WIB", 7*60*60)
+
+	tests := []struct {
+		name   string
+		value  string
+		format string
+		want   int64
+		err    bool
+	}{
+		{name: "unix seconds", value: "1674507883", format: TimestampAuto, want: 1674507883},
+		{name: "unix milliseconds", value: "1674507883123", format: TimestampAuto, want: 1674507883},
+		{name: "naive datetime", value: "2024-01-23 10:15:00", format: TimestampAuto, want: 1705979700},
+		{name: "iso with offset", value: "2024-01-23T10:15:00+02:00", format: TimestampAuto, want: 1705997700},
+		{name: "iso utc", value: "2024-01-23T03:15:00Z", format: "", want: 1705979700},
+		{name: "day first date", value: "23/01/2024", format: TimestampAuto, want: 1705942800},
+		{name: "explicit layout", value: "01-23-2024 10:15", format: "01-02-2006 15:04", want: 1705979700},
+		{name: "explicit unix_ms", value: "1674507883999", format: TimestampUnixMS, want: 1674507883},
+		{name: "unix rejects iso", value: "2024-01-23", format: TimestampUnix, err: true},
+		{name: "garbage", value: "yesterday", format: TimestampAuto, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTimestamp(tt.value, tt.format, jakarta)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUploadUsesConfiguredLocation(t *testing.T) {
+	store := newTestStore()
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	uc := New(Dependency{
+		Store:            store,
+		Runner:           testRunner{},
+		Clock:            fixedClock{now: time.Unix(1, 0)},
+		ID:               &testID{},
+		Location:         jakarta,
+		KeepTransactions: true,
+		Profiles: []ParseProfile{{
+			Name:            "dmy",
+			Columns:         DefaultParseProfile().Columns,
+			TimestampFormat: "02/01/2006 15:04",
+		}},
+	})
+	ctx := context.Background()
+
+	result, err := uc.Upload(ctx, strings.NewReader("23/01/2024 10:15, JOHN DOE, CREDIT, 100, SUCCESS, salary\n"), UploadOptions{Profile: "dmy"})
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	txs, err := uc.Transactions(ctx, result.UploadID, IssueFilter{}, 1, 10)
+	if err != nil {
+		t.Fatalf("transactions: %v", err)
+	}
+	if len(txs.Transactions) != 1 || txs.Transactions[0].Timestamp != 1705979700 {
+		t.Fatalf("expected timestamp normalized to UTC, got %+v", txs.Transactions)
+	}
+}
+
+// ctxRunner keeps the context and function it was given until run is called.
+type ctxRunner struct {
+	ctx context.Context
+	f   func(ctx context.Context) error
+}
+
+func (r *ctxRunner) Go(ctx context.Context, f func(ctx context.Context) error) {
+	r.ctx, r.f = ctx, f
+}
+
+func (r *ctxRunner) run() {
+	_ = r.f(r.ctx)
+}
+
+func TestUploadCarriesCorrelationIntoProcessing(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	events := &testPublisher{}
+	runner := &ctxRunner{}
+	uc := New(Dependency{Store: newTestStore(), Events: events, Runner: runner, ID: &testID{}})
+
+	ctx, cancel := context.WithCancel(pkglog.SetTraceParent(pkglog.SetCorrelationID(context.Background(), "cid-upload"), tp))
+	if _, err := uc.Upload(ctx, strings.NewReader("1674507885, JOHN DOE, DEBIT, 20, FAILED, restaurant\n"), UploadOptions{}); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	cancel()
+
+	if runner.ctx.Err() != nil {
+		t.Fatal("expected the processing context to outlive the request")
+	}
+	runner.run()
+
+	if cid, _ := pkglog.LookupCorrelationID(runner.ctx); cid != "cid-upload" || pkglog.GetTraceParent(runner.ctx) != tp {
+		t.Fatalf("expected the processing context to carry the request ids, got %q and %q", cid, pkglog.GetTraceParent(runner.ctx))
+	}
+	if len(events.events) != 1 || events.events[0].CorrelationID != "cid-upload" || events.events[0].TraceParent != tp {
+		t.Fatalf("expected the failed event to carry the request ids, got %+v", events.events)
+	}
+}
+
+func TestUploadTracesProcessing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	events := &testPublisher{}
+	uc := New(Dependency{Store: newTestStore(), Events: events, Runner: testRunner{}, ID: &testID{}})
+
+	ctx, request := provider.Tracer("test").Start(context.Background(), "request")
+	csv := strings.Join([]string{
+		"1674507883, JOHN DOE, CREDIT, 100, SUCCESS, salary",
+		"bad,row",
+		"1674507885, JOHN DOE, DEBIT, 20, FAILED, restaurant",
+	}, "\n")
+	result, err := uc.Upload(ctx, strings.NewReader(csv), UploadOptions{})
+	request.End()
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	var upload, process sdktrace.ReadOnlySpan
+	for _, span := range exporter.GetSpans().Snapshots() {
+		switch span.Name() {
+		case "Usecase.UploadParts":
+			upload = span
+		case "Usecase.processUpload":
+			process = span
+		}
+	}
+	if upload == nil || process == nil {
+		t.Fatalf("expected spans for the upload and its processing, got %d spans", len(exporter.GetSpans()))
+	}
+
+	traceID := request.SpanContext().TraceID()
+	if upload.Parent().SpanID() != request.SpanContext().SpanID() || process.SpanContext().TraceID() != traceID {
+		t.Fatal("expected the upload and its background processing to join the request trace")
+	}
+
+	attrs := attribute.NewSet(process.Attributes()...)
+	want := map[attribute.Key]int64{
+		"upload.lines.total":        3,
+		"upload.lines.parsed":       2,
+		"upload.lines.parse_errors": 1,
+		"upload.issues":             1,
+	}
+	for key, n := range want {
+		if v, _ := attrs.Value(key); v.AsInt64() != n {
+			t.Fatalf("expected %s = %d, got %d", key, n, v.AsInt64())
+		}
+	}
+	if v, _ := attrs.Value("upload.id"); v.AsString() != result.UploadID {
+		t.Fatalf("expected upload.id %q, got %q", result.UploadID, v.AsString())
+	}
+
+	wantTP := "00-" + traceID.String() + "-" + process.SpanContext().SpanID().String() + "-01"
+	if len(events.events) != 1 || events.events[0].TraceParent != wantTP {
+		t.Fatalf("expected the failed event to point at the processing span %q, got %+v", wantTP, events.events)
+	}
+}
+
+func TestProcessUploadRecordsMetrics(t *testing.T) {
+	store := newTestStore()
+	metrics := NewMetrics(nil)
+	uc := New(Dependency{Store: store, ID: &testID{}, Metrics: metrics})
+	ctx := context.Background()
+
+	if err := store.CreateUpload(ctx, entity.UploadMeta{ID: "upload-1", Status: entity.UploadStatusQueued}); err != nil {
+		t.Fatalf("create upload: %v", err)
+	}
+
+	csv := strings.Join([]string{
+		"1674507883, JOHN DOE, CREDIT, 100, SUCCESS, salary",
+		"bad,row",
+		"1674507884, JOHN DOE, DEBIT, 40, SUCCESS, grocery",
+	}, "\n")
+	if err := uc.processUpload(ctx, "upload-1", DefaultParseProfile(), []UploadPart{{Reader: strings.NewReader(csv)}}); err != nil {
+		t.Fatalf("process upload: %v", err)
+	}
+
+	if got := testutil.ToFloat64(metrics.lines); got != 3 {
+		t.Fatalf("expected 3 lines, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.parseErrors); got != 1 {
+		t.Fatalf("expected 1 parse error, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.uploads.WithLabelValues(string(entity.UploadStatusDone))); got != 1 {
+		t.Fatalf("expected 1 finished upload, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.inProgress); got != 0 {
+		t.Fatalf("expected no upload in progress, got %v", got)
+	}
+}
+
+func TestProcessUploadPublishesProgress(t *testing.T) {
+	store := newTestStore()
+	uc := New(Dependency{
+		Store:            store,
+		Clock:            fixedClock{now: time.Unix(1, 0)},
+		ID:               &testID{},
+		ProgressInterval: 2,
+	})
+	ctx := context.Background()
+
+	uploadID := "upload-1"
+	if err := store.CreateUpload(ctx, entity.UploadMeta{ID: uploadID, Status: entity.UploadStatusQueued}); err != nil {
+		t.Fatalf("create upload: %v", err)
+	}
+
+	stream, err := uc.SubscribeProgress(ctx, uploadID)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer stream.Close()
+
+	if stream.Snapshot.Type != ProgressStatus || stream.Snapshot.Statement.Meta.Status != entity.UploadStatusQueued {
+		t.Fatalf("unexpected snapshot: %+v", stream.Snapshot)
+	}
+
+	csv := strings.Join([]string{
+		"1674507883, JOHN DOE, CREDIT, 100, SUCCESS, salary",
+		"bad,row",
+		"1674507884, JOHN DOE, DEBIT, 40, SUCCESS, grocery",
+	}, "\n")
+	if err := uc.processUpload(ctx, uploadID, DefaultParseProfile(), []UploadPart{{Reader: strings.NewReader(csv)}}); err != nil {
+		t.Fatalf("process upload: %v", err)
+	}
+
+	var types []ProgressEventType
+	var last ProgressEvent
+	for event := range stream.Events {
+		types = append(types, event.Type)
+		last = event
+		if event.Type == ProgressParseError && event.ParseError.Line != 2 {
+			t.Fatalf("unexpected parse error event: %+v", event.ParseError)
+		}
+	}
+
+	want := []ProgressEventType{ProgressStatus, ProgressLines, ProgressParseError, ProgressSummary}
+	if !slices.Equal(types, want) {
+		t.Fatalf("expected events %v, got %v", want, types)
+	}
+
+	meta := last.Statement.Meta
+	if meta.Status != entity.UploadStatusDone || meta.TotalLines != 3 || meta.ParsedOK != 2 || meta.ParseErr != 1 {
+		t.Fatalf("unexpected summary: %+v", meta)
+	}
+	if last.Balances[DefaultCurrency].String() != "60" {
+		t.Fatalf("unexpected summary balances: %+v", last.Balances)
+	}
+}
+
+func TestSubscribeProgressOnFinishedUpload(t *testing.T) {
+	store := newTestStore()
+	uc := New(Dependency{Store: store})
+	ctx := context.Background()
+
+	if _, err := uc.SubscribeProgress(ctx, "missing"); err == nil {
+		t.Fatal("expected error for unknown upload")
+	}
+
+	if err := store.CreateUpload(ctx, entity.UploadMeta{ID: "done", Status: entity.UploadStatusDone}); err != nil {
+		t.Fatalf("create upload: %v", err)
+	}
+
+	stream, err := uc.SubscribeProgress(ctx, "done")
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer stream.Close()
+
+	if stream.Snapshot.Type != ProgressSummary {
+		t.Fatalf("expected summary snapshot, got %+v", stream.Snapshot)
+	}
+	if _, ok := <-stream.Events; ok {
+		t.Fatal("expected events to be closed")
+	}
+}
+
+func TestProgressHubDropsSlowSubscriber(t *testing.T) {
+	hub := newProgressHub()
+	slow := hub.subscribe("upload-1")
+
+	for range progressBuffer + 1 {
+		hub.publish("upload-1", ProgressEvent{Type: ProgressLines})
+	}
+
+	received := 0
+	for range slow.ch {
+		received++
+	}
+	if received != progressBuffer {
+		t.Fatalf("expected %d buffered events before disconnect, got %d", progressBuffer, received)
+	}
+
+	hub.unsubscribe("upload-1", slow)
+	hub.shutdown()
+	if _, ok := <-hub.subscribe("upload-2").ch; ok {
+		t.Fatal("expected subscription after shutdown to be closed")
+	}
+}
+
+type testNotifier struct {
+	mu     sync.Mutex
+	events []entity.UploadCompletedEvent
+}
+
+func (n *testNotifier) NotifyUploadCompleted(ctx context.Context, event entity.UploadCompletedEvent) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, event)
+	return nil
+}
+
+func TestUploadValidatesCallbackURL(t *testing.T) {
+	withoutWebhooks := New(Dependency{Store: newTestStore(), Runner: testRunner{}, ID: &testID{}})
+	if _, err := withoutWebhooks.Upload(context.Background(), strings.NewReader(""), UploadOptions{CallbackURL: "https://ledger.test/hook"}); err == nil {
+		t.Fatal("expected callback_url to be rejected without webhooks")
+	}
+
+	uc := New(Dependency{Store: newTestStore(), Runner: testRunner{}, ID: &testID{}, Notifier: &testNotifier{}})
+	for _, raw := range []string{"ledger.test/hook", "ftp://ledger.test/hook", "https://", "://bad"} {
+		_, err := uc.Upload(context.Background(), strings.NewReader(""), UploadOptions{CallbackURL: raw})
+		var perr *pkgerror.Error
+		if !errors.As(err, &perr) || perr.Code() != pkgerror.CodeInvalidInput {
+			t.Fatalf("expected invalid input for %q, got %v", raw, err)
+		}
+	}
+}
+
+func TestProcessUploadNotifiesWhenFinal(t *testing.T) {
+	store := newTestStore()
+	notifier := &testNotifier{}
+	uc := New(Dependency{
+		Store:    store,
+		Runner:   testRunner{},
+		Clock:    fixedClock{now: time.Unix(1, 0)},
+		ID:       &testID{},
+		Notifier: notifier,
+	})
+
+	result, err := uc.Upload(context.Background(), strings.NewReader("1674507883, JOHN DOE, CREDIT, 100, SUCCESS, salary\n"), UploadOptions{
+		CallbackURL: "https://ledger.test/hook",
+	})
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	if len(notifier.events) != 1 {
+		t.Fatalf("expected one notification, got %d", len(notifier.events))
+	}
+	event := notifier.events[0]
+	if event.EventID == "" || event.Meta.ID != result.UploadID || event.Meta.Status != entity.UploadStatusDone {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+	if event.Meta.CallbackURL != "https://ledger.test/hook" || event.Balances[DefaultCurrency].String() != "100" {
+		t.Fatalf("unexpected event payload: %+v", event)
+	}
+}
+
+func TestUploadReplaysIdempotencyKey(t *testing.T) {
+	store := newTestStore()
+	ids := &testID{}
+	newUsecase := func(now int64) *Usecase {
+		return New(Dependency{
+			Store:             store,
+			Runner:            testRunner{},
+			Clock:             fixedClock{now: time.Unix(now, 0)},
+			ID:                ids,
+			IdempotencyWindow: time.Hour,
+		})
+	}
+	csv := "1674507883, JOHN DOE, CREDIT, 100, SUCCESS, salary\n"
+	opts := UploadOptions{IdempotencyKey: "retry-1"}
+
+	first, err := newUsecase(1000).Upload(context.Background(), strings.NewReader(csv), opts)
+	if err != nil {
+		t.Fatalf("first upload: %v", err)
+	}
+	if first.Replayed {
+		t.Fatal("first upload must not be a replay")
+	}
+
+	retry, err := newUsecase(1000+59*60).Upload(context.Background(), strings.NewReader(csv), opts)
+	if err != nil {
+		t.Fatalf("retry upload: %v", err)
+	}
+	if !retry.Replayed || retry.UploadID != first.UploadID {
+		t.Fatalf("expected replay of %s, got %+v", first.UploadID, retry)
+	}
+	if len(store.metas) != 1 {
+		t.Fatalf("expected the replayed upload to be removed, got %d uploads", len(store.metas))
+	}
+	if store.metas[first.UploadID].IdempotencyKey != "retry-1" {
+		t.Fatalf("expected idempotency key on meta, got %+v", store.metas[first.UploadID])
+	}
+
+	late, err := newUsecase(1000+61*60).Upload(context.Background(), strings.NewReader(csv), opts)
+	if err != nil {
+		t.Fatalf("late upload: %v", err)
+	}
+	if late.Replayed || late.UploadID == first.UploadID {
+		t.Fatalf("expected a new upload after the window, got %+v", late)
+	}
+}
+
+func TestProcessUploadLinksDuplicateContent(t *testing.T) {
+	store := newTestStore()
+	events := &testPublisher{}
+	uc := New(Dependency{
+		Store:            store,
+		Events:           events,
+		Runner:           testRunner{},
+		Clock:            fixedClock{now: time.Unix(1, 0)},
+		ID:               &testID{},
+		DetectDuplicates: true,
+	})
+	csv := strings.Join([]string{
+		"1674507883, JOHN DOE, CREDIT, 100, SUCCESS, salary",
+		"1674507885, JOHN DOE, DEBIT, 20, FAILED, restaurant",
+	}, "\n")
+
+	first, err := uc.Upload(context.Background(), strings.NewReader(csv), UploadOptions{})
+	if err != nil {
+		t.Fatalf("first upload: %v", err)
+	}
+	second, err := uc.Upload(context.Background(), strings.NewReader(csv), UploadOptions{})
+	if err != nil {
+		t.Fatalf("second upload: %v", err)
+	}
+	other, err := uc.Upload(context.Background(), strings.NewReader(csv+"\n"), UploadOptions{})
+	if err != nil {
+		t.Fatalf("other upload: %v", err)
+	}
+
+	firstMeta, secondMeta, otherMeta := store.metas[first.UploadID], store.metas[second.UploadID], store.metas[other.UploadID]
+	if len(firstMeta.ContentHash) != 64 || firstMeta.ContentHash != secondMeta.ContentHash {
+		t.Fatalf("expected matching content hashes, got %q and %q", firstMeta.ContentHash, secondMeta.ContentHash)
+	}
+	if firstMeta.DuplicateOf != "" || secondMeta.DuplicateOf != first.UploadID || otherMeta.DuplicateOf != "" {
+		t.Fatalf("unexpected duplicate links: %q, %q, %q", firstMeta.DuplicateOf, secondMeta.DuplicateOf, otherMeta.DuplicateOf)
+	}
+	if secondMeta.Status != entity.UploadStatusDone || secondMeta.TotalLines != 0 || len(store.issues[second.UploadID]) != 0 {
+		t.Fatalf("expected the duplicate not to be processed, got %+v and %d issues", secondMeta, len(store.issues[second.UploadID]))
+	}
+	if otherMeta.ParsedOK != 2 || len(store.issues[other.UploadID]) != 1 {
+		t.Fatalf("expected the changed upload to be processed, got %+v", otherMeta)
+	}
+	if len(events.events) != 2 || events.events[0].UploadID != first.UploadID || events.events[1].UploadID != other.UploadID {
+		t.Fatalf("expected failed events for the first and changed uploads only, got %+v", events.events)
+	}
+}
+
+func TestProcessUploadReprocessesFailedDuplicate(t *testing.T) {
+	store := newTestStore()
+	uc := New(Dependency{
+		Store:            store,
+		Runner:           testRunner{},
+		Clock:            fixedClock{now: time.Unix(1, 0)},
+		ID:               &testID{},
+		DetectDuplicates: true,
+	})
+	csv := "1674507883, JOHN DOE, CREDIT, 100, SUCCESS, salary\n"
+
+	first, err := uc.Upload(context.Background(), strings.NewReader(csv), UploadOptions{})
+	if err != nil {
+		t.Fatalf("first upload: %v", err)
+	}
+	store.mu.Lock()
+	failed := store.metas[first.UploadID]
+	failed.Status = entity.UploadStatusFailed
+	store.metas[first.UploadID] = failed
+	store.mu.Unlock()
+
+	second, err := uc.Upload(context.Background(), strings.NewReader(csv), UploadOptions{})
+	if err != nil {
+		t.Fatalf("second upload: %v", err)
+	}
+	if meta := store.metas[second.UploadID]; meta.DuplicateOf != "" || meta.ParsedOK != 1 {
+		t.Fatalf("expected a retry of a failed upload to be processed, got %+v", meta)
+	}
+}
+
+func TestProcessUploadReprocessesDuplicateOfUnfinishedUpload(t *testing.T) {
+	store := newTestStore()
+	uc := New(Dependency{
+		Store:            store,
+		Runner:           testRunner{},
+		Clock:            fixedClock{now: time.Unix(1, 0)},
+		ID:               &testID{},
+		DetectDuplicates: true,
+	})
+	csv := "1674507883, JOHN DOE, CREDIT, 100, SUCCESS, salary\n"
+
+	first, err := uc.Upload(context.Background(), strings.NewReader(csv), UploadOptions{})
+	if err != nil {
+		t.Fatalf("first upload: %v", err)
+	}
+	setStatus := func(status entity.UploadStatus) {
+		store.mu.Lock()
+		meta := store.metas[first.UploadID]
+		meta.Status = status
+		store.metas[first.UploadID] = meta
+		store.mu.Unlock()
+	}
+	setStatus(entity.UploadStatusProcessing)
+
+	second, err := uc.Upload(context.Background(), strings.NewReader(csv), UploadOptions{})
+	if err != nil {
+		t.Fatalf("second upload: %v", err)
+	}
+
+	// The earlier upload fails after the re-upload was accepted.
+	setStatus(entity.UploadStatusFailed)
+
+	if meta := store.metas[second.UploadID]; meta.DuplicateOf != "" || meta.Status != entity.UploadStatusDone || meta.ParsedOK != 1 {
+		t.Fatalf("expected the re-upload to be processed on its own, got %+v", meta)
+	}
+	balance, err := uc.Balance(context.Background(), second.UploadID)
+	if err != nil {
+		t.Fatalf("balance: %v", err)
+	}
+	if got := balance.Balances["IDR"]; got.Cmp(pkgdecimal.MustParse("100")) != 0 {
+		t.Fatalf("expected the re-upload to have its own balance, got %v", balance.Balances)
+	}
+}
+
+func TestCancelStopsUploadMidStream(t *testing.T) {
+	store := newTestStore()
+	events := &testPublisher{}
+	notifier := &testNotifier{}
+	runner := pkgroutine.NewManager(2)
+	uc := New(Dependency{
+		Store:    store,
+		Events:   events,
+		Notifier: notifier,
+		Runner:   runner,
+		Clock:    fixedClock{now: time.Unix(1, 0)},
+		ID:       &testID{},
+	})
+
+	pr, pw := io.Pipe()
+	result, err := uc.Upload(context.Background(), pr, UploadOptions{})
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	lines := "1674507883, JOHN DOE, CREDIT, 100, SUCCESS, salary\n1674507885, JOHN DOE, DEBIT, 20, FAILED, restaurant\n"
+	if _, err := pw.Write([]byte(lines)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		events.mu.Lock()
+		published := len(events.events)
+		events.mu.Unlock()
+		if published == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("failed transaction was not published")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	statement, err := uc.Cancel(context.Background(), result.UploadID)
+	if err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	meta := statement.Meta
+	if meta.Status != entity.UploadStatusCanceled || meta.Err != "upload canceled" || meta.ParsedOK != 2 || meta.ParseErr != 0 {
+		t.Fatalf("unexpected canceled meta: %+v", meta)
+	}
+	if _, err := pw.Write([]byte(lines)); !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("expected the upload reader to be closed, got %v", err)
+	}
+	if err := runner.Wait(); err != nil {
+		t.Fatalf("runner wait: %v", err)
+	}
+
+	balances, _, err := store.GetBalance(context.Background(), result.UploadID)
+	if err != nil {
+		t.Fatalf("get balance: %v", err)
+	}
+	if len(balances) != 0 {
+		t.Fatalf("expected no balance for a canceled upload, got %v", balances)
+	}
+	if len(store.issues[result.UploadID]) != 1 || len(events.events) != 1 {
+		t.Fatalf("expected the parsed issue and its event to be kept, got %d issues and %d events", len(store.issues[result.UploadID]), len(events.events))
+	}
+	if len(notifier.events) != 0 {
+		t.Fatalf("expected no webhook for a canceled upload, got %+v", notifier.events)
+	}
+
+	var perr *pkgerror.Error
+	if _, err := uc.Cancel(context.Background(), result.UploadID); !errors.As(err, &perr) || perr.Code() != pkgerror.CodeConflict {
+		t.Fatalf("expected conflict when canceling a finished upload, got %v", err)
+	}
+}
+
+func TestCancelQueuedUploadWhileSlotsAreBusy(t *testing.T) {
+	store := newTestStore()
+	runner := pkgroutine.NewManager(1)
+	uc := New(Dependency{
+		Store:  store,
+		Runner: runner,
+		Clock:  fixedClock{now: time.Unix(1, 0)},
+		ID:     &testID{},
+	})
+
+	// The first upload holds the only slot until its reader is closed.
+	pr, pw := io.Pipe()
+	busy, err := uc.Upload(context.Background(), pr, UploadOptions{})
+	if err != nil {
+		t.Fatalf("first upload: %v", err)
+	}
+
+	queued := make(chan UploadResult, 1)
+	go func() {
+		result, err := uc.Upload(context.Background(), strings.NewReader("1674507883, JOHN DOE, CREDIT, 100, SUCCESS, salary\n"), UploadOptions{})
+		if err != nil {
+			t.Errorf("second upload: %v", err)
+		}
+		queued <- result
+	}()
+
+	var queuedID string
+	deadline := time.Now().Add(3 * time.Second)
+	for queuedID == "" {
+		store.mu.Lock()
+		for id, meta := range store.metas {
+			if id != busy.UploadID && meta.Status == entity.UploadStatusQueued {
+				queuedID = id
+			}
+		}
+		store.mu.Unlock()
+		if time.Now().After(deadline) {
+			t.Fatal("second upload was not queued")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	statement, err := uc.Cancel(ctx, queuedID)
+	if err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if statement.Meta.Status != entity.UploadStatusCanceled || statement.Meta.Err != "upload canceled" {
+		t.Fatalf("unexpected canceled meta: %+v", statement.Meta)
+	}
+	if result := <-queued; result.UploadID != queuedID {
+		t.Fatalf("expected the queued upload to be returned, got %+v", result)
+	}
+
+	_ = pw.Close()
+	if err := runner.Wait(); err != nil {
+		t.Fatalf("runner wait: %v", err)
+	}
+	if meta := store.metas[busy.UploadID]; meta.Status != entity.UploadStatusDone {
+		t.Fatalf("expected the busy upload to finish, got %+v", meta)
+	}
+	if meta := store.metas[queuedID]; meta.Status != entity.UploadStatusCanceled || meta.TotalLines != 0 {
+		t.Fatalf("expected the queued upload to stay canceled and unprocessed, got %+v", meta)
+	}
+}
+
+func TestCancelMarksUploadWithoutWorker(t *testing.T) {
+	store := newTestStore()
+	uc := New(Dependency{Store: store, Clock: fixedClock{now: time.Unix(50, 0)}})
+
+	if err := store.CreateUpload(context.Background(), entity.UploadMeta{ID: "left-over", Status: entity.UploadStatusProcessing, StartedAt: 10}); err != nil {
+		t.Fatalf("create upload: %v", err)
+	}
+
+	statement, err := uc.Cancel(context.Background(), "left-over")
+	if err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if statement.Meta.Status != entity.UploadStatusCanceled || statement.Meta.EndedAt != 50 {
+		t.Fatalf("unexpected statement: %+v", statement.Meta)
+	}
+
+	var perr *pkgerror.Error
+	if _, err := uc.Cancel(context.Background(), "missing"); !errors.As(err, &perr) || perr.Code() != pkgerror.CodeNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+type testDeadLetters struct {
+	letters []entity.DeadLetter
+	healthy map[string]bool
+}
+
+func (q *testDeadLetters) DeadLetters(ctx context.Context, page, pageSize int) ([]entity.DeadLetter, int, error) {
+	start := min((page-1)*pageSize, len(q.letters))
+	end := min(start+pageSize, len(q.letters))
+	return q.letters[start:end], len(q.letters), nil
+}
+
+func (q *testDeadLetters) ReplayDeadLetter(ctx context.Context, eventID string) (entity.DeadLetter, bool, error) {
+	for i, letter := range q.letters {
+		if letter.Event.EventID != eventID {
+			continue
+		}
+		if !q.healthy[eventID] {
+			letter.Attempts++
+			q.letters[i] = letter
+			return letter, false, nil
+		}
+		q.letters = slices.Delete(q.letters, i, i+1)
+		return letter, true, nil
+	}
+	return entity.DeadLetter{}, false, pkgerror.ErrNotFound
+}
+
+func TestReplayDeadLetters(t *testing.T) {
+	var letters []entity.DeadLetter
+	for i := range deadLetterPageSize + 1 {
+		letters = append(letters, entity.DeadLetter{Event: entity.FailedTxEvent{EventID: fmt.Sprintf("evt-%d", i)}, Attempts: 1})
+	}
+	healthy := make(map[string]bool)
+	for _, letter := range letters[1:] {
+		healthy[letter.Event.EventID] = true
+	}
+	queue := &testDeadLetters{letters: letters, healthy: healthy}
+	uc := New(Dependency{Store: newTestStore(), DeadLetters: queue})
+
+	result, err := uc.ReplayDeadLetters(context.Background(), []string{"evt-1", "missing"})
+	if err != nil {
+		t.Fatalf("replay selected: %v", err)
+	}
+	if !reflect.DeepEqual(result.Replayed, []string{"evt-1"}) || !reflect.DeepEqual(result.NotFound, []string{"missing"}) {
+		t.Fatalf("unexpected selected replay: %+v", result)
+	}
+
+	result, err = uc.ReplayDeadLetters(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("replay all: %v", err)
+	}
+	if len(result.Replayed) != deadLetterPageSize-1 || len(result.Failed) != 1 || result.Failed[0].Attempts != 2 {
+		t.Fatalf("unexpected replay of all: %d replayed, failed %+v", len(result.Replayed), result.Failed)
+	}
+
+	var perr *pkgerror.Error
+	if _, err := uc.ReplayDeadLetter(context.Background(), "evt-1"); !errors.As(err, &perr) || perr.Code() != pkgerror.CodeNotFound {
+		t.Fatalf("expected not found for a replayed dead letter, got %v", err)
+	}
+	if _, err := New(Dependency{}).DeadLetters(context.Background(), 1, 10); !errors.As(err, &perr) || perr.Code() != pkgerror.CodeNotFound {
+		t.Fatalf("expected not found without a dead letter queue, got %v", err)
+	}
+}
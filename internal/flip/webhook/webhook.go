@@ -0,0 +1,475 @@
+// Package webhook delivers upload completion events to HTTP endpoints.
+//
+// Every request carries a JSON payload signed with HMAC-SHA256. Failed
+// deliveries are retried with exponential backoff and each attempt is
+// recorded so it can be inspected per upload.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgerror"
+)
+
+// EventUploadCompleted is the event name sent in the payload and the
+// X-Goflip-Event header.
+const EventUploadCompleted = "upload.completed"
+
+// Headers set on every delivery. The signature is "sha256=" followed by the
+// hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the shared secret.
+const (
+	HeaderEvent     = "X-Goflip-Event"
+	HeaderEventID   = "X-Goflip-Event-Id"
+	HeaderTimestamp = "X-Goflip-Timestamp"
+	HeaderSignature = "X-Goflip-Signature"
+)
+
+var (
+	ErrDispatcherClosed = errors.New("webhook dispatcher is closed")
+
+	// ErrQueueFull is returned by NotifyUploadCompleted for the targets that
+	// did not fit in the queue. Those deliveries are recorded as failed.
+	ErrQueueFull = errors.New("webhook queue is full")
+
+	// ErrForbiddenAddress fails a delivery to a callback URL that resolves to
+	// a loopback, link-local, private or unspecified address.
+	ErrForbiddenAddress = errors.New("callback address is not allowed")
+)
+
+// Recorder stores the outcome of every delivery attempt.
+type Recorder interface {
+	AppendWebhookDeliveries(ctx context.Context, uploadID string, deliveries []entity.WebhookDelivery) error
+}
+
+type Config struct {
+	// URLs receive every event, in addition to the callback URL of the upload.
+	URLs []string
+
+	// Secret signs every payload.
+	Secret string
+
+	// MaxAttempts is the number of tries per endpoint, including the first.
+	MaxAttempts int
+
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	Timeout     time.Duration
+	Workers     int
+	Buffer      int
+
+	// AllowPrivateCallbacks lets the callback URLs given by uploaders reach
+	// loopback, link-local and private addresses. Configured URLs always can.
+	AllowPrivateCallbacks bool
+}
+
+type job struct {
+	url      string
+	uploadID string
+	eventID  string
+	body     []byte
+	callback bool
+}
+
+// Dispatcher sends events from a queue with a fixed pool of workers, so slow
+// endpoints never hold up upload processing.
+type Dispatcher struct {
+	cfg            Config
+	recorder       Recorder
+	client         *http.Client
+	callbackClient *http.Client // for the callback URLs of uploads
+
+	mu     sync.RWMutex
+	closed bool
+	jobs   chan job
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher fills in defaults for unset Config fields. A nil client uses
+// one with Config.Timeout that does not follow redirects, and a second one for
+// callback URLs that refuses to dial private addresses unless
+// Config.AllowPrivateCallbacks is set. A given client is used for both.
+func NewDispatcher(cfg Config, recorder Recorder, client *http.Client) *Dispatcher {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Minute
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Workers < 1 {
+		cfg.Workers = 2
+	}
+	if cfg.Buffer < 1 {
+		cfg.Buffer = 256
+	}
+
+	callbackClient := client
+	if client == nil {
+		client = newClient(cfg.Timeout, nil)
+		callbackClient = client
+		if !cfg.AllowPrivateCallbacks {
+			callbackClient = newClient(cfg.Timeout, publicOnly)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		cfg:            cfg,
+		recorder:       recorder,
+		client:         client,
+		callbackClient: callbackClient,
+		jobs:           make(chan job, cfg.Buffer),
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+}
+
+// newClient returns a client that does not follow redirects. A non-nil
+// control vets every address it dials, after name resolution, so a hostname
+// cannot be rebound to a forbidden address; it also bypasses proxies, which
+// would otherwise be dialed instead.
+func newClient(timeout time.Duration, control func(network, address string, c syscall.RawConn) error) *http.Client {
+	client := &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	if control != nil {
+		transport, _ := http.DefaultTransport.(*http.Transport)
+		transport = transport.Clone()
+		transport.Proxy = nil
+		transport.DialContext = (&net.Dialer{Timeout: timeout, Control: control}).DialContext
+		client.Transport = transport
+	}
+
+	return client
+}
+
+// publicOnly is a net.Dialer control that refuses loopback, link-local,
+// private and unspecified addresses.
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+
+	return nil
+}
+
+func (d *Dispatcher) Start() {
+	for i := 0; i < d.cfg.Workers; i++ {
+		d.wg.Add(1)
+		go d.worker()
+	}
+}
+
+// Stop lets queued deliveries finish until ctx expires, then abandons the
+// remaining retries.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.jobs)
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// NotifyUploadCompleted queues the event for every configured URL and the
+// callback URL of the upload. It never waits for room in the queue: targets
+// that do not fit are recorded as failed deliveries and ErrQueueFull is
+// returned.
+func (d *Dispatcher) NotifyUploadCompleted(_ context.Context, event entity.UploadCompletedEvent) error {
+	jobs := make([]job, 0, len(d.cfg.URLs)+1)
+	for _, url := range d.cfg.URLs {
+		jobs = append(jobs, job{url: url})
+	}
+	if url := event.Meta.CallbackURL; url != "" && !slices.Contains(d.cfg.URLs, url) {
+		jobs = append(jobs, job{url: url, callback: true})
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(newPayload(event))
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		jobs[i].uploadID = event.Meta.ID
+		jobs[i].eventID = event.EventID
+		jobs[i].body = body
+	}
+
+	dropped, err := d.enqueue(jobs)
+	if err != nil {
+		return err
+	}
+	if len(dropped) == 0 {
+		return nil
+	}
+
+	for _, j := range dropped {
+		d.record(j, entity.WebhookDelivery{
+			EventID: j.eventID,
+			URL:     j.url,
+			Err:     ErrQueueFull.Error(),
+			At:      time.Now().Unix(),
+		})
+	}
+	return fmt.Errorf("%w: dropped %d of %d deliveries", ErrQueueFull, len(dropped), len(jobs))
+}
+
+// enqueue adds jobs to the queue without blocking and returns those that did
+// not fit. The read lock only keeps Stop from closing the queue meanwhile.
+func (d *Dispatcher) enqueue(jobs []job) ([]job, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		return nil, ErrDispatcherClosed
+	}
+
+	var dropped []job
+	for _, j := range jobs {
+		select {
+		case d.jobs <- j:
+		default:
+			dropped = append(dropped, j)
+		}
+	}
+
+	return dropped, nil
+}
+
+func (d *Dispatcher) worker() {
+	defer d.wg.Done()
+
+	for j := range d.jobs {
+		d.deliver(j)
+	}
+}
+
+// deliver tries j until it succeeds, fails permanently or runs out of
+// attempts.
+func (d *Dispatcher) deliver(j job) {
+	backoff := d.cfg.BaseBackoff
+	for attempt := 1; attempt <= d.cfg.MaxAttempts; attempt++ {
+		if d.ctx.Err() != nil {
+			return
+		}
+
+		status, err := d.send(j)
+		d.record(j, entity.WebhookDelivery{
+			EventID:    j.eventID,
+			URL:        j.url,
+			Attempt:    attempt,
+			StatusCode: status,
+			Err:        errString(err),
+			Delivered:  err == nil,
+			At:         time.Now().Unix(),
+		})
+		if err == nil {
+			return
+		}
+
+		if !retryable(status) || errors.Is(err, ErrForbiddenAddress) || attempt == d.cfg.MaxAttempts {
+			slog.Error("failed to deliver webhook", "upload_id", j.uploadID, "event_id", j.eventID, "url", j.url, "attempts", attempt, "error", err)
+			return
+		}
+
+		if !d.sleep(backoff) {
+			return
+		}
+		backoff = min(backoff*2, d.cfg.MaxBackoff)
+	}
+}
+
+func (d *Dispatcher) send(j job) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, j.url, bytes.NewReader(j.body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "goflip-webhook")
+	req.Header.Set(HeaderEvent, EventUploadCompleted)
+	req.Header.Set(HeaderEventID, j.eventID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(d.cfg.Secret, timestamp, j.body))
+
+	client := d.client
+	if j.callback {
+		client = d.callbackClient
+	}
+
+	//nolint:gosec // the URL is configured, or a callback dialed only to public addresses
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) record(j job, delivery entity.WebhookDelivery) {
+	if d.recorder == nil {
+		return
+	}
+
+	err := d.recorder.AppendWebhookDeliveries(context.Background(), j.uploadID, []entity.WebhookDelivery{delivery})
+	if err != nil && !errors.Is(err, pkgerror.ErrNotFound) {
+		slog.Warn("failed to record webhook delivery", "upload_id", j.uploadID, "event_id", j.eventID, "error", err)
+	}
+}
+
+// sleep waits for d unless the dispatcher is stopped first.
+func (d *Dispatcher) sleep(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-d.ctx.Done():
+		return false
+	}
+}
+
+// retryable reports whether a failed attempt is worth repeating: network
+// errors, timeouts, throttling and server errors are; other responses are not.
+func retryable(status int) bool {
+	switch {
+	case status == 0, status == http.StatusRequestTimeout, status == http.StatusTooManyRequests:
+		return true
+	default:
+		return status >= http.StatusInternalServerError
+	}
+}
+
+// Sign returns the signature header value for body sent at timestamp.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature matches body sent at timestamp.
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+type payload struct {
+	Event       string              `json:"event"`
+	EventID     string              `json:"event_id"`
+	UploadID    string              `json:"upload_id"`
+	Status      entity.UploadStatus `json:"status"`
+	Error       string              `json:"error,omitempty"`
+	Profile     string              `json:"profile,omitempty"`
+	FileName    string              `json:"file_name,omitempty"`
+	DuplicateOf string              `json:"duplicate_of,omitempty"`
+	Balances    []balance           `json:"balances"`
+	Stats       stats               `json:"stats"`
+	StartedAt   int64               `json:"started_at"`
+	EndedAt     int64               `json:"ended_at"`
+}
+
+type balance struct {
+	Currency string `json:"currency"`
+	Amount   string `json:"amount"`
+}
+
+type stats struct {
+	TotalLines int64 `json:"total_lines"`
+	ParsedOK   int64 `json:"parsed_ok"`
+	ParseErr   int64 `json:"parse_err"`
+}
+
+func newPayload(event entity.UploadCompletedEvent) payload {
+	meta := event.Meta
+
+	balances := make([]balance, 0, len(event.Balances))
+	for _, currency := range slices.Sorted(maps.Keys(event.Balances)) {
+		balances = append(balances, balance{Currency: currency, Amount: event.Balances[currency].String()})
+	}
+
+	return payload{
+		Event:       EventUploadCompleted,
+		EventID:     event.EventID,
+		UploadID:    meta.ID,
+		Status:      meta.Status,
+		Error:       meta.Err,
+		Profile:     meta.Profile,
+		FileName:    meta.FileName,
+		DuplicateOf: meta.DuplicateOf,
+		Balances:    balances,
+		Stats:       stats{TotalLines: meta.TotalLines, ParsedOK: meta.ParsedOK, ParseErr: meta.ParseErr},
+		StartedAt:   meta.StartedAt,
+		EndedAt:     meta.EndedAt,
+	}
+}
@@ -0,0 +1,229 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shandysiswandi/goflip/internal/flip/entity"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgdecimal"
+)
+
+type testRecorder struct {
+	mu         sync.Mutex
+	deliveries []entity.WebhookDelivery
+	done       chan struct{}
+	want       int
+}
+
+func newTestRecorder(want int) *testRecorder {
+	return &testRecorder{done: make(chan struct{}), want: want}
+}
+
+func (r *testRecorder) AppendWebhookDeliveries(ctx context.Context, uploadID string, deliveries []entity.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deliveries = append(r.deliveries, deliveries...)
+	if len(r.deliveries) == r.want {
+		close(r.done)
+	}
+	return nil
+}
+
+func (r *testRecorder) wait(t *testing.T) []entity.WebhookDelivery {
+	t.Helper()
+
+	select {
+	case <-r.done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for deliveries")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]entity.WebhookDelivery(nil), r.deliveries...)
+}
+
+func testEvent(callbackURL string) entity.UploadCompletedEvent {
+	return entity.UploadCompletedEvent{
+		EventID: "evt-1",
+		Meta: entity.UploadMeta{
+			ID:          "upload-1",
+			Status:      entity.UploadStatusDone,
+			TotalLines:  3,
+			ParsedOK:    2,
+			ParseErr:    1,
+			CallbackURL: callbackURL,
+		},
+		Balances: entity.Balances{"USD": pkgdecimal.MustParse("1.5"), "IDR": pkgdecimal.MustParse("100")},
+	}
+}
+
+func TestDispatcherDeliversSignedPayloadWithRetry(t *testing.T) {
+	var calls atomic.Int32
+	received := make(chan payload, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !Verify("secret", r.Header.Get(HeaderTimestamp), body, r.Header.Get(HeaderSignature)) {
+			t.Errorf("invalid signature %q", r.Header.Get(HeaderSignature))
+		}
+		if r.Header.Get(HeaderEventID) != "evt-1" || r.Header.Get(HeaderEvent) != EventUploadCompleted {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var p payload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		received <- p
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	recorder := newTestRecorder(2)
+	d := NewDispatcher(Config{URLs: []string{receiver.URL}, Secret: "secret", BaseBackoff: time.Millisecond}, recorder, nil)
+	d.Start()
+	defer func() { _ = d.Stop(context.Background()) }()
+
+	if err := d.NotifyUploadCompleted(context.Background(), testEvent("")); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+
+	deliveries := recorder.wait(t)
+	if deliveries[0].Delivered || deliveries[0].StatusCode != http.StatusServiceUnavailable || deliveries[0].Attempt != 1 {
+		t.Fatalf("unexpected first attempt: %+v", deliveries[0])
+	}
+	if !deliveries[1].Delivered || deliveries[1].StatusCode != http.StatusNoContent || deliveries[1].Attempt != 2 {
+		t.Fatalf("unexpected second attempt: %+v", deliveries[1])
+	}
+
+	p := <-received
+	if p.UploadID != "upload-1" || p.Status != entity.UploadStatusDone || p.Stats.ParseErr != 1 {
+		t.Fatalf("unexpected payload: %+v", p)
+	}
+	if len(p.Balances) != 2 || p.Balances[0].Currency != "IDR" || p.Balances[1].Amount != "1.5" {
+		t.Fatalf("unexpected payload balances: %+v", p.Balances)
+	}
+}
+
+func TestDispatcherDoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer receiver.Close()
+
+	recorder := newTestRecorder(1)
+	d := NewDispatcher(Config{Secret: "secret", BaseBackoff: time.Millisecond, AllowPrivateCallbacks: true}, recorder, nil)
+	d.Start()
+
+	if err := d.NotifyUploadCompleted(context.Background(), testEvent(receiver.URL)); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+
+	deliveries := recorder.wait(t)
+	if err := d.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if calls.Load() != 1 || deliveries[0].Delivered || deliveries[0].URL != receiver.URL {
+		t.Fatalf("expected a single failed attempt, got %d calls and %+v", calls.Load(), deliveries)
+	}
+}
+
+func TestDispatcherRefusesPrivateCallbacks(t *testing.T) {
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer receiver.Close()
+
+	recorder := newTestRecorder(1)
+	d := NewDispatcher(Config{Secret: "secret", BaseBackoff: time.Millisecond}, recorder, nil)
+	d.Start()
+
+	if err := d.NotifyUploadCompleted(context.Background(), testEvent(receiver.URL)); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+
+	deliveries := recorder.wait(t)
+	if err := d.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if calls.Load() != 0 || len(deliveries) != 1 || deliveries[0].Delivered || !strings.Contains(deliveries[0].Err, ErrForbiddenAddress.Error()) {
+		t.Fatalf("expected a single refused attempt, got %d calls and %+v", calls.Load(), deliveries)
+	}
+}
+
+func TestDispatcherDropsWhenQueueFull(t *testing.T) {
+	recorder := newTestRecorder(1)
+	d := NewDispatcher(Config{URLs: []string{"http://a.test/hook"}, Secret: "secret", Buffer: 1}, recorder, nil)
+
+	// Without workers the first event fills the queue.
+	if err := d.NotifyUploadCompleted(context.Background(), testEvent("")); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	if err := d.NotifyUploadCompleted(context.Background(), testEvent("")); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	deliveries := recorder.wait(t)
+	if deliveries[0].Delivered || deliveries[0].Attempt != 0 || deliveries[0].Err != ErrQueueFull.Error() {
+		t.Fatalf("expected the dropped delivery to be recorded, got %+v", deliveries[0])
+	}
+}
+
+func TestDispatcherStopAbandonsPendingRetries(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	recorder := newTestRecorder(1)
+	d := NewDispatcher(Config{URLs: []string{receiver.URL}, Secret: "secret", BaseBackoff: time.Hour}, recorder, nil)
+	d.Start()
+
+	if err := d.NotifyUploadCompleted(context.Background(), testEvent("")); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	recorder.wait(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_ = d.Stop(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("stop waited %v for a pending retry", elapsed)
+	}
+
+	if err := d.NotifyUploadCompleted(context.Background(), testEvent("")); err != ErrDispatcherClosed {
+		t.Fatalf("expected ErrDispatcherClosed after stop, got %v", err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"upload.completed"}`)
+	sig := Sign("secret", "1700000000", body)
+
+	if !Verify("secret", "1700000000", body, sig) {
+		t.Fatal("expected signature to verify")
+	}
+	if Verify("other", "1700000000", body, sig) || Verify("secret", "1700000001", body, sig) {
+		t.Fatal("expected signature to depend on secret and timestamp")
+	}
+}
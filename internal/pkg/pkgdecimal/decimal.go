@@ -0,0 +1,228 @@
+package pkgdecimal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of fractional digits a Decimal keeps.
+const Scale = 4
+
+// unit is 10^Scale.
+const unit = 10000
+
+var (
+	// ErrSyntax indicates that a value is not a well-formed decimal.
+	ErrSyntax = errors.New("invalid decimal")
+
+	// ErrPrecision indicates that a value has more than Scale fractional digits.
+	ErrPrecision = errors.New("too many decimal places")
+
+	// ErrOverflow indicates that a value or result does not fit in a Decimal.
+	ErrOverflow = errors.New("decimal overflow")
+)
+
+// Decimal is a signed fixed-point number with Scale fractional digits. The
+// zero value is 0.
+type Decimal struct {
+	units int64
+}
+
+// FromUnits returns the Decimal holding units/10^Scale.
+func FromUnits(units int64) Decimal {
+	return Decimal{units: units}
+}
+
+// Units returns the value as a count of 1/10^Scale units.
+func (d Decimal) Units() int64 {
+	return d.units
+}
+
+// Parse reads a decimal using '.' as the decimal separator and no thousands
+// separator.
+func Parse(s string) (Decimal, error) {
+	return ParseLocale(s, 0, '.')
+}
+
+// MustParse is like Parse but panics on error. It is meant for constants and
+// tests.
+func MustParse(s string) Decimal {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// ParseLocale reads a decimal with the given separators. A zero thousands
+// separator disallows grouping. Thousands separators are only accepted between
+// digits of the integer part, after a first group of 1-3 digits and between
+// later groups of exactly 3, so "1,5" is rejected rather than read as 15.
+func ParseLocale(s string, thousands, decimal rune) (Decimal, error) {
+	if decimal == 0 || decimal == thousands {
+		return Decimal{}, fmt.Errorf("%w: ambiguous separators", ErrSyntax)
+	}
+
+	raw := s
+	s = strings.TrimSpace(s)
+
+	negative := false
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	var units uint64
+	var fracDigits int
+	var digits int
+	inFraction := false
+	lastWasSep := false
+	grouped := false // a thousands separator has been seen
+	group := 0       // digits in the current integer group
+
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			d := uint64(r - '0')
+			lastWasSep = false
+			digits++
+			if inFraction {
+				fracDigits++
+				if fracDigits > Scale {
+					if d != 0 {
+						return Decimal{}, fmt.Errorf("%w: %q", ErrPrecision, raw)
+					}
+					continue
+				}
+			} else {
+				group++
+			}
+			if units > (math.MaxInt64-d)/10 {
+				return Decimal{}, fmt.Errorf("%w: %q", ErrOverflow, raw)
+			}
+			units = units*10 + d
+		case r == decimal && !inFraction && !lastWasSep && (!grouped || group == 3):
+			inFraction = true
+			lastWasSep = true
+		case r == thousands && thousands != 0 && !inFraction && digits > 0 && !lastWasSep &&
+			(group == 3 || (!grouped && group <= 3)):
+			grouped = true
+			group = 0
+			lastWasSep = true
+		default:
+			return Decimal{}, fmt.Errorf("%w: %q", ErrSyntax, raw)
+		}
+	}
+
+	if digits == 0 || lastWasSep || (grouped && !inFraction && group != 3) {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrSyntax, raw)
+	}
+
+	for ; fracDigits < Scale; fracDigits++ {
+		if units > math.MaxInt64/10 {
+			return Decimal{}, fmt.Errorf("%w: %q", ErrOverflow, raw)
+		}
+		units *= 10
+	}
+
+	v := int64(units) //nolint:gosec // bounded by math.MaxInt64 above
+	if negative {
+		v = -v
+	}
+
+	return Decimal{units: v}, nil
+}
+
+// Add returns d+o, or ErrOverflow.
+func (d Decimal) Add(o Decimal) (Decimal, error) {
+	sum := d.units + o.units
+	if (o.units > 0 && sum < d.units) || (o.units < 0 && sum > d.units) {
+		return Decimal{}, ErrOverflow
+	}
+	return Decimal{units: sum}, nil
+}
+
+// Sub returns d-o, or ErrOverflow.
+func (d Decimal) Sub(o Decimal) (Decimal, error) {
+	if o.units == math.MinInt64 {
+		return Decimal{}, ErrOverflow
+	}
+	return d.Add(Decimal{units: -o.units})
+}
+
+// Cmp returns -1, 0 or +1 depending on whether d is less than, equal to or
+// greater than o.
+func (d Decimal) Cmp(o Decimal) int {
+	switch {
+	case d.units < o.units:
+		return -1
+	case d.units > o.units:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Sign returns -1, 0 or +1.
+func (d Decimal) Sign() int {
+	return d.Cmp(Decimal{})
+}
+
+// IsZero reports whether d is 0.
+func (d Decimal) IsZero() bool {
+	return d.units == 0
+}
+
+// String formats d with '.' as decimal separator and without trailing zeros,
+// for example "125000.5" or "-3".
+func (d Decimal) String() string {
+	abs := uint64(d.units) //nolint:gosec // two's complement handles math.MinInt64
+	if d.units < 0 {
+		abs = -abs
+	}
+
+	var sb strings.Builder
+	if d.units < 0 {
+		sb.WriteByte('-')
+	}
+	sb.WriteString(strconv.FormatUint(abs/unit, 10))
+
+	frac := abs % unit
+	if frac == 0 {
+		return sb.String()
+	}
+
+	digits := fmt.Sprintf("%0*d", Scale, frac)
+	sb.WriteByte('.')
+	sb.WriteString(strings.TrimRight(digits, "0"))
+
+	return sb.String()
+}
+
+// MarshalJSON encodes d as a JSON string so clients never round it through a
+// float.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON accepts a JSON string or number.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+
+	*d = v
+	return nil
+}
@@ -0,0 +1,111 @@
+package pkgdecimal
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseLocale(t *testing.T) {
+	tests := []struct {
+		in        string
+		thousands rune
+		decimal   rune
+		want      string
+		err       error
+	}{
+		{in: "125000.50", decimal: '.', want: "125000.5"},
+		{in: "100", decimal: '.', want: "100"},
+		{in: "-0.0001", decimal: '.', want: "-0.0001"},
+		{in: "+7.", decimal: '.', err: ErrSyntax},
+		{in: "1,250,000.50", thousands: ',', decimal: '.', want: "1250000.5"},
+		{in: "1.250.000,50", thousands: '.', decimal: ',', want: "1250000.5"},
+		{in: "1 250 000,5", thousands: ' ', decimal: ',', want: "1250000.5"},
+		{in: " 12.3400 ", decimal: '.', want: "12.34"},
+		{in: "1.23450", decimal: '.', want: "1.2345"},
+		{in: "1.23456", decimal: '.', err: ErrPrecision},
+		{in: "1,000", decimal: '.', err: ErrSyntax},
+		{in: ",100", thousands: ',', decimal: '.', err: ErrSyntax},
+		{in: "1,,000", thousands: ',', decimal: '.', err: ErrSyntax},
+		{in: "1,000,", thousands: ',', decimal: '.', err: ErrSyntax},
+		{in: "1.000,5", thousands: ',', decimal: '.', err: ErrSyntax},
+		{in: "1,5", thousands: ',', decimal: '.', err: ErrSyntax},
+		{in: "12,34,5", thousands: ',', decimal: '.', err: ErrSyntax},
+		{in: "1,5.25", thousands: ',', decimal: '.', err: ErrSyntax},
+		{in: "1234,567", thousands: ',', decimal: '.', err: ErrSyntax},
+		{in: "1,2345", thousands: ',', decimal: '.', err: ErrSyntax},
+		{in: "123,456.5", thousands: ',', decimal: '.', want: "123456.5"},
+		{in: "1234567.5", thousands: ',', decimal: '.', want: "1234567.5"},
+		{in: "", decimal: '.', err: ErrSyntax},
+		{in: "-", decimal: '.', err: ErrSyntax},
+		{in: "ten", decimal: '.', err: ErrSyntax},
+		{in: "922337203685477.5807", decimal: '.', want: "922337203685477.5807"},
+		{in: "922337203685477.5808", decimal: '.', err: ErrOverflow},
+		{in: "1", thousands: '.', decimal: '.', err: ErrSyntax},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLocale(tt.in, tt.thousands, tt.decimal)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("ParseLocale(%q) err = %v, want %v", tt.in, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseLocale(%q) err = %v", tt.in, err)
+			}
+			if got.String() != tt.want {
+				t.Fatalf("ParseLocale(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddSubOverflow(t *testing.T) {
+	a := MustParse("0.1")
+	b := MustParse("0.2")
+
+	sum, err := a.Add(b)
+	if err != nil || sum.String() != "0.3" {
+		t.Fatalf("0.1+0.2 = %s, %v", sum, err)
+	}
+
+	diff, err := a.Sub(b)
+	if err != nil || diff.String() != "-0.1" {
+		t.Fatalf("0.1-0.2 = %s, %v", diff, err)
+	}
+
+	maxValue := MustParse("922337203685477.5807")
+	if _, err := maxValue.Add(FromUnits(1)); !errors.Is(err, ErrOverflow) {
+		t.Fatalf("expected overflow, got %v", err)
+	}
+	if _, err := FromUnits(-2).Sub(maxValue); !errors.Is(err, ErrOverflow) {
+		t.Fatalf("expected overflow, got %v", err)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	in := MustParse("-125000.5")
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if string(data) != `"-125000.5"` {
+		t.Fatalf("marshal = %s", data)
+	}
+
+	var out Decimal
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if out.Cmp(in) != 0 {
+		t.Fatalf("round trip = %s, want %s", out, in)
+	}
+
+	if err := json.Unmarshal([]byte("42.25"), &out); err != nil || out.String() != "42.25" {
+		t.Fatalf("unmarshal number = %s, %v", out, err)
+	}
+}
@@ -0,0 +1,7 @@
+// Package pkgdecimal provides a fixed-point decimal for money amounts.
+//
+// Values are kept as an int64 count of 1/10^Scale units, so sums are exact and
+// never pick up binary floating-point error. Parsing understands
+// locale-specific thousands and decimal separators, for example "1.250.000,50"
+// as well as "1,250,000.50".
+package pkgdecimal
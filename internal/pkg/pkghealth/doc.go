@@ -0,0 +1,7 @@
+// Package pkghealth collects the health checks of the application's
+// components and serves them as liveness and readiness probes.
+//
+// Modules add named checks to a Registry. Liveness tells whether the process
+// should be restarted, readiness whether it should receive traffic; readiness
+// also fails once the Registry is drained at the start of shutdown.
+package pkghealth
@@ -0,0 +1,202 @@
+package pkghealth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDraining fails readiness once shutdown has started.
+var ErrDraining = errors.New("shutting down")
+
+// DefaultTimeout bounds each check when NewRegistry receives a non-positive
+// timeout.
+const DefaultTimeout = 2 * time.Second
+
+// Check reports a component as healthy by returning nil.
+type Check func(ctx context.Context) error
+
+// Status is the outcome of a check or a report.
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusFailing Status = "failing"
+)
+
+// ComponentReport is the result of one check.
+type ComponentReport struct {
+	Status Status `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is failing if any of its components is.
+type Report struct {
+	Status     Status                     `json:"status"`
+	Components map[string]ComponentReport `json:"components"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Registry holds the liveness and readiness checks of the application.
+type Registry struct {
+	mu        sync.RWMutex
+	liveness  []namedCheck
+	readiness []namedCheck
+	draining  atomic.Bool
+	timeout   time.Duration
+}
+
+// NewRegistry runs every check with the given timeout.
+func NewRegistry(timeout time.Duration) *Registry {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Registry{timeout: timeout}
+}
+
+// AddLiveness adds a check that fails only if restarting the process would
+// help, e.g. a component that stopped working for good.
+func (r *Registry) AddLiveness(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.liveness = append(r.liveness, namedCheck{name: name, check: check})
+}
+
+// AddReadiness adds a check that fails while the component cannot serve
+// traffic, e.g. because it is saturated.
+func (r *Registry) AddReadiness(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.readiness = append(r.readiness, namedCheck{name: name, check: check})
+}
+
+// Drain makes readiness fail from now on, so load balancers stop sending
+// traffic before the server closes.
+func (r *Registry) Drain() {
+	r.draining.Store(true)
+}
+
+// Live runs the liveness checks.
+func (r *Registry) Live(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append([]namedCheck(nil), r.liveness...)
+	r.mu.RUnlock()
+
+	return r.run(ctx, checks)
+}
+
+// Ready runs the readiness checks, plus a "shutdown" component that fails
+// once the registry is drained.
+func (r *Registry) Ready(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append([]namedCheck(nil), r.readiness...)
+	r.mu.RUnlock()
+
+	checks = append(checks, namedCheck{name: "shutdown", check: func(context.Context) error {
+		if r.draining.Load() {
+			return ErrDraining
+		}
+		return nil
+	}})
+
+	return r.run(ctx, checks)
+}
+
+// run executes checks concurrently, each bounded by the registry timeout.
+func (r *Registry) run(ctx context.Context, checks []namedCheck) Report {
+	results := make([]ComponentReport, len(checks))
+
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, r.timeout)
+			defer cancel()
+
+			results[i] = ComponentReport{Status: StatusOK}
+			if err := runCheck(checkCtx, c.check); err != nil {
+				results[i] = ComponentReport{Status: StatusFailing, Error: err.Error()}
+			}
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Components: make(map[string]ComponentReport, len(checks))}
+	for i, c := range checks {
+		report.Components[c.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFailing
+		}
+	}
+	return report
+}
+
+// runCheck returns the check's error, or the context's if it does not return
+// in time.
+func runCheck(ctx context.Context, check Check) error {
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LivenessHandler serves Live as JSON, with 503 when failing.
+func (r *Registry) LivenessHandler() http.Handler {
+	return reportHandler(r.Live)
+}
+
+// ReadinessHandler serves Ready as JSON, with 503 when failing.
+func (r *Registry) ReadinessHandler() http.Handler {
+	return reportHandler(r.Ready)
+}
+
+func reportHandler(report func(ctx context.Context) Report) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rep := report(req.Context())
+
+		code := http.StatusOK
+		if rep.Status != StatusOK {
+			code = http.StatusServiceUnavailable
+			slog.WarnContext(req.Context(), "health check failing", "path", req.URL.Path, "components", failing(rep))
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(code)
+		if err := json.NewEncoder(w).Encode(rep); err != nil {
+			slog.ErrorContext(req.Context(), "failed to encode health report", "error", err)
+		}
+	})
+}
+
+// failing lists the names of the failing components, sorted.
+func failing(rep Report) []string {
+	var names []string
+	for name, c := range rep.Components {
+		if c.Status != StatusOK {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
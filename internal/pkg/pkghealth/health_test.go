@@ -0,0 +1,73 @@
+package pkghealth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRegistryReports(t *testing.T) {
+	reg := NewRegistry(20 * time.Millisecond)
+	reg.AddLiveness("bus", func(context.Context) error { return nil })
+	reg.AddReadiness("bus", func(context.Context) error { return nil })
+	reg.AddReadiness("routine", func(context.Context) error { return errors.New("saturated") })
+	reg.AddReadiness("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+
+	live := reg.Live(context.Background())
+	if live.Status != StatusOK || len(live.Components) != 1 {
+		t.Fatalf("expected liveness to pass, got %+v", live)
+	}
+
+	ready := reg.Ready(context.Background())
+	if ready.Status != StatusFailing {
+		t.Fatalf("expected readiness to fail, got %+v", ready)
+	}
+	if got := ready.Components["routine"]; got.Status != StatusFailing || got.Error != "saturated" {
+		t.Fatalf("expected the failing check to be reported, got %+v", got)
+	}
+	if got := ready.Components["slow"]; got.Status != StatusFailing || got.Error != context.DeadlineExceeded.Error() {
+		t.Fatalf("expected the slow check to time out, got %+v", got)
+	}
+	if got := ready.Components["shutdown"]; got.Status != StatusOK {
+		t.Fatalf("expected shutdown to pass before draining, got %+v", got)
+	}
+}
+
+func TestRegistryDrain(t *testing.T) {
+	reg := NewRegistry(0)
+	reg.AddLiveness("bus", func(context.Context) error { return nil })
+
+	ready := httptest.NewRecorder()
+	reg.ReadinessHandler().ServeHTTP(ready, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if ready.Code != http.StatusOK {
+		t.Fatalf("expected 200 before draining, got %d", ready.Code)
+	}
+
+	reg.Drain()
+
+	ready = httptest.NewRecorder()
+	reg.ReadinessHandler().ServeHTTP(ready, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if ready.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while draining, got %d", ready.Code)
+	}
+	var rep Report
+	if err := json.Unmarshal(ready.Body.Bytes(), &rep); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if got := rep.Components["shutdown"]; got.Status != StatusFailing || got.Error != ErrDraining.Error() {
+		t.Fatalf("expected shutdown to fail while draining, got %+v", got)
+	}
+
+	live := httptest.NewRecorder()
+	reg.LivenessHandler().ServeHTTP(live, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if live.Code != http.StatusOK {
+		t.Fatalf("expected liveness to pass while draining, got %d", live.Code)
+	}
+}
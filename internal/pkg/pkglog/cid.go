@@ -2,6 +2,10 @@ package pkglog
 
 import "context"
 
+// HeaderCorrelationID is the header that carries the correlation ID between
+// services.
+const HeaderCorrelationID = "X-Correlation-ID"
+
 type chainIDContextKey struct{}
 
 // GetCorrelationID returns the correlation ID stored in the context.
@@ -2,5 +2,6 @@
 //
 // It is built around slog and keeps logs consistent by:
 //   - Initializing a JSON handler with stable keys.
-//   - Attaching request correlation IDs (when present) to each log record.
+//   - Attaching request correlation IDs and W3C trace IDs (when present) to
+//     each log record, and carrying both into background work.
 package pkglog
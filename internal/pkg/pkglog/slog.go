@@ -51,6 +51,9 @@ func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
 	if cID := GetCorrelationID(ctx); cID != "" && cID != "[invalid_chain_id]" {
 		r.AddAttrs(slog.String("_cID", cID))
 	}
+	if traceID := TraceID(GetTraceParent(ctx)); traceID != "" {
+		r.AddAttrs(slog.String("_traceID", traceID))
+	}
 	r.AddAttrs(slog.String("service", "goflip"))
 
 	return h.Handler.Handle(ctx, r)
@@ -39,6 +39,7 @@ func TestContextHandlerAddsServiceAndCID(t *testing.T) {
 	handler := &contextHandler{Handler: capture}
 
 	ctx := SetCorrelationID(context.Background(), "cid-abc")
+	ctx = SetTraceParent(ctx, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
 	rec := slog.NewRecord(time.Now(), slog.LevelInfo, "hello", 0)
 
 	if err := handler.Handle(ctx, rec); err != nil {
@@ -51,6 +52,9 @@ func TestContextHandlerAddsServiceAndCID(t *testing.T) {
 	if got := capture.attrs["_cID"].String(); got != "cid-abc" {
 		t.Fatalf("expected _cID=cid-abc, got %q", got)
 	}
+	if got := capture.attrs["_traceID"].String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("expected _traceID from the traceparent, got %q", got)
+	}
 }
 
 func TestContextHandlerSkipsInvalidCID(t *testing.T) {
@@ -0,0 +1,51 @@
+package pkglog
+
+import (
+	"context"
+	"strings"
+)
+
+// HeaderTraceParent is the W3C Trace Context header.
+const HeaderTraceParent = "traceparent"
+
+type traceParentContextKey struct{}
+
+// LookupCorrelationID returns the correlation ID stored in the context and
+// whether there is one.
+func LookupCorrelationID(ctx context.Context) (string, bool) {
+	cid, ok := ctx.Value(chainIDContextKey{}).(string)
+	return cid, ok && cid != ""
+}
+
+// SetTraceParent stores a W3C traceparent header value into the context.
+func SetTraceParent(ctx context.Context, traceParent string) context.Context {
+	return context.WithValue(ctx, traceParentContextKey{}, traceParent)
+}
+
+// GetTraceParent returns the traceparent stored in the context, or "".
+func GetTraceParent(ctx context.Context) string {
+	tp, _ := ctx.Value(traceParentContextKey{}).(string)
+	return tp
+}
+
+// TraceID returns the trace-id field of a traceparent, or "".
+func TraceID(traceParent string) string {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) < 4 || len(parts[1]) != 32 {
+		return ""
+	}
+	return parts[1]
+}
+
+// Propagate copies the correlation ID and traceparent of src into dst. It
+// carries them from a request into work that outlives it, such as a
+// goroutine started on an application context.
+func Propagate(dst, src context.Context) context.Context {
+	if cid, ok := LookupCorrelationID(src); ok {
+		dst = SetCorrelationID(dst, cid)
+	}
+	if tp := GetTraceParent(src); tp != "" {
+		dst = SetTraceParent(dst, tp)
+	}
+	return dst
+}
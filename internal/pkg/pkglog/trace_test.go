@@ -0,0 +1,40 @@
+package pkglog
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPropagate(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	src := SetTraceParent(SetCorrelationID(context.Background(), "cid-123"), tp)
+	type appKey struct{}
+	dst := context.WithValue(context.Background(), appKey{}, "app")
+
+	got := Propagate(dst, src)
+	if cid, ok := LookupCorrelationID(got); !ok || cid != "cid-123" {
+		t.Fatalf("expected cid-123, got %q", cid)
+	}
+	if GetTraceParent(got) != tp {
+		t.Fatalf("expected traceparent %q, got %q", tp, GetTraceParent(got))
+	}
+	if got.Value(appKey{}) != "app" {
+		t.Fatal("expected the values of dst to be kept")
+	}
+
+	if got := Propagate(dst, context.Background()); got != dst {
+		t.Fatal("expected dst unchanged when src has nothing to carry")
+	}
+}
+
+func TestTraceID(t *testing.T) {
+	if got := TraceID("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("unexpected trace id %q", got)
+	}
+	for _, tp := range []string{"", "garbage", "00-short-00f067aa0ba902b7-01"} {
+		if got := TraceID(tp); got != "" {
+			t.Fatalf("expected no trace id for %q, got %q", tp, got)
+		}
+	}
+}
@@ -1,6 +1,6 @@
 // Package pkgrouter wraps HTTP routing and common middleware used by the API.
 //
 // It provides a small router abstraction over httprouter plus shared concerns
-// like JSON encoding, error mapping, logging, recovery, authentication, and
-// correlation ID propagation.
+// like JSON encoding, error mapping, logging, recovery, authentication,
+// correlation ID propagation, and tracing.
 package pkgrouter
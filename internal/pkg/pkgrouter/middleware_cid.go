@@ -14,9 +14,11 @@ type Generator interface {
 
 const (
 	// HeaderCorrelationID is the canonical header used to track requests end-to-end.
-	HeaderCorrelationID = "X-Correlation-ID"
+	HeaderCorrelationID = pkglog.HeaderCorrelationID
 	// HeaderRequestID is an accepted alternative header name used by some proxies.
 	HeaderRequestID = "X-Request-ID"
+	// HeaderTraceParent is the W3C Trace Context header.
+	HeaderTraceParent = pkglog.HeaderTraceParent
 )
 
 func normalizeCID(v string) string {
@@ -34,6 +36,36 @@ func normalizeCID(v string) string {
 	return v
 }
 
+// normalizeTraceParent returns v if it is a valid W3C traceparent, or "".
+// Future versions may append fields, which are kept.
+func normalizeTraceParent(v string) string {
+	v = strings.ToLower(strings.TrimSpace(v))
+	parts := strings.Split(v, "-")
+	if len(parts) < 4 || (parts[0] == "00" && len(parts) != 4) {
+		return ""
+	}
+
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || version == "ff" || len(traceID) != 32 || len(parentID) != 16 || len(flags) != 2 {
+		return ""
+	}
+	if !isHex(version+traceID+parentID+flags) || strings.Trim(traceID, "0") == "" || strings.Trim(parentID, "0") == "" {
+		return ""
+	}
+	return v
+}
+
+func isHex(v string) bool {
+	for _, c := range v {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// middlewareCorrelationID also keeps a valid traceparent header in the
+// context, so both can be carried into background work and downstream calls.
 func middlewareCorrelationID(uid Generator) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -49,6 +81,9 @@ func middlewareCorrelationID(uid Generator) Middleware {
 				w.Header().Set(HeaderCorrelationID, cid)
 				r = r.WithContext(pkglog.SetCorrelationID(r.Context(), cid))
 			}
+			if tp := normalizeTraceParent(r.Header.Get(HeaderTraceParent)); tp != "" {
+				r = r.WithContext(pkglog.SetTraceParent(r.Context(), tp))
+			}
 
 			next.ServeHTTP(w, r)
 		})
@@ -70,3 +70,36 @@ func TestMiddlewareCorrelationIDGeneratesWhenMissing(t *testing.T) {
 		t.Fatalf("expected generator called once")
 	}
 }
+
+func TestMiddlewareCorrelationIDKeepsValidTraceParent(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", want: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{header: " 00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01 ", want: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{header: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", want: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{header: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{header: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{header: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{header: "00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01"},
+		{header: "00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01"},
+		{header: ""},
+	}
+
+	for _, tt := range tests {
+		var got string
+		wrapped := middlewareCorrelationID(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = pkglog.GetTraceParent(r.Context())
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+		req.Header.Set(HeaderTraceParent, tt.header)
+		wrapped.ServeHTTP(httptest.NewRecorder(), req)
+
+		if got != tt.want {
+			t.Fatalf("traceparent %q: expected %q, got %q", tt.header, tt.want, got)
+		}
+	}
+}
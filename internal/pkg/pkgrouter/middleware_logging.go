@@ -3,10 +3,12 @@ package pkgrouter
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"log/slog"
+	"mime"
 	"net"
 	"net/http"
 	"net/url"
@@ -69,6 +71,7 @@ type statusRecorder struct {
 	bytes  int
 	body   *bytes.Buffer
 	capped bool
+	opts   *logOptions
 }
 
 func (w *statusRecorder) WriteHeader(code int) {
@@ -81,7 +84,7 @@ func (w *statusRecorder) Write(p []byte) (int, error) {
 		w.status = http.StatusOK
 	}
 
-	if w.body != nil && !w.capped && len(p) > 0 {
+	if w.body != nil && !w.capped && len(p) > 0 && (w.opts == nil || !w.opts.skipBody) {
 		remaining := maxLoggedBodyBytes - w.body.Len()
 		if remaining > 0 {
 			if len(p) > remaining {
@@ -168,17 +171,95 @@ func parseAndMaskBody(contentType string, body []byte) any {
 	return string(body)
 }
 
+type logOptionsKey struct{}
+
+// logOptions is shared through the request context so middleware registered
+// on a single route can adjust what the global logging middleware records.
+type logOptions struct {
+	skipBody bool
+}
+
+// SkipBodyLogging is a per-route middleware that keeps request and response
+// bodies out of the logs, for example on upload or streaming endpoints.
+func SkipBodyLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if opts, ok := r.Context().Value(logOptionsKey{}).(*logOptions); ok {
+			opts.skipBody = true
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bodyTee copies up to maxLoggedBodyBytes of what the handler reads from the
+// request body. It never reads on its own, so streaming handlers keep
+// streaming and only the consumed prefix is logged.
+type bodyTee struct {
+	io.ReadCloser
+	opts   *logOptions
+	buf    bytes.Buffer
+	capped bool
+}
+
+func (t *bodyTee) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 && !t.opts.skipBody && !t.capped {
+		remaining := maxLoggedBodyBytes - t.buf.Len()
+		if n > remaining {
+			t.buf.Write(p[:remaining])
+			t.capped = true
+		} else {
+			t.buf.Write(p[:n])
+		}
+	}
+	return n, err
+}
+
+// loggableBody reports whether a request body is worth capturing. Multipart,
+// compressed and binary payloads are skipped entirely.
+func loggableBody(r *http.Request) bool {
+	if r.Body == nil || r.Body == http.NoBody {
+		return false
+	}
+
+	if enc := strings.ToLower(r.Header.Get("Content-Encoding")); enc != "" && enc != "identity" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return true
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"),
+		strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "video/"):
+		return false
+	}
+
+	switch mediaType {
+	case "application/octet-stream", "application/zip", "application/x-zip-compressed",
+		"application/gzip", "application/x-gzip", "application/zstd", "application/pdf":
+		return false
+	}
+
+	return true
+}
+
 func middlewareLogging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		route := matchedRoutePath(r)
 		start := time.Now()
 
-		var reqBodyBytes []byte
-		if r.Body != nil {
-			//nolint:errcheck // best effort for logging only
-			reqBodyBytes, _ = io.ReadAll(r.Body)
+		opts := &logOptions{}
+		r = r.WithContext(context.WithValue(r.Context(), logOptionsKey{}, opts))
+
+		var tee *bodyTee
+		if loggableBody(r) {
+			tee = &bodyTee{ReadCloser: r.Body, opts: opts}
+			r.Body = tee
 		}
-		r.Body = io.NopCloser(bytes.NewBuffer(reqBodyBytes))
 
 		slog.InfoContext(
 			r.Context(),
@@ -187,10 +268,9 @@ func middlewareLogging(next http.Handler) http.Handler {
 			"route", route,
 			"path", r.URL.Path,
 			"headers", maskHeaders(r.Header),
-			"body", parseAndMaskBody(r.Header.Get("Content-Type"), reqBodyBytes),
 		)
 
-		rec := &statusRecorder{ResponseWriter: w, body: &bytes.Buffer{}}
+		rec := &statusRecorder{ResponseWriter: w, body: &bytes.Buffer{}, opts: opts}
 		next.ServeHTTP(rec, r)
 
 		status := rec.status
@@ -198,8 +278,19 @@ func middlewareLogging(next http.Handler) http.Handler {
 			status = http.StatusOK
 		}
 
+		var reqBody any
+		if tee != nil && !opts.skipBody {
+			reqBody = parseAndMaskBody(r.Header.Get("Content-Type"), tee.buf.Bytes())
+			if tee.capped {
+				reqBody = map[string]any{
+					"body":      reqBody,
+					"truncated": true,
+				}
+			}
+		}
+
 		var respBody any
-		if rec.body != nil {
+		if rec.body != nil && !opts.skipBody {
 			var respJSON any
 			if err := json.Unmarshal(rec.body.Bytes(), &respJSON); err == nil {
 				respBody = maskData(respJSON)
@@ -225,6 +316,7 @@ func middlewareLogging(next http.Handler) http.Handler {
 			"status", status,
 			"bytes", rec.bytes,
 			"latency_ms", time.Since(start).Milliseconds(),
+			"request_body", reqBody,
 			"body", respBody,
 		)
 	})
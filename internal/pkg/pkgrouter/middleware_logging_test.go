@@ -0,0 +1,197 @@
+package pkgrouter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// captureLogs routes the default slog logger into a buffer for the duration
+// of the test.
+func captureLogs(t testing.TB) *bytes.Buffer {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return buf
+}
+
+func responseLog(t *testing.T, logs *bytes.Buffer) map[string]any {
+	t.Helper()
+
+	for line := range strings.SplitSeq(strings.TrimSpace(logs.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("decode log line: %v", err)
+		}
+		if entry["msg"] == "response sent" {
+			return entry
+		}
+	}
+	t.Fatal("response log not found")
+	return nil
+}
+
+// zeroReader yields n zero bytes without holding them in memory.
+type zeroReader struct {
+	n int64
+}
+
+func (z *zeroReader) Read(p []byte) (int, error) {
+	if z.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > z.n {
+		p = p[:z.n]
+	}
+	clear(p)
+	z.n -= int64(len(p))
+	return len(p), nil
+}
+
+func drainHandler(t testing.TB, want int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := io.Copy(io.Discard, r.Body)
+		if err != nil || n != want {
+			t.Errorf("handler read %d bytes (err %v), want %d", n, err, want)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func TestMiddlewareLoggingTeesRequestBody(t *testing.T) {
+	logs := captureLogs(t)
+
+	var got []byte
+	h := middlewareLogging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"user":"a","password":"secret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if string(got) != `{"user":"a","password":"secret"}` {
+		t.Fatalf("handler saw altered body: %q", got)
+	}
+
+	body, ok := responseLog(t, logs)["request_body"].(map[string]any)
+	if !ok || body["user"] != "a" || body["password"] != "***" {
+		t.Fatalf("unexpected logged request body: %#v", body)
+	}
+}
+
+func TestMiddlewareLoggingCapsRequestBody(t *testing.T) {
+	logs := captureLogs(t)
+
+	size := int64(3 * maxLoggedBodyBytes)
+	h := middlewareLogging(drainHandler(t, size))
+
+	req := httptest.NewRequest(http.MethodPost, "/notes", &zeroReader{n: size})
+	req.Header.Set("Content-Type", "text/plain")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	body, ok := responseLog(t, logs)["request_body"].(map[string]any)
+	if !ok || body["truncated"] != true {
+		t.Fatalf("expected truncated request body, got %#v", body)
+	}
+	if logged, _ := body["body"].(string); len(logged) != maxLoggedBodyBytes {
+		t.Fatalf("expected %d logged bytes, got %d", maxLoggedBodyBytes, len(logged))
+	}
+}
+
+func TestMiddlewareLoggingSkipsBinaryBodies(t *testing.T) {
+	cases := map[string]http.Header{
+		"multipart":    {"Content-Type": {"multipart/form-data; boundary=x"}},
+		"octet-stream": {"Content-Type": {"application/octet-stream"}},
+		"gzip":         {"Content-Type": {"text/csv"}, "Content-Encoding": {"gzip"}},
+	}
+
+	for name, header := range cases {
+		t.Run(name, func(t *testing.T) {
+			logs := captureLogs(t)
+
+			h := middlewareLogging(drainHandler(t, 4))
+			req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("data"))
+			req.Header = header
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			if body, found := responseLog(t, logs)["request_body"]; found && body != nil {
+				t.Fatalf("expected request body to be skipped, got %#v", body)
+			}
+		})
+	}
+}
+
+func TestSkipBodyLogging(t *testing.T) {
+	logs := captureLogs(t)
+
+	h := middlewareLogging(SkipBodyLogging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte(`{"access_token":"x"}`))
+	})))
+
+	req := httptest.NewRequest(http.MethodPost, "/statements", strings.NewReader("a,b,c\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Body.String() != `{"access_token":"x"}` {
+		t.Fatalf("response altered: %q", rec.Body.String())
+	}
+
+	entry := responseLog(t, logs)
+	if entry["request_body"] != nil || entry["body"] != nil {
+		t.Fatalf("expected bodies to be skipped, got request %#v response %#v", entry["request_body"], entry["body"])
+	}
+}
+
+func TestMiddlewareLoggingUploadMemoryIsFlat(t *testing.T) {
+	captureLogs(t)
+
+	const size = 64 << 20
+	h := middlewareLogging(drainHandler(t, size))
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	req := httptest.NewRequest(http.MethodPost, "/statements", &zeroReader{n: size})
+	req.Header.Set("Content-Type", "text/csv")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 8<<20 {
+		t.Fatalf("logging a %d byte upload allocated %d bytes", size, allocated)
+	}
+}
+
+// BenchmarkMiddlewareLoggingUpload streams bodies of growing size through the
+// logging middleware. B/op stays flat because only the capped prefix is kept.
+func BenchmarkMiddlewareLoggingUpload(b *testing.B) {
+	captureLogs(b)
+
+	for _, size := range []int64{1 << 20, 16 << 20, 128 << 20} {
+		b.Run(fmt.Sprintf("%dMiB", size>>20), func(b *testing.B) {
+			h := middlewareLogging(drainHandler(b, size))
+
+			b.ReportAllocs()
+			b.SetBytes(size)
+			for b.Loop() {
+				req := httptest.NewRequest(http.MethodPost, "/statements", &zeroReader{n: size})
+				req.Header.Set("Content-Type", "text/csv")
+				h.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		})
+	}
+}
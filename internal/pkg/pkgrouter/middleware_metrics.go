@@ -0,0 +1,42 @@
+package pkgrouter
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MiddlewareMetrics records request latency by method, matched route and
+// status, and the requests in flight, on reg. Add it with Router.Use before
+// registering endpoints; it panics if the metrics are already registered.
+func MiddlewareMetrics(reg prometheus.Registerer) Middleware {
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by method, route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests being served.",
+	})
+	reg.MustRegister(duration, inFlight)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			inFlight.Inc()
+			defer inFlight.Dec()
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			duration.WithLabelValues(r.Method, matchedRoutePath(r), strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package pkgrouter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddlewareMetricsUsesMatchedRoute(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	r := NewRouter(nil)
+	r.Use(MiddlewareMetrics(reg))
+	r.GET("/items/:id", func(context.Context, *http.Request) (any, error) {
+		return map[string]string{"ok": "yes"}, nil
+	})
+
+	for _, path := range []string{"/items/1", "/items/2"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+
+	var count uint64
+	for _, family := range families {
+		if family.GetName() != "http_request_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["route"] != "/items/:id" || labels["method"] != http.MethodGet || labels["status"] != "200" {
+				t.Fatalf("unexpected labels %v", labels)
+			}
+			count += metric.GetHistogram().GetSampleCount()
+		}
+	}
+	if count != 2 {
+		t.Fatalf("expected both requests under one route, got %d", count)
+	}
+
+	if n := testutil.CollectAndCount(reg, "http_requests_in_flight"); n != 1 {
+		t.Fatalf("expected the in-flight gauge, got %d series", n)
+	}
+}
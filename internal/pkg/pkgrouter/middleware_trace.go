@@ -0,0 +1,51 @@
+package pkgrouter
+
+import (
+	"net/http"
+
+	"github.com/shandysiswandi/goflip/internal/pkg/pkglog"
+	"github.com/shandysiswandi/goflip/internal/pkg/pkgtrace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/shandysiswandi/goflip/internal/pkg/pkgrouter"
+
+// middlewareTracing starts a server span per request, named after the matched
+// route and continuing an incoming traceparent. The traceparent kept for logs
+// and background work then points at this span.
+func middlewareTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := matchedRoutePath(r)
+
+		ctx := propagation.TraceContext{}.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(tracerName).Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		if tp := pkgtrace.TraceParent(ctx); tp != "" {
+			ctx = pkglog.SetTraceParent(ctx, tp)
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package pkgrouter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shandysiswandi/goflip/internal/pkg/pkglog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddlewareTracingStartsServerSpan(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	var handlerTP string
+	r := NewRouter(nil)
+	r.GET("/items/:id", func(ctx context.Context, _ *http.Request) (any, error) {
+		handlerTP = pkglog.GetTraceParent(ctx)
+		return nil, errors.New("boom")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/items/42", nil)
+	req.Header.Set(HeaderTraceParent, incoming)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected one span, got %d", len(spans))
+	}
+	span := spans[0]
+
+	if span.Name != "GET /items/:id" || span.SpanKind != trace.SpanKindServer {
+		t.Fatalf("expected a server span named after the route, got %q (%v)", span.Name, span.SpanKind)
+	}
+	if span.SpanContext.TraceID().String() != pkglog.TraceID(incoming) || span.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("expected the span to continue the incoming trace, got %s", span.SpanContext.TraceID())
+	}
+	if want := "00-" + span.SpanContext.TraceID().String() + "-" + span.SpanContext.SpanID().String() + "-01"; handlerTP != want {
+		t.Fatalf("expected the handler traceparent %q, got %q", want, handlerTP)
+	}
+	if span.Status.Code != codes.Error {
+		t.Fatalf("expected a 500 to mark the span as failed, got %v", span.Status.Code)
+	}
+
+	attrs := attribute.NewSet(span.Attributes...)
+	if v, _ := attrs.Value("http.route"); v.AsString() != "/items/:id" {
+		t.Fatalf("expected the http.route attribute, got %q", v.AsString())
+	}
+	if v, _ := attrs.Value("http.response.status_code"); v.AsInt64() != http.StatusInternalServerError {
+		t.Fatalf("expected status code 500, got %d", v.AsInt64())
+	}
+}
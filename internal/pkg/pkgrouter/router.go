@@ -13,7 +13,8 @@ import (
 
 // Handler is the application-style handler used by this router.
 //
-// It returns a response payload (that will be JSON encoded) or an error.
+// It returns a response payload (that will be JSON encoded) or an error. A
+// payload implementing EventStream is streamed as Server-Sent Events instead.
 type Handler func(ctx context.Context, r *http.Request) (any, error)
 
 // Router is an http.Handler that wraps httprouter and a middleware chain.
@@ -93,6 +94,7 @@ func NewRouter(uuid Generator) *Router {
 		mws: []Middleware{
 			middlewareRecoverer,
 			middlewareCorrelationID(uuid),
+			middlewareTracing,
 			middlewareLogging,
 		},
 	}
@@ -101,10 +103,6 @@ func NewRouter(uuid Generator) *Router {
 		writeJSON(w, map[string]string{"message": "hi from goflip"}, http.StatusOK)
 	}))
 
-	ro.Handle(http.MethodGet, "/health", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-		writeJSON(w, map[string]string{"message": "server is running well"}, http.StatusOK)
-	}))
-
 	return ro
 }
 
@@ -150,6 +148,10 @@ func (r *Router) endpoint(method, path string, h Handler, mws ...Middleware) {
 			r.errorCodec(re.Context(), w, err)
 			return
 		}
+		if stream, ok := resp.(EventStream); ok {
+			writeEventStream(re.Context(), w, stream)
+			return
+		}
 		r.encoder(re.Context(), w, resp)
 	}), append(r.mws, mws...)...))
 }
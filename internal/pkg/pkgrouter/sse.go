@@ -0,0 +1,71 @@
+package pkgrouter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// EventStream is a handler response that is written as Server-Sent Events
+// instead of the JSON envelope. Stream runs until it returns or the client
+// goes away; errors after the headers are sent can only be logged.
+type EventStream interface {
+	Stream(ctx context.Context, w *SSEWriter) error
+}
+
+// SSEWriter writes events in the text/event-stream format and flushes each
+// one to the client.
+type SSEWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+}
+
+// Send writes one event whose data is data encoded as JSON.
+func (s *SSEWriter) Send(event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// Comment writes a comment line, typically as a heartbeat that keeps idle
+// proxies from closing the connection.
+func (s *SSEWriter) Comment(text string) error {
+	text = strings.ReplaceAll(text, "\n", " ")
+	if _, err := fmt.Fprintf(s.w, ": %s\n\n", text); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+func writeEventStream(ctx context.Context, w http.ResponseWriter, stream EventStream) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, errorResponse{Message: "streaming is not supported"}, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	err := stream.Stream(ctx, &SSEWriter{w: w, flusher: flusher})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		slog.WarnContext(ctx, "server: event stream ended with error", "error", err)
+	}
+}
@@ -0,0 +1,38 @@
+package pkgrouter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testStream struct{}
+
+func (testStream) Stream(ctx context.Context, w *SSEWriter) error {
+	if err := w.Comment("hello\nworld"); err != nil {
+		return err
+	}
+	return w.Send("tick", map[string]int{"n": 1})
+}
+
+func TestEndpointWritesEventStream(t *testing.T) {
+	router := NewRouter(nil)
+	router.GET("/events", func(ctx context.Context, r *http.Request) (any, error) {
+		return testStream{}, nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	if got, want := rec.Body.String(), ": hello world\n\nevent: tick\ndata: {\"n\":1}\n\n"; got != want {
+		t.Fatalf("unexpected body:\n%q\nwant:\n%q", got, want)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"runtime/debug"
 	"sync"
+	"sync/atomic"
 )
 
 // DefaultMaxGoroutine is used when NewManager receives a non-positive limit.
@@ -19,6 +20,10 @@ type Manager struct {
 	errs []error
 	wg   *sync.WaitGroup
 	sema chan struct{}
+
+	waiting  atomic.Int64
+	canceled atomic.Uint64
+	panics   atomic.Uint64
 }
 
 // NewManager creates a new Manager with the provided maximum concurrency.
@@ -38,9 +43,13 @@ func NewManager(maxGoroutine int) *Manager {
 // If the manager is already at its concurrency limit, the function is not run
 // and a warning is logged.
 func (g *Manager) Go(pCtx context.Context, f func(ctx context.Context) error) {
+	g.waiting.Add(1)
 	select {
 	case g.sema <- struct{}{}: // Acquire a semaphore slot
+		g.waiting.Add(-1)
 	case <-pCtx.Done():
+		g.waiting.Add(-1)
+		g.canceled.Add(1)
 		slog.WarnContext(pCtx, "goroutine canceled before start", "because", pCtx.Err())
 		return
 	}
@@ -52,6 +61,7 @@ func (g *Manager) Go(pCtx context.Context, f func(ctx context.Context) error) {
 			<-g.sema // Release semaphore slot
 
 			if rvr := recover(); rvr != nil {
+				g.panics.Add(1)
 				stack := debug.Stack()
 				slog.ErrorContext(pCtx, "panic occurred in goroutine", "stack", string(stack))
 			}
@@ -59,6 +69,7 @@ func (g *Manager) Go(pCtx context.Context, f func(ctx context.Context) error) {
 
 		select {
 		case <-pCtx.Done():
+			g.canceled.Add(1)
 			slog.WarnContext(pCtx, "goroutine canceled", "because", pCtx.Err())
 		default:
 			if err := f(pCtx); err != nil {
@@ -76,3 +87,18 @@ func (g *Manager) Wait() error {
 
 	return errors.Join(g.errs...)
 }
+
+// InUse is the number of slots taken by running functions.
+func (g *Manager) InUse() int {
+	return len(g.sema)
+}
+
+// Limit is the maximum number of functions running at once.
+func (g *Manager) Limit() int {
+	return cap(g.sema)
+}
+
+// Waiting is the number of calls to Go blocked on a free slot.
+func (g *Manager) Waiting() int {
+	return int(g.waiting.Load())
+}
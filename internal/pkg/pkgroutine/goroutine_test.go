@@ -3,7 +3,11 @@ package pkgroutine
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestNewManagerDefaultMax(t *testing.T) {
@@ -47,3 +51,54 @@ func TestManagerRecoversPanics(t *testing.T) {
 		t.Fatalf("expected nil error, got %v", err)
 	}
 }
+
+func TestManagerMetrics(t *testing.T) {
+	mgr := NewManager(1)
+	reg := prometheus.NewRegistry()
+	if err := mgr.RegisterMetrics(reg); err != nil {
+		t.Fatalf("register metrics: %v", err)
+	}
+
+	mgr.Go(context.Background(), func(ctx context.Context) error {
+		panic("boom")
+	})
+	if err := mgr.Wait(); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+
+	// With the only slot taken, a call whose context has ended is skipped.
+	release := make(chan struct{})
+	mgr.Go(context.Background(), func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	mgr.Go(canceled, func(ctx context.Context) error { return nil })
+	if mgr.InUse() != 1 {
+		t.Fatalf("expected one slot in use, got %d", mgr.InUse())
+	}
+	close(release)
+	if err := mgr.Wait(); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+
+	expected := `
+# HELP routine_canceled_total Functions skipped because their context ended before they ran.
+# TYPE routine_canceled_total counter
+routine_canceled_total 1
+# HELP routine_panics_total Functions that panicked.
+# TYPE routine_panics_total counter
+routine_panics_total 1
+# HELP routine_slots_in_use Goroutine slots taken by running functions.
+# TYPE routine_slots_in_use gauge
+routine_slots_in_use 0
+# HELP routine_slots_limit Maximum number of functions running at once.
+# TYPE routine_slots_limit gauge
+routine_slots_limit 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"routine_canceled_total", "routine_panics_total", "routine_slots_in_use", "routine_slots_limit"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,39 @@
+package pkgroutine
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RegisterMetrics exposes the slot usage of the manager on reg.
+func (g *Manager) RegisterMetrics(reg prometheus.Registerer) error {
+	collectors := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "routine_slots_in_use",
+			Help: "Goroutine slots taken by running functions.",
+		}, func() float64 { return float64(g.InUse()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "routine_slots_limit",
+			Help: "Maximum number of functions running at once.",
+		}, func() float64 { return float64(g.Limit()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "routine_waiting",
+			Help: "Functions waiting for a free goroutine slot.",
+		}, func() float64 { return float64(g.Waiting()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "routine_canceled_total",
+			Help: "Functions skipped because their context ended before they ran.",
+		}, func() float64 { return float64(g.canceled.Load()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "routine_panics_total",
+			Help: "Functions that panicked.",
+		}, func() float64 { return float64(g.panics.Load()) }),
+	}
+
+	var errs []error
+	for _, c := range collectors {
+		errs = append(errs, reg.Register(c))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,7 @@
+// Package pkgtrace sets up OpenTelemetry tracing for the application.
+//
+// It installs the global tracer provider with the configured exporter (OTLP,
+// stdout, or none) and W3C Trace Context propagation, and offers helpers to
+// end spans with an error and to carry a span across an event as a
+// traceparent value.
+package pkgtrace
@@ -0,0 +1,160 @@
+package pkgtrace
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+
+	"github.com/shandysiswandi/goflip/internal/pkg/pkglog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters accepted by Config.Exporter.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// DefaultServiceName is used when Config.ServiceName is empty.
+const DefaultServiceName = "goflip"
+
+// Config selects where spans are exported.
+type Config struct {
+	// Exporter is ExporterNone (the default), ExporterStdout or ExporterOTLP.
+	Exporter string
+
+	// Endpoint is the OTLP/HTTP traces URL, e.g.
+	// "http://otel-collector:4318/v1/traces". Empty falls back to the
+	// OTEL_EXPORTER_OTLP_* environment variables.
+	Endpoint string
+
+	ServiceName string
+
+	// SampleRatio is the share of new traces that are recorded. Zero records
+	// all of them; sampled parents are always followed.
+	SampleRatio float64
+
+	// Writer receives the stdout exporter output. Defaults to os.Stdout.
+	Writer io.Writer
+}
+
+// Init installs the global tracer provider and W3C Trace Context propagator.
+// The returned function flushes and stops the exporter. With ExporterNone,
+// spans are not recorded but incoming trace context is still propagated.
+func Init(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, fmt.Errorf("invalid trace sample ratio %v: expected 0 to 1", cfg.SampleRatio)
+	}
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		w := cfg.Writer
+		if w == nil {
+			w = os.Stdout
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(w))
+		if err != nil {
+			return nil, fmt.Errorf("init stdout trace exporter: %w", err)
+		}
+		exporter = exp
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			u, err := url.Parse(cfg.Endpoint)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("invalid otlp endpoint %q: expected an http or https URL", cfg.Endpoint)
+			}
+			if u.Path == "" || u.Path == "/" {
+				u.Path = "/v1/traces"
+			}
+			opts = append(opts, otlptracehttp.WithEndpointURL(u.String()))
+		}
+		exp, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("init otlp trace exporter: %w", err)
+		}
+		exporter = exp
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+
+	provider := NewProvider(exporter, cfg.ServiceName, cfg.SampleRatio)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// NewProvider batches the spans of a service to exporter, sampling
+// sampleRatio of new traces (all of them when zero).
+func NewProvider(exporter sdktrace.SpanExporter, serviceName string, sampleRatio float64) *sdktrace.TracerProvider {
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if sampleRatio > 0 && sampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(sampleRatio)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+}
+
+// End records err on span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceParent returns the traceparent of the span in ctx, to be stored with
+// an event so its consumer continues the trace. Without a span it falls back
+// to the traceparent kept by pkglog.
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	if tp := carrier.Get("traceparent"); tp != "" {
+		return tp
+	}
+	return pkglog.GetTraceParent(ctx)
+}
+
+// Extract returns ctx with the remote span of traceParent as parent of the
+// spans started from it. An invalid traceParent leaves ctx unchanged.
+func Extract(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{"traceparent": traceParent})
+}
+
+// Detach returns dst carrying the span of src, so work started on dst, such
+// as a goroutine that outlives a request, joins the trace of src.
+func Detach(dst, src context.Context) context.Context {
+	sc := trace.SpanContextFromContext(src)
+	if !sc.IsValid() {
+		return dst
+	}
+	return trace.ContextWithSpanContext(dst, sc)
+}
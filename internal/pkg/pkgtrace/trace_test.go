@@ -0,0 +1,89 @@
+package pkgtrace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shandysiswandi/goflip/internal/pkg/pkglog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestInitRejectsInvalidConfig(t *testing.T) {
+	tests := []Config{
+		{Exporter: "jaeger"},
+		{Exporter: ExporterOTLP, Endpoint: "collector:4318"},
+		{Exporter: ExporterOTLP, Endpoint: "ftp://collector:4318"},
+		{Exporter: ExporterStdout, SampleRatio: 1.5},
+	}
+
+	for _, cfg := range tests {
+		if _, err := Init(context.Background(), cfg); err == nil {
+			t.Fatalf("expected an error for %+v", cfg)
+		}
+	}
+}
+
+func TestInitStdoutExportsSpans(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	var buf bytes.Buffer
+	shutdown, err := Init(context.Background(), Config{Exporter: ExporterStdout, ServiceName: "goflip-test", Writer: &buf})
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "stdout-span")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "stdout-span") || !strings.Contains(buf.String(), "goflip-test") {
+		t.Fatalf("expected the span and service name on the writer, got %q", buf.String())
+	}
+}
+
+func TestTraceParentRoundTrip(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test")
+
+	if got := TraceParent(context.Background()); got != "" {
+		t.Fatalf("expected no traceparent without a span, got %q", got)
+	}
+	if got := TraceParent(pkglog.SetTraceParent(context.Background(), testTraceParent)); got != testTraceParent {
+		t.Fatalf("expected the pkglog traceparent as fallback, got %q", got)
+	}
+
+	ctx, span := tracer.Start(Extract(context.Background(), testTraceParent), "child")
+	if span.SpanContext().TraceID().String() != pkglog.TraceID(testTraceParent) {
+		t.Fatalf("expected the extracted trace to be continued, got %s", span.SpanContext().TraceID())
+	}
+	want := "00-" + span.SpanContext().TraceID().String() + "-" + span.SpanContext().SpanID().String() + "-01"
+	if got := TraceParent(ctx); got != want {
+		t.Fatalf("expected traceparent %q, got %q", want, got)
+	}
+
+	detached := Detach(context.Background(), ctx)
+	if !trace.SpanContextFromContext(detached).Equal(span.SpanContext()) {
+		t.Fatal("expected the span to be carried into the detached context")
+	}
+	if got := Detach(context.Background(), context.Background()); trace.SpanContextFromContext(got).IsValid() {
+		t.Fatal("expected nothing to carry without a span")
+	}
+
+	End(span, errors.New("boom"))
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Status.Code != codes.Error || len(spans[0].Events) != 1 {
+		t.Fatalf("expected End to record the error, got %+v", spans)
+	}
+}
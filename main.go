@@ -8,11 +8,13 @@ import (
 )
 
 func main() {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
 	application := app.New()    // Initialize the application
 	wait := application.Start() // Start the application and wait for the termination signal
 	<-wait                      // Wait for the application to receive a termination signal
-	application.Stop(ctx)       // Stop the application gracefully
+
+	// The shutdown deadline starts with the signal, not with the process.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	application.Stop(ctx) // Stop the application gracefully
 }